@@ -0,0 +1,241 @@
+// backend/auth.go
+
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"firebase.google.com/go/auth"
+)
+
+// VerifiedToken is what we keep from a valid ID token.
+type VerifiedToken struct {
+	UID     string
+	Expires time.Time
+}
+
+// TokenVerifier checks a raw bearer token. Firebase is used in production;
+// LocalJWTVerifier lets tests and offline setups sign their own tokens.
+type TokenVerifier interface {
+	Verify(ctx context.Context, idToken string) (*VerifiedToken, error)
+}
+
+var verifier TokenVerifier
+
+type contextKey string
+
+const userIDKey contextKey = "userId"
+
+// initAuth picks a verifier from AUTH_VERIFIER: "firebase" (default) or "local".
+func initAuth() {
+	switch mode := strings.ToLower(os.Getenv("AUTH_VERIFIER")); mode {
+	case "", "firebase":
+		client, err := firebaseApp().Auth(context.Background())
+		if err != nil {
+			log.Fatalf("error initializing firebase auth client: %v", err)
+		}
+		verifier = newCachedVerifier(&FirebaseVerifier{client: client})
+	case "local":
+		secret := os.Getenv("AUTH_JWT_SECRET")
+		if secret == "" {
+			log.Fatalf("AUTH_JWT_SECRET is required for the local verifier")
+		}
+		verifier = newCachedVerifier(&LocalJWTVerifier{Secret: []byte(secret)})
+	default:
+		log.Fatalf("unknown AUTH_VERIFIER %q", mode)
+	}
+}
+
+// FirebaseVerifier verifies Firebase ID tokens with one shared Auth client.
+type FirebaseVerifier struct {
+	client *auth.Client
+}
+
+func (f *FirebaseVerifier) Verify(ctx context.Context, idToken string) (*VerifiedToken, error) {
+	token, err := f.client.VerifyIDToken(ctx, idToken)
+	if err != nil {
+		return nil, err
+	}
+	return &VerifiedToken{UID: token.UID, Expires: time.Unix(token.Expires, 0)}, nil
+}
+
+// LocalJWTVerifier accepts HS256 JWTs signed with Secret, using "sub" as the UID.
+type LocalJWTVerifier struct {
+	Secret []byte
+}
+
+var errInvalidToken = errors.New("invalid token")
+
+func (l *LocalJWTVerifier) Verify(ctx context.Context, idToken string) (*VerifiedToken, error) {
+	parts := strings.Split(idToken, ".")
+	if len(parts) != 3 {
+		return nil, errInvalidToken
+	}
+	var header struct {
+		Alg string `json:"alg"`
+	}
+	if err := decodeJWTPart(parts[0], &header); err != nil || header.Alg != "HS256" {
+		return nil, errInvalidToken
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, errInvalidToken
+	}
+	mac := hmac.New(sha256.New, l.Secret)
+	mac.Write([]byte(parts[0] + "." + parts[1]))
+	if !hmac.Equal(sig, mac.Sum(nil)) {
+		return nil, errInvalidToken
+	}
+	var claims struct {
+		Sub string `json:"sub"`
+		Exp int64  `json:"exp"`
+	}
+	if err := decodeJWTPart(parts[1], &claims); err != nil || claims.Sub == "" {
+		return nil, errInvalidToken
+	}
+	expires := time.Unix(claims.Exp, 0)
+	if claims.Exp == 0 || time.Now().After(expires) {
+		return nil, errors.New("token expired")
+	}
+	return &VerifiedToken{UID: claims.Sub, Expires: expires}, nil
+}
+
+func decodeJWTPart(part string, v interface{}) error {
+	b, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+// SignLocalJWT issues a token LocalJWTVerifier accepts. Handy for tests and local tooling.
+func SignLocalJWT(secret []byte, uid string, ttl time.Duration) string {
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+	claims, _ := json.Marshal(map[string]interface{}{"sub": uid, "exp": time.Now().Add(ttl).Unix()})
+	payload := header + "." + base64.RawURLEncoding.EncodeToString(claims)
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(payload))
+	return payload + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+const (
+	tokenCacheTTL  = 5 * time.Minute
+	tokenCacheSize = 10000
+)
+
+// cachedVerifier remembers verified tokens until they expire (at most
+// tokenCacheTTL) so repeat requests skip signature checks.
+type cachedVerifier struct {
+	next    TokenVerifier
+	mu      sync.Mutex
+	entries map[string]VerifiedToken
+}
+
+func newCachedVerifier(next TokenVerifier) *cachedVerifier {
+	return &cachedVerifier{next: next, entries: make(map[string]VerifiedToken)}
+}
+
+func (c *cachedVerifier) Verify(ctx context.Context, idToken string) (*VerifiedToken, error) {
+	sum := sha256.Sum256([]byte(idToken))
+	key := hex.EncodeToString(sum[:])
+	now := time.Now()
+
+	c.mu.Lock()
+	if entry, ok := c.entries[key]; ok && now.Before(entry.Expires) {
+		c.mu.Unlock()
+		return &entry, nil
+	}
+	c.mu.Unlock()
+
+	token, err := c.next.Verify(ctx, idToken)
+	if err != nil {
+		return nil, err
+	}
+	entry := *token
+	if limit := now.Add(tokenCacheTTL); entry.Expires.IsZero() || entry.Expires.After(limit) {
+		entry.Expires = limit
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.entries) >= tokenCacheSize {
+		for k, e := range c.entries {
+			if !now.Before(e.Expires) {
+				delete(c.entries, k)
+			}
+		}
+		if len(c.entries) >= tokenCacheSize {
+			c.entries = make(map[string]VerifiedToken)
+		}
+	}
+	c.entries[key] = entry
+	return token, nil
+}
+
+// authenticate verifies the bearer token, if any. It returns "" with no error
+// for anonymous requests.
+func authenticate(r *http.Request) (string, error) {
+	authHeader := r.Header.Get("Authorization")
+	if authHeader == "" {
+		return "", nil
+	}
+	idToken, ok := strings.CutPrefix(authHeader, "Bearer ")
+	if !ok || idToken == "" {
+		return "", errors.New("malformed Authorization header")
+	}
+	token, err := verifier.Verify(r.Context(), idToken)
+	if err != nil {
+		return "", err
+	}
+	return token.UID, nil
+}
+
+// requireAuth only lets requests with a valid ID token through and puts the
+// UID in the request context.
+func requireAuth(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userId, err := authenticate(r)
+		if err != nil {
+			http.Error(w, "Invalid ID token", http.StatusUnauthorized)
+			return
+		}
+		if userId == "" {
+			http.Error(w, "Missing or invalid Authorization header", http.StatusUnauthorized)
+			return
+		}
+		next(w, r.WithContext(context.WithValue(r.Context(), userIDKey, userId)))
+	}
+}
+
+// optionalAuth lets anonymous requests through but rejects bad tokens.
+func optionalAuth(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userId, err := authenticate(r)
+		if err != nil {
+			http.Error(w, "Invalid ID token", http.StatusUnauthorized)
+			return
+		}
+		if userId != "" {
+			r = r.WithContext(context.WithValue(r.Context(), userIDKey, userId))
+		}
+		next(w, r)
+	}
+}
+
+// userIDFrom returns the verified UID put in the context by requireAuth or optionalAuth.
+func userIDFrom(ctx context.Context) string {
+	userId, _ := ctx.Value(userIDKey).(string)
+	return userId
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLocalJWTVerifier(t *testing.T) {
+	secret := []byte("test-secret")
+	v := &LocalJWTVerifier{Secret: secret}
+	valid := SignLocalJWT(secret, "user-1", time.Hour)
+	parts := strings.Split(valid, ".")
+	otherClaims := base64.RawURLEncoding.EncodeToString([]byte(`{"sub":"user-2","exp":9999999999}`))
+	unsigned := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none"}`)) + "." + parts[1] + "."
+
+	token, err := v.Verify(context.Background(), valid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token.UID != "user-1" || time.Until(token.Expires) < 59*time.Minute {
+		t.Errorf("verified %+v", token)
+	}
+
+	rejected := map[string]string{
+		"expired":        SignLocalJWT(secret, "user-1", -time.Minute),
+		"wrong secret":   SignLocalJWT([]byte("other-secret"), "user-1", time.Hour),
+		"swapped claims": parts[0] + "." + otherClaims + "." + parts[2],
+		"no signature":   unsigned,
+		"malformed":      "not-a-jwt",
+	}
+	for name, raw := range rejected {
+		if token, err := v.Verify(context.Background(), raw); err == nil {
+			t.Errorf("%s token accepted as %+v", name, token)
+		}
+	}
+}
+
+// countingVerifier accepts every token until the given expiry and counts
+// how often it was asked.
+type countingVerifier struct {
+	calls   int
+	expires time.Time
+	err     error
+}
+
+func (c *countingVerifier) Verify(ctx context.Context, idToken string) (*VerifiedToken, error) {
+	c.calls++
+	if c.err != nil {
+		return nil, c.err
+	}
+	return &VerifiedToken{UID: "user-1", Expires: c.expires}, nil
+}
+
+func TestCachedVerifierExpiry(t *testing.T) {
+	next := &countingVerifier{expires: time.Now().Add(50 * time.Millisecond)}
+	c := newCachedVerifier(next)
+	for range 3 {
+		if _, err := c.Verify(context.Background(), "token"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if next.calls != 1 {
+		t.Errorf("verified %d times before expiry, want 1", next.calls)
+	}
+	time.Sleep(60 * time.Millisecond)
+	if _, err := c.Verify(context.Background(), "token"); err != nil {
+		t.Fatal(err)
+	}
+	if next.calls != 2 {
+		t.Errorf("expired token was served from the cache")
+	}
+}
+
+func TestCachedVerifierCapsLifetime(t *testing.T) {
+	c := newCachedVerifier(&countingVerifier{expires: time.Now().Add(24 * time.Hour)})
+	if _, err := c.Verify(context.Background(), "token"); err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range c.entries {
+		if time.Until(entry.Expires) > tokenCacheTTL {
+			t.Errorf("cached until %v, past the %v cap", entry.Expires, tokenCacheTTL)
+		}
+	}
+}
+
+func TestCachedVerifierSkipsRejections(t *testing.T) {
+	next := &countingVerifier{err: errInvalidToken}
+	c := newCachedVerifier(next)
+	for range 2 {
+		if _, err := c.Verify(context.Background(), "token"); !errors.Is(err, errInvalidToken) {
+			t.Fatalf("got %v, want errInvalidToken", err)
+		}
+	}
+	if next.calls != 2 || len(c.entries) != 0 {
+		t.Errorf("rejected token was cached")
+	}
+}
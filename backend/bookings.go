@@ -0,0 +1,515 @@
+// backend/bookings.go
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Booking statuses. A booking is quoted from a price offer, held with the
+// supplier, then confirmed; it can be cancelled at any point before it expires.
+// A held or confirmed booking stays cancelling until the supplier has let go.
+const (
+	bookingQuoted     = "quoted"
+	bookingHeld       = "held"
+	bookingConfirming = "confirming"
+	bookingConfirmed  = "confirmed"
+	bookingCancelling = "cancelling"
+	bookingCancelled  = "cancelled"
+	bookingExpired    = "expired"
+)
+
+// bookingTransitions lists the statuses each status may move to.
+var bookingTransitions = map[string][]string{
+	bookingQuoted:     {bookingHeld, bookingCancelled, bookingExpired},
+	bookingHeld:       {bookingConfirming, bookingCancelling, bookingExpired},
+	bookingConfirming: {bookingConfirmed, bookingHeld, bookingExpired},
+	bookingConfirmed:  {bookingCancelling},
+	bookingCancelling: {bookingCancelled},
+}
+
+const (
+	defaultQuoteTTL = 30 * time.Minute
+	defaultHoldTTL  = 15 * time.Minute
+	// supplierConfirmTimeout bounds the supplier call of a confirmation.
+	supplierConfirmTimeout = 30 * time.Second
+	// bookingConfirmTimeout is how long a booking may stay confirming before
+	// the confirmation is taken as lost, say to a restart mid-call. It is
+	// well past supplierConfirmTimeout so a live confirmation always ends first.
+	bookingConfirmTimeout = 2 * time.Minute
+)
+
+// BookingStateError is returned for a transition the state machine does not allow.
+type BookingStateError struct {
+	From, To string
+}
+
+func (e *BookingStateError) Error() string {
+	return fmt.Sprintf("booking is %s and cannot become %s", e.From, e.To)
+}
+
+func canTransition(from, to string) bool {
+	for _, next := range bookingTransitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// setStatus moves b to status and records it in the history.
+func (b *Booking) setStatus(status string, at time.Time) {
+	b.Status = status
+	b.UpdatedAt = at
+	b.History = append(b.History, BookingEvent{Status: status, At: at})
+}
+
+// expireIfDue marks a quote or hold whose time has run out as expired. A
+// confirmation lost past bookingConfirmTimeout goes back to held so it can
+// be tried again, or expires if its hold has run out meanwhile. It reports
+// whether b changed.
+func (b *Booking) expireIfDue(now time.Time) bool {
+	switch b.Status {
+	case bookingQuoted, bookingHeld:
+	case bookingConfirming:
+		if now.Sub(b.UpdatedAt) < bookingConfirmTimeout {
+			return false
+		}
+		if b.ExpiresAt == nil || now.Before(*b.ExpiresAt) {
+			b.setStatus(bookingHeld, now)
+			return true
+		}
+	default:
+		return false
+	}
+	if b.ExpiresAt == nil || now.Before(*b.ExpiresAt) {
+		return false
+	}
+	b.setStatus(bookingExpired, *b.ExpiresAt)
+	return true
+}
+
+// SupplierHold is what a supplier returns when it reserves an offer.
+type SupplierHold struct {
+	Ref       string
+	Price     float64
+	Currency  string
+	ExpiresAt time.Time
+}
+
+var errHoldExpired = errors.New("supplier hold has expired")
+
+// Supplier is the blueprint every booking supplier adapter must follow.
+// Confirm turns a hold into a booking and returns the confirmation reference.
+// Cancel releases a hold or a booking and must be safe to repeat.
+type Supplier interface {
+	Name() string
+	Hold(ctx context.Context, booking *Booking) (*SupplierHold, error)
+	Confirm(ctx context.Context, holdRef string) (string, error)
+	Cancel(ctx context.Context, ref string) error
+}
+
+var supplier Supplier
+
+// initBookings picks a supplier from BOOKING_SUPPLIER; only "simulated" exists so far.
+func initBookings() {
+	holdTTL := defaultHoldTTL
+	if v := os.Getenv("BOOKING_HOLD_TTL"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			log.Fatalf("BOOKING_HOLD_TTL must be a positive duration like 15m")
+		}
+		holdTTL = d
+	}
+	switch name := strings.ToLower(os.Getenv("BOOKING_SUPPLIER")); name {
+	case "", "simulated":
+		supplier = NewSimulatedSupplier(holdTTL)
+	default:
+		log.Fatalf("unknown BOOKING_SUPPLIER %q", name)
+	}
+}
+
+// SimulatedSupplier accepts every hold at the quoted price and keeps its
+// state in memory. It stands in for real suppliers in development.
+type SimulatedSupplier struct {
+	holdTTL   time.Duration
+	mu        sync.Mutex
+	holds     map[string]time.Time
+	confirmed map[string]bool
+}
+
+func NewSimulatedSupplier(holdTTL time.Duration) *SimulatedSupplier {
+	return &SimulatedSupplier{
+		holdTTL:   holdTTL,
+		holds:     make(map[string]time.Time),
+		confirmed: make(map[string]bool),
+	}
+}
+
+func (s *SimulatedSupplier) Name() string {
+	return "simulated"
+}
+
+func (s *SimulatedSupplier) Hold(ctx context.Context, booking *Booking) (*SupplierHold, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ref := "SIM-H-" + strings.ToUpper(uuid.NewString()[:8])
+	expires := time.Now().UTC().Add(s.holdTTL)
+	s.holds[ref] = expires
+	return &SupplierHold{Ref: ref, Price: booking.Price, Currency: booking.Currency, ExpiresAt: expires}, nil
+}
+
+func (s *SimulatedSupplier) Confirm(ctx context.Context, holdRef string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	expires, ok := s.holds[holdRef]
+	if !ok || time.Now().After(expires) {
+		delete(s.holds, holdRef)
+		return "", errHoldExpired
+	}
+	delete(s.holds, holdRef)
+	ref := "SIM-C-" + strings.ToUpper(uuid.NewString()[:8])
+	s.confirmed[ref] = true
+	return ref, nil
+}
+
+func (s *SimulatedSupplier) Cancel(ctx context.Context, ref string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.holds, ref)
+	delete(s.confirmed, ref)
+	return nil
+}
+
+// transitionBooking atomically moves an owned booking to status "to", running
+// fn on it first. Bookings that have run out of time are expired on the way,
+// and the expiry is saved even though the transition then fails.
+func transitionBooking(ctx context.Context, id, userId, to string, fn func(*Booking) error) (*Booking, error) {
+	var lapsed bool
+	updated, err := bookingStore.UpdateBooking(ctx, id, func(b *Booking) error {
+		lapsed = false // fn may run again when a store retries
+		if b.UserID != userId {
+			return errNotOwner
+		}
+		now := time.Now().UTC()
+		if b.expireIfDue(now) && b.Status == bookingExpired {
+			lapsed = to != bookingExpired
+			return nil
+		}
+		if !canTransition(b.Status, to) {
+			return &BookingStateError{From: b.Status, To: to}
+		}
+		if fn != nil {
+			if err := fn(b); err != nil {
+				return err
+			}
+		}
+		b.setStatus(to, now)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if lapsed {
+		return nil, &BookingStateError{From: bookingExpired, To: to}
+	}
+	return updated, nil
+}
+
+// loadOwnedBooking returns the caller's booking, saving the expiry first if it has lapsed.
+func loadOwnedBooking(ctx context.Context, id, userId string) (*Booking, error) {
+	booking, err := bookingStore.GetBooking(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if booking.UserID != userId {
+		return nil, ErrNotFound
+	}
+	if booking.expireIfDue(time.Now().UTC()) {
+		return bookingStore.UpdateBooking(ctx, id, func(b *Booking) error {
+			b.expireIfDue(time.Now().UTC())
+			return nil
+		})
+	}
+	return booking, nil
+}
+
+func writeBookingError(w http.ResponseWriter, err error) {
+	var serr *BookingStateError
+	switch {
+	case errors.Is(err, ErrNotFound), errors.Is(err, errNotOwner):
+		http.Error(w, "Booking not found", http.StatusNotFound)
+	case errors.As(err, &serr), errors.Is(err, errHoldExpired):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		log.Printf("Booking request failed: %v", err)
+		http.Error(w, "Failed to process booking", http.StatusInternalServerError)
+	}
+}
+
+func writeBooking(w http.ResponseWriter, status int, booking *Booking) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(booking)
+}
+
+// findOffer looks an offer up by kind and ID in a fresh quote.
+func findOffer(quote *PriceQuote, kind, offerId string) (description string, price float64, currency string, ok bool) {
+	switch kind {
+	case "flight":
+		for _, f := range quote.Flights {
+			if f.ID == offerId {
+				return f.Airline + " " + f.Flight, f.Price, f.Currency, true
+			}
+		}
+	case "hotel":
+		for _, h := range quote.Hotels {
+			if h.ID == offerId {
+				return h.Name, h.TotalPrice, h.Currency, true
+			}
+		}
+	}
+	return "", 0, "", false
+}
+
+// handleCreateBooking quotes one offer from /api/prices for a saved trip.
+// Body: {"tripId", "kind": "flight"|"hotel", "offerId", "query": PriceQuery}.
+func handleCreateBooking(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var req struct {
+		TripID  string     `json:"tripId"`
+		Kind    string     `json:"kind"`
+		OfferID string     `json:"offerId"`
+		Query   PriceQuery `json:"query"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if req.Kind != "flight" && req.Kind != "hotel" {
+		http.Error(w, `kind must be "flight" or "hotel"`, http.StatusBadRequest)
+		return
+	}
+	if req.TripID == "" || req.OfferID == "" {
+		http.Error(w, "tripId and offerId are required", http.StatusBadRequest)
+		return
+	}
+	if err := req.Query.normalize(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx := r.Context()
+	userId := userIDFrom(ctx)
+	if _, err := loadOwnedTrip(ctx, req.TripID, userId); err != nil {
+		writeTripError(w, err)
+		return
+	}
+
+	// Re-quote so the price comes from the provider, not the client.
+	quote, err := prices.Quote(ctx, req.Query)
+	if err != nil {
+		log.Printf("Price lookup failed for booking: %v", err)
+		http.Error(w, "Failed to load prices", http.StatusBadGateway)
+		return
+	}
+	description, price, currency, ok := findOffer(quote, req.Kind, req.OfferID)
+	if !ok {
+		http.Error(w, "Offer is no longer available", http.StatusConflict)
+		return
+	}
+
+	now := time.Now().UTC()
+	expires := now.Add(defaultQuoteTTL)
+	booking := &Booking{
+		UserID:      userId,
+		TripID:      req.TripID,
+		Kind:        req.Kind,
+		OfferID:     req.OfferID,
+		Description: description,
+		Query:       req.Query,
+		Price:       price,
+		Currency:    currency,
+		Supplier:    supplier.Name(),
+		ExpiresAt:   &expires,
+		CreatedAt:   now,
+	}
+	booking.setStatus(bookingQuoted, now)
+	if err := bookingStore.CreateBooking(ctx, booking); err != nil {
+		writeBookingError(w, err)
+		return
+	}
+	writeBooking(w, http.StatusCreated, booking)
+}
+
+// handleBooking returns one of the caller's bookings.
+func handleBooking(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	booking, err := loadOwnedBooking(r.Context(), r.PathValue("id"), userIDFrom(r.Context()))
+	if err != nil {
+		writeBookingError(w, err)
+		return
+	}
+	writeBooking(w, http.StatusOK, booking)
+}
+
+// handleBookingAction serves POST /api/bookings/{id}/{action} for hold, confirm and cancel.
+func handleBookingAction(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	ctx := r.Context()
+	id, userId := r.PathValue("id"), userIDFrom(ctx)
+	booking, err := loadOwnedBooking(ctx, id, userId)
+	if err != nil {
+		writeBookingError(w, err)
+		return
+	}
+
+	switch r.PathValue("action") {
+	case "hold":
+		booking, err = holdBooking(ctx, booking)
+	case "confirm":
+		booking, err = confirmBooking(ctx, booking)
+	case "cancel":
+		booking, err = cancelBooking(ctx, booking)
+	default:
+		http.Error(w, "Unknown booking action", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		writeBookingError(w, err)
+		return
+	}
+	writeBooking(w, http.StatusOK, booking)
+}
+
+func holdBooking(ctx context.Context, booking *Booking) (*Booking, error) {
+	if !canTransition(booking.Status, bookingHeld) {
+		return nil, &BookingStateError{From: booking.Status, To: bookingHeld}
+	}
+	hold, err := supplier.Hold(ctx, booking)
+	if err != nil {
+		return nil, err
+	}
+	updated, err := transitionBooking(ctx, booking.ID, booking.UserID, bookingHeld, func(b *Booking) error {
+		b.HoldRef = hold.Ref
+		b.Price, b.Currency = hold.Price, hold.Currency
+		b.ExpiresAt = &hold.ExpiresAt
+		return nil
+	})
+	if err != nil {
+		// Someone else moved the booking on; drop the hold we just made.
+		if cerr := supplier.Cancel(context.WithoutCancel(ctx), hold.Ref); cerr != nil {
+			log.Printf("Failed to release supplier hold %s: %v", hold.Ref, cerr)
+		}
+		return nil, err
+	}
+	return updated, nil
+}
+
+// confirmBooking claims the booking as "confirming" before calling the
+// supplier, so two concurrent confirms can never both reach it.
+func confirmBooking(ctx context.Context, booking *Booking) (*Booking, error) {
+	claimed, err := transitionBooking(ctx, booking.ID, booking.UserID, bookingConfirming, nil)
+	if err != nil {
+		return nil, err
+	}
+	confirmCtx, cancel := context.WithTimeout(ctx, supplierConfirmTimeout)
+	ref, err := supplier.Confirm(confirmCtx, claimed.HoldRef)
+	cancel()
+	ctx = context.WithoutCancel(ctx)
+	if errors.Is(err, errHoldExpired) {
+		if _, terr := transitionBooking(ctx, booking.ID, booking.UserID, bookingExpired, nil); terr != nil {
+			log.Printf("Failed to expire booking %s: %v", booking.ID, terr)
+		}
+		return nil, err
+	}
+	if err != nil {
+		if _, terr := transitionBooking(ctx, booking.ID, booking.UserID, bookingHeld, nil); terr != nil {
+			log.Printf("Failed to release booking %s: %v", booking.ID, terr)
+		}
+		return nil, err
+	}
+	return transitionBooking(ctx, booking.ID, booking.UserID, bookingConfirmed, func(b *Booking) error {
+		b.ConfirmationRef = ref
+		b.ExpiresAt = nil
+		return nil
+	})
+}
+
+// cancelBooking claims the booking as "cancelling" before calling the
+// supplier, so a concurrent confirm can no longer move it on. A quote has
+// nothing at the supplier and is cancelled straight away. If the supplier
+// call fails the booking stays cancelling and cancelling again retries it.
+func cancelBooking(ctx context.Context, booking *Booking) (*Booking, error) {
+	claimed := booking
+	if booking.Status != bookingCancelling {
+		to := bookingCancelling
+		if booking.Status == bookingQuoted {
+			to = bookingCancelled
+		}
+		var err error
+		claimed, err = transitionBooking(ctx, booking.ID, booking.UserID, to, func(b *Booking) error {
+			b.ExpiresAt = nil
+			return nil
+		})
+		if err != nil || claimed.Status == bookingCancelled {
+			return claimed, err
+		}
+	}
+	ref := claimed.ConfirmationRef
+	if ref == "" {
+		ref = claimed.HoldRef
+	}
+	if err := supplier.Cancel(ctx, ref); err != nil {
+		return nil, err
+	}
+	return transitionBooking(context.WithoutCancel(ctx), booking.ID, booking.UserID, bookingCancelled, nil)
+}
+
+// handleTripBookings lists the bookings made for one of the caller's trips.
+func handleTripBookings(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	ctx := r.Context()
+	tripId, userId := r.PathValue("id"), userIDFrom(ctx)
+	if _, err := loadOwnedTrip(ctx, tripId, userId); err != nil {
+		writeTripError(w, err)
+		return
+	}
+	bookings, err := bookingStore.ListTripBookings(ctx, tripId)
+	if err != nil {
+		writeBookingError(w, err)
+		return
+	}
+	now := time.Now().UTC()
+	for i := range bookings {
+		bookings[i].expireIfDue(now)
+	}
+	if bookings == nil {
+		bookings = []Booking{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"bookings": bookings})
+}
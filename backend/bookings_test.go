@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// newTestBooking stores a booking of user-1 in the given status, last
+// changed at updated and running out at expires.
+func newTestBooking(t *testing.T, status string, updated, expires time.Time) *Booking {
+	t.Helper()
+	useMemoryStore(t)
+	booking := &Booking{
+		UserID: "user-1", TripID: "trip-1", Status: status, Kind: "hotel", OfferID: "offer-1",
+		ExpiresAt: &expires, CreatedAt: updated, UpdatedAt: updated,
+		History: []BookingEvent{{Status: status, At: updated}},
+	}
+	if err := bookingStore.CreateBooking(context.Background(), booking); err != nil {
+		t.Fatal(err)
+	}
+	return booking
+}
+
+func TestTransitionBookingSavesExpiry(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now().UTC()
+	booking := newTestBooking(t, bookingHeld, now.Add(-time.Hour), now.Add(-time.Minute))
+
+	_, err := transitionBooking(ctx, booking.ID, "user-1", bookingConfirming, nil)
+	var serr *BookingStateError
+	if !errors.As(err, &serr) || serr.From != bookingExpired {
+		t.Fatalf("got %v, want a BookingStateError from expired", err)
+	}
+	stored, err := bookingStore.GetBooking(ctx, booking.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Status != bookingExpired {
+		t.Errorf("stored status %q, want expired", stored.Status)
+	}
+
+	// Expiring an already lapsed hold is not an error.
+	booking = newTestBooking(t, bookingHeld, now.Add(-time.Hour), now.Add(-time.Minute))
+	expired, err := transitionBooking(ctx, booking.ID, "user-1", bookingExpired, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expired.Status != bookingExpired || len(expired.History) != 2 {
+		t.Errorf("expired booking has status %q, history %+v", expired.Status, expired.History)
+	}
+}
+
+func TestLostConfirmationIsReleased(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now().UTC()
+	tests := []struct {
+		name    string
+		updated time.Time
+		expires time.Time
+		want    string
+	}{
+		{"in flight", now.Add(-time.Second), now.Add(time.Hour), bookingConfirming},
+		{"lost with hold left", now.Add(-bookingConfirmTimeout), now.Add(time.Hour), bookingHeld},
+		{"lost past its hold", now.Add(-time.Hour), now.Add(-time.Minute), bookingExpired},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			booking := newTestBooking(t, bookingConfirming, tt.updated, tt.expires)
+			loaded, err := loadOwnedBooking(ctx, booking.ID, "user-1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			stored, err := bookingStore.GetBooking(ctx, booking.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if loaded.Status != tt.want || stored.Status != tt.want {
+				t.Errorf("loaded %q, stored %q, want %q", loaded.Status, stored.Status, tt.want)
+			}
+		})
+	}
+
+	// A released confirmation can be tried again.
+	booking := newTestBooking(t, bookingConfirming, now.Add(-bookingConfirmTimeout), now.Add(time.Hour))
+	if _, err := transitionBooking(ctx, booking.ID, "user-1", bookingConfirming, nil); err != nil {
+		t.Errorf("confirming again: %v", err)
+	}
+}
+
+// flakySupplier fails cancellations while cancelErr is set.
+type flakySupplier struct {
+	*SimulatedSupplier
+	cancelErr error
+	cancels   []string
+}
+
+func (f *flakySupplier) Cancel(ctx context.Context, ref string) error {
+	f.cancels = append(f.cancels, ref)
+	if f.cancelErr != nil {
+		return f.cancelErr
+	}
+	return f.SimulatedSupplier.Cancel(ctx, ref)
+}
+
+func TestCancelBookingClaimsBeforeTheSupplier(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now().UTC()
+	flaky := &flakySupplier{SimulatedSupplier: NewSimulatedSupplier(defaultHoldTTL), cancelErr: errors.New("supplier down")}
+	setGlobal[Supplier](t, &supplier, flaky)
+	booking := newTestBooking(t, bookingHeld, now, now.Add(time.Hour))
+	if _, err := bookingStore.UpdateBooking(ctx, booking.ID, func(b *Booking) error {
+		b.HoldRef = "SIM-H-1"
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	booking, _ = bookingStore.GetBooking(ctx, booking.ID)
+
+	// The supplier fails, but the booking is already out of reach of a confirm.
+	if _, err := cancelBooking(ctx, booking); err == nil {
+		t.Fatal("cancel succeeded while the supplier was down")
+	}
+	stored, _ := bookingStore.GetBooking(ctx, booking.ID)
+	if stored.Status != bookingCancelling {
+		t.Fatalf("status after a failed supplier cancel is %q, want cancelling", stored.Status)
+	}
+	var serr *BookingStateError
+	if _, err := confirmBooking(ctx, stored); !errors.As(err, &serr) {
+		t.Errorf("confirm during a cancellation: got %v, want a BookingStateError", err)
+	}
+
+	// Cancelling again retries the supplier and finishes the job.
+	flaky.cancelErr = nil
+	cancelled, err := cancelBooking(ctx, stored)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cancelled.Status != bookingCancelled || len(flaky.cancels) != 2 || flaky.cancels[1] != "SIM-H-1" {
+		t.Errorf("status %q after supplier cancels %v", cancelled.Status, flaky.cancels)
+	}
+
+	// A quote has nothing at the supplier.
+	quote := newTestBooking(t, bookingQuoted, now, now.Add(time.Hour))
+	if cancelled, err := cancelBooking(ctx, quote); err != nil || cancelled.Status != bookingCancelled {
+		t.Errorf("cancelling a quote: %v, %+v", err, cancelled)
+	}
+	if len(flaky.cancels) != 2 {
+		t.Errorf("supplier was called for a quote")
+	}
+}
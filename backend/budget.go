@@ -0,0 +1,338 @@
+// backend/budget.go
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// This is the blueprint for an amount of money in an ISO 4217 currency.
+type Money struct {
+	Amount   float64 `json:"amount" firestore:"amount"`
+	Currency string  `json:"currency" firestore:"currency"`
+}
+
+func (m Money) validate() error {
+	if m.Amount < 0 || math.IsNaN(m.Amount) || math.IsInf(m.Amount, 0) {
+		return fmt.Errorf("amount %v must be zero or more", m.Amount)
+	}
+	return validateCurrency(m.Currency)
+}
+
+// validateCurrency checks the shape of an ISO 4217 code such as "EUR".
+func validateCurrency(code string) error {
+	if len(code) != 3 || strings.ToUpper(code) != code || strings.Trim(code, "ABCDEFGHIJKLMNOPQRSTUVWXYZ") != "" {
+		return fmt.Errorf("currency %q must be a 3-letter ISO 4217 code like \"EUR\"", code)
+	}
+	return nil
+}
+
+// roundCents rounds to two decimals for display.
+func roundCents(v float64) float64 {
+	return math.Round(v*100) / 100
+}
+
+// RateTable is the blueprint for every source of exchange rates.
+// Rate returns how many units of "to" one unit of "from" buys.
+type RateTable interface {
+	Rate(ctx context.Context, from, to string) (float64, error)
+}
+
+var exchangeRates RateTable
+
+// StaticRateTable serves rates from a JSON file:
+// {"base": "USD", "asOf": "2025-01-01", "rates": {"EUR": 0.92, ...}}.
+type StaticRateTable struct {
+	Base  string             `json:"base"`
+	AsOf  string             `json:"asOf"`
+	Rates map[string]float64 `json:"rates"`
+}
+
+// LoadStaticRateTable reads and checks a rate file.
+func LoadStaticRateTable(path string) (*StaticRateTable, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var table StaticRateTable
+	if err := json.Unmarshal(data, &table); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	if err := validateCurrency(table.Base); err != nil {
+		return nil, fmt.Errorf("%s: base %w", path, err)
+	}
+	if table.Rates == nil {
+		return nil, fmt.Errorf("%s: rates is missing", path)
+	}
+	for code, rate := range table.Rates {
+		if err := validateCurrency(code); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		if rate <= 0 {
+			return nil, fmt.Errorf("%s: rate for %s must be positive", path, code)
+		}
+	}
+	table.Rates[table.Base] = 1
+	return &table, nil
+}
+
+// ErrNoRate is returned when a currency is missing from the rate table.
+var ErrNoRate = errors.New("no exchange rate")
+
+func (t *StaticRateTable) Rate(ctx context.Context, from, to string) (float64, error) {
+	fromRate, ok := t.Rates[from]
+	if !ok {
+		return 0, fmt.Errorf("%w for %s", ErrNoRate, from)
+	}
+	toRate, ok := t.Rates[to]
+	if !ok {
+		return 0, fmt.Errorf("%w for %s", ErrNoRate, to)
+	}
+	return toRate / fromRate, nil
+}
+
+// initRates loads the static rate table from EXCHANGE_RATES_FILE (default rates.json).
+func initRates() {
+	table, err := LoadStaticRateTable(envOr("EXCHANGE_RATES_FILE", "rates.json"))
+	if err != nil {
+		log.Fatalf("error loading exchange rates: %v", err)
+	}
+	exchangeRates = table
+}
+
+// convert expresses m in currency "to".
+func convert(ctx context.Context, m Money, to string) (float64, error) {
+	if m.Currency == to {
+		return m.Amount, nil
+	}
+	rate, err := exchangeRates.Rate(ctx, m.Currency, to)
+	if err != nil {
+		return 0, err
+	}
+	return m.Amount * rate, nil
+}
+
+// activitiesCost adds up the activity costs of an itinerary in currency "to".
+// It returns a problem for every activity without a usable cost.
+func activitiesCost(ctx context.Context, it *Itinerary, to string) (float64, []string) {
+	var total float64
+	var problems []string
+	for _, day := range it.Itinerary {
+		for j, act := range day.Activities {
+			where := fmt.Sprintf("day %d activity %d", day.Day, j+1)
+			if act.Cost == (Money{}) {
+				problems = append(problems, where+": cost is missing")
+				continue
+			}
+			amount, err := convert(ctx, act.Cost, to)
+			if err != nil {
+				problems = append(problems, fmt.Sprintf("%s: %v", where, err))
+				continue
+			}
+			total += amount
+		}
+	}
+	return total, problems
+}
+
+// budgetCheck rejects itineraries whose activities cost more than ceiling.
+func budgetCheck(ctx context.Context, ceiling Money) itineraryCheck {
+	return func(it *Itinerary) []string {
+		total, problems := activitiesCost(ctx, it, ceiling.Currency)
+		if len(problems) > 0 {
+			return problems
+		}
+		if total > ceiling.Amount {
+			return []string{fmt.Sprintf("activities cost %.2f %s in total, over the budget of %.2f %s",
+				total, ceiling.Currency, ceiling.Amount, ceiling.Currency)}
+		}
+		return nil
+	}
+}
+
+// budgetPrompt is appended to the itinerary prompt when the user set a budget ceiling.
+func budgetPrompt(ceiling Money) string {
+	return fmt.Sprintf(`
+BUDGET: the activities must cost at most %.2f %s per person in total. Give every activity a "cost": {"amount": 12.5, "currency": "%s"} with a realistic estimate (0 for free activities).
+`, ceiling.Amount, ceiling.Currency, ceiling.Currency)
+}
+
+// budgetCeiling reads the optional ?budget=&currency= query parameters of the generate endpoints.
+func budgetCeiling(r *http.Request) (*Money, error) {
+	q := r.URL.Query()
+	if q.Get("budget") == "" {
+		return nil, nil
+	}
+	amount, err := strconv.ParseFloat(q.Get("budget"), 64)
+	if err != nil || amount <= 0 {
+		return nil, errors.New("budget must be a positive number")
+	}
+	ceiling := Money{Amount: amount, Currency: strings.ToUpper(q.Get("currency"))}
+	if ceiling.Currency == "" {
+		ceiling.Currency = "USD"
+	}
+	if err := ceiling.validate(); err != nil {
+		return nil, err
+	}
+	if _, err := exchangeRates.Rate(r.Context(), ceiling.Currency, ceiling.Currency); err != nil {
+		return nil, err
+	}
+	return &ceiling, nil
+}
+
+// CostLine is one priced item of a trip, converted to the rollup currency.
+type CostLine struct {
+	Kind        string  `json:"kind"`
+	Description string  `json:"description"`
+	Day         int     `json:"day,omitempty"`
+	Status      string  `json:"status,omitempty"`
+	Original    Money   `json:"original"`
+	Amount      float64 `json:"amount"`
+}
+
+// BudgetRollup adds up everything a trip costs in one currency.
+type BudgetRollup struct {
+	Currency   string     `json:"currency"`
+	Flights    float64    `json:"flights"`
+	Hotels     float64    `json:"hotels"`
+	Activities float64    `json:"activities"`
+	Total      float64    `json:"total"`
+	Budget     *float64   `json:"budget,omitempty"`
+	Remaining  *float64   `json:"remaining,omitempty"`
+	OverBudget bool       `json:"overBudget"`
+	Lines      []CostLine `json:"lines"`
+	Unpriced   []string   `json:"unpriced"`
+}
+
+// rollupTrip prices a trip: held and confirmed bookings plus activity
+// estimates (per person, times travellers).
+func rollupTrip(ctx context.Context, trip *Trip, bookings []Booking, currency string, travellers int) (*BudgetRollup, error) {
+	rollup := &BudgetRollup{Currency: currency, Lines: []CostLine{}, Unpriced: []string{}}
+	add := func(line CostLine) error {
+		amount, err := convert(ctx, line.Original, currency)
+		if err != nil {
+			return err
+		}
+		line.Amount = roundCents(amount)
+		switch line.Kind {
+		case "flight":
+			rollup.Flights += amount
+		case "hotel":
+			rollup.Hotels += amount
+		default:
+			rollup.Activities += amount
+		}
+		rollup.Lines = append(rollup.Lines, line)
+		return nil
+	}
+
+	now := time.Now().UTC()
+	for _, b := range bookings {
+		b.expireIfDue(now)
+		if b.Status != bookingHeld && b.Status != bookingConfirming && b.Status != bookingConfirmed {
+			continue
+		}
+		line := CostLine{Kind: b.Kind, Description: b.Description, Status: b.Status, Original: Money{Amount: b.Price, Currency: b.Currency}}
+		if err := add(line); err != nil {
+			return nil, err
+		}
+	}
+	for _, day := range trip.Itinerary.Itinerary {
+		for _, act := range day.Activities {
+			if act.Cost == (Money{}) {
+				rollup.Unpriced = append(rollup.Unpriced, fmt.Sprintf("day %d: %s", day.Day, act.Description))
+				continue
+			}
+			cost := act.Cost
+			cost.Amount *= float64(travellers)
+			if err := add(CostLine{Kind: "activity", Description: act.Description, Day: day.Day, Original: cost}); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	rollup.Flights, rollup.Hotels, rollup.Activities = roundCents(rollup.Flights), roundCents(rollup.Hotels), roundCents(rollup.Activities)
+	rollup.Total = roundCents(rollup.Flights + rollup.Hotels + rollup.Activities)
+	if trip.Budget != (Money{}) {
+		budget, err := convert(ctx, trip.Budget, currency)
+		if err != nil {
+			return nil, err
+		}
+		budget = roundCents(budget)
+		remaining := roundCents(budget - rollup.Total)
+		rollup.Budget, rollup.Remaining = &budget, &remaining
+		rollup.OverBudget = remaining < 0
+	}
+	return rollup, nil
+}
+
+// handleTripBudget adds up a trip's bookings and activity costs.
+// ?currency= picks the currency; it defaults to the caller's home currency,
+// then the trip budget's currency, then USD. ?travellers= scales activity costs.
+func handleTripBudget(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	ctx := r.Context()
+	userId := userIDFrom(ctx)
+	trip, err := loadOwnedTrip(ctx, r.PathValue("id"), userId)
+	if err != nil {
+		writeTripError(w, err)
+		return
+	}
+	travellers, err := queryInt(r, "travellers", 1)
+	if err != nil || travellers < 1 || travellers > maxTravellers {
+		http.Error(w, fmt.Sprintf("travellers must be between 1 and %d", maxTravellers), http.StatusBadRequest)
+		return
+	}
+
+	currency := strings.ToUpper(r.URL.Query().Get("currency"))
+	if currency == "" {
+		profile, err := profileStore.GetProfile(ctx, userId)
+		if err != nil && !errors.Is(err, ErrNotFound) {
+			log.Printf("Failed to load profile for %s: %v", userId, err)
+		}
+		switch {
+		case profile != nil && profile.HomeCurrency != "":
+			currency = profile.HomeCurrency
+		case trip.Budget.Currency != "":
+			currency = trip.Budget.Currency
+		default:
+			currency = "USD"
+		}
+	}
+	if err := validateCurrency(currency); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	bookings, err := bookingStore.ListTripBookings(ctx, trip.ID)
+	if err != nil {
+		writeBookingError(w, err)
+		return
+	}
+	rollup, err := rollupTrip(ctx, trip, bookings, currency, travellers)
+	if errors.Is(err, ErrNoRate) {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+	if err != nil {
+		log.Printf("Budget rollup failed for %s: %v", trip.ID, err)
+		http.Error(w, "Failed to add up trip costs", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rollup)
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadStaticRateTable(t *testing.T) {
+	tests := []struct {
+		name, file, wants string
+	}{
+		{"valid", `{"base": "USD", "asOf": "2025-01-01", "rates": {"EUR": 0.92}}`, ""},
+		{"no rates", `{"base": "USD", "asOf": "2025-01-01"}`, "rates is missing"},
+		{"null rates", `{"base": "USD", "rates": null}`, "rates is missing"},
+		{"negative rate", `{"base": "USD", "rates": {"EUR": -1}}`, "rate for EUR must be positive"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "rates.json")
+			if err := os.WriteFile(path, []byte(tt.file), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			table, err := LoadStaticRateTable(path)
+			if tt.wants == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				if table.Rates["USD"] != 1 {
+					t.Errorf("base rate = %v, want 1", table.Rates["USD"])
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wants) {
+				t.Errorf("got %v, want an error mentioning %q", err, tt.wants)
+			}
+		})
+	}
+}
@@ -0,0 +1,233 @@
+// backend/card_canvas.go
+
+package main
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+	"math"
+	"strconv"
+	"unicode/utf16"
+
+	"github.com/go-text/typesetting/font"
+	ot "github.com/go-text/typesetting/font/opentype"
+	"golang.org/x/image/vector"
+)
+
+// cardCanvas is a printed card as filled black paths on white, in points
+// from the top left of the page. Text is drawn as glyph outlines, so the
+// exports embed no fonts and look the same in every viewer.
+type cardCanvas struct {
+	width, height float32
+	paths         [][]font.Segment // each filled on its own with the non-zero rule
+}
+
+func cardSegment(op ot.SegmentOp, x, y float32) font.Segment {
+	return font.Segment{Op: op, Args: [3]font.SegmentPoint{{X: x, Y: y}}}
+}
+
+// rect fills the rectangle at x, y of size w by h.
+func (c *cardCanvas) rect(x, y, w, h float32) {
+	c.paths = append(c.paths, []font.Segment{
+		cardSegment(ot.SegmentOpMoveTo, x, y),
+		cardSegment(ot.SegmentOpLineTo, x+w, y),
+		cardSegment(ot.SegmentOpLineTo, x+w, y+h),
+		cardSegment(ot.SegmentOpLineTo, x, y+h),
+	})
+}
+
+// frame draws a border of the given thickness just inside the page edges.
+// The inner contour runs the other way round, which leaves it unfilled.
+func (c *cardCanvas) frame(inset, thickness float32) {
+	x0, y0, x1, y1 := inset, inset, c.width-inset, c.height-inset
+	i0, j0, i1, j1 := x0+thickness, y0+thickness, x1-thickness, y1-thickness
+	c.paths = append(c.paths, []font.Segment{
+		cardSegment(ot.SegmentOpMoveTo, x0, y0),
+		cardSegment(ot.SegmentOpLineTo, x1, y0),
+		cardSegment(ot.SegmentOpLineTo, x1, y1),
+		cardSegment(ot.SegmentOpLineTo, x0, y1),
+		cardSegment(ot.SegmentOpMoveTo, i0, j0),
+		cardSegment(ot.SegmentOpLineTo, i0, j1),
+		cardSegment(ot.SegmentOpLineTo, i1, j1),
+		cardSegment(ot.SegmentOpLineTo, i1, j0),
+	})
+}
+
+// qr draws the dark modules of bitmap (bitmap[y][x]) as a square of the
+// given size, merging each row's runs into one rectangle.
+func (c *cardCanvas) qr(bitmap [][]bool, x, y, size float32) {
+	module := size / float32(len(bitmap))
+	var path []font.Segment
+	for row, bits := range bitmap {
+		top, bottom := y+float32(row)*module, y+float32(row+1)*module
+		for col := 0; col < len(bits); {
+			if !bits[col] {
+				col++
+				continue
+			}
+			start := col
+			for col < len(bits) && bits[col] {
+				col++
+			}
+			left, right := x+float32(start)*module, x+float32(col)*module
+			path = append(path,
+				cardSegment(ot.SegmentOpMoveTo, left, top),
+				cardSegment(ot.SegmentOpLineTo, right, top),
+				cardSegment(ot.SegmentOpLineTo, right, bottom),
+				cardSegment(ot.SegmentOpLineTo, left, bottom))
+		}
+	}
+	c.paths = append(c.paths, path)
+}
+
+// glyph draws glyph gid of face with its origin at x, y. Glyphs without an
+// outline (spaces, bitmap emoji) leave nothing behind.
+func (c *cardCanvas) glyph(face *font.Face, gid font.GID, x, y, size float32) {
+	outline, ok := face.GlyphData(gid).(font.GlyphOutline)
+	if !ok || len(outline.Segments) == 0 {
+		return
+	}
+	scale := size / float32(face.Upem())
+	path := make([]font.Segment, len(outline.Segments))
+	for i, s := range outline.Segments {
+		for j, p := range s.ArgsSlice() {
+			s.Args[j] = font.SegmentPoint{X: x + p.X*scale, Y: y - p.Y*scale} // font units grow up
+		}
+		path[i] = s
+	}
+	c.paths = append(c.paths, path)
+}
+
+// writePDF writes c as a single-page PDF. Title and lang, a BCP-47 tag, go
+// into the document metadata for viewers and screen readers.
+func (c *cardCanvas) writePDF(w io.Writer, title, lang string) error {
+	ops := []byte("0 g\n")
+	point := func(p font.SegmentPoint) {
+		ops = strconv.AppendFloat(ops, float64(p.X), 'f', 2, 32)
+		ops = append(ops, ' ')
+		ops = strconv.AppendFloat(ops, float64(c.height-p.Y), 'f', 2, 32) // PDF y grows up
+		ops = append(ops, ' ')
+	}
+	for _, path := range c.paths {
+		var pen font.SegmentPoint
+		for _, s := range path {
+			switch s.Op {
+			case ot.SegmentOpMoveTo:
+				point(s.Args[0])
+				ops = append(ops, "m\n"...)
+				pen = s.Args[0]
+			case ot.SegmentOpLineTo:
+				point(s.Args[0])
+				ops = append(ops, "l\n"...)
+				pen = s.Args[0]
+			case ot.SegmentOpQuadTo:
+				// PDF only has cubic curves; raise the quadratic's degree.
+				q, end := s.Args[0], s.Args[1]
+				point(font.SegmentPoint{X: pen.X + 2*(q.X-pen.X)/3, Y: pen.Y + 2*(q.Y-pen.Y)/3})
+				point(font.SegmentPoint{X: end.X + 2*(q.X-end.X)/3, Y: end.Y + 2*(q.Y-end.Y)/3})
+				point(end)
+				ops = append(ops, "c\n"...)
+				pen = end
+			case ot.SegmentOpCubeTo:
+				point(s.Args[0])
+				point(s.Args[1])
+				point(s.Args[2])
+				ops = append(ops, "c\n"...)
+				pen = s.Args[2]
+			}
+		}
+		ops = append(ops, "f\n"...)
+	}
+	var content bytes.Buffer
+	zw := zlib.NewWriter(&content)
+	if _, err := zw.Write(ops); err != nil {
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+
+	var out bytes.Buffer
+	var offsets []int
+	object := func(body string) {
+		offsets = append(offsets, out.Len())
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+	out.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+	object(fmt.Sprintf("<< /Type /Catalog /Pages 2 0 R /Lang %s >>", pdfText(lang)))
+	object("<< /Type /Pages /Kids [3 0 R] /Count 1 >>")
+	object(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.2f %.2f] /Resources << >> /Contents 4 0 R >>", c.width, c.height))
+	object(fmt.Sprintf("<< /Length %d /Filter /FlateDecode >>\nstream\n%s\nendstream", content.Len(), content.Bytes()))
+	object(fmt.Sprintf("<< /Title %s /Producer (Auryvia) >>", pdfText(title)))
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root 1 0 R /Info 5 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+	_, err := w.Write(out.Bytes())
+	return err
+}
+
+// pdfText encodes s as a PDF text string, in UTF-16 so any script survives.
+func pdfText(s string) string {
+	buf := []byte("<FEFF")
+	for _, u := range utf16.Encode([]rune(s)) {
+		buf = fmt.Appendf(buf, "%04X", u)
+	}
+	return string(append(buf, '>'))
+}
+
+// writePNG rasterizes c at dpi into a greyscale PNG. Every path gets its
+// own pass over its bounding box, so overlapping glyphs never cancel out.
+func (c *cardCanvas) writePNG(w io.Writer, dpi float32) error {
+	scale := dpi / 72
+	width, height := int(math.Ceil(float64(c.width*scale))), int(math.Ceil(float64(c.height*scale)))
+	ink := image.NewAlpha(image.Rect(0, 0, width, height))
+	var z vector.Rasterizer
+	for _, path := range c.paths {
+		minX, minY := float32(math.Inf(1)), float32(math.Inf(1))
+		maxX, maxY := float32(math.Inf(-1)), float32(math.Inf(-1))
+		for _, s := range path {
+			for _, p := range s.ArgsSlice() {
+				minX, minY, maxX, maxY = min(minX, p.X), min(minY, p.Y), max(maxX, p.X), max(maxY, p.Y)
+			}
+		}
+		r := image.Rect(
+			int(math.Floor(float64(minX*scale))), int(math.Floor(float64(minY*scale))),
+			int(math.Ceil(float64(maxX*scale))), int(math.Ceil(float64(maxY*scale))),
+		).Intersect(ink.Bounds())
+		if r.Empty() {
+			continue
+		}
+		dx, dy := float32(r.Min.X), float32(r.Min.Y)
+		z.Reset(r.Dx(), r.Dy())
+		for i, s := range path {
+			a := s.Args
+			switch s.Op {
+			case ot.SegmentOpMoveTo:
+				if i > 0 {
+					z.ClosePath()
+				}
+				z.MoveTo(a[0].X*scale-dx, a[0].Y*scale-dy)
+			case ot.SegmentOpLineTo:
+				z.LineTo(a[0].X*scale-dx, a[0].Y*scale-dy)
+			case ot.SegmentOpQuadTo:
+				z.QuadTo(a[0].X*scale-dx, a[0].Y*scale-dy, a[1].X*scale-dx, a[1].Y*scale-dy)
+			case ot.SegmentOpCubeTo:
+				z.CubeTo(a[0].X*scale-dx, a[0].Y*scale-dy, a[1].X*scale-dx, a[1].Y*scale-dy, a[2].X*scale-dx, a[2].Y*scale-dy)
+			}
+		}
+		z.ClosePath()
+		z.Draw(ink, r, image.Opaque, image.Point{})
+	}
+	page := image.NewGray(ink.Bounds())
+	for i, a := range ink.Pix {
+		page.Pix[i] = 255 - a
+	}
+	return png.Encode(w, page)
+}
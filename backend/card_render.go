@@ -0,0 +1,482 @@
+// backend/card_render.go
+
+package main
+
+import (
+	"bytes"
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/go-text/typesetting/di"
+	"github.com/go-text/typesetting/font"
+	textlang "github.com/go-text/typesetting/language"
+	"github.com/go-text/typesetting/shaping"
+	"github.com/skip2/go-qrcode"
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/math/fixed"
+)
+
+const (
+	// Printed cards are laid out on A4 portrait, in points.
+	cardPageWidth  = 595.28
+	cardPageHeight = 841.89
+	cardMargin     = 42
+	cardFrameInset = 16
+	cardFrameWidth = 4
+	cardQRSize     = 128
+	cardFooterGap  = 24
+
+	cardTitleSize   = 34
+	cardPhraseSize  = 26
+	cardEnglishSize = 13
+	cardLabelSize   = 18
+	cardURLSize     = 11
+
+	// cardMinScale is how far the type of a long card shrinks to stay on one
+	// page; past it the page grows taller instead.
+	cardMinScale = 0.6
+	// cardPNGDPI is the resolution of PNG exports, enough to print sharply.
+	cardPNGDPI = 150
+)
+
+// cardFont is one font printed cards can be drawn in.
+type cardFont struct {
+	family string
+	file   string
+	font   *font.Font
+}
+
+var (
+	commCardBaseURL = "http://localhost:3000/cards"
+	// cardFonts are tried in order for every character of a card: the Go
+	// font for Latin, Greek and Cyrillic, the fonts found in CARD_FONT_DIR,
+	// then the bundled Noto fonts for CJK, Arabic and Devanagari.
+	cardFonts []cardFont
+)
+
+// bundledCardFonts cover the scripts the Go font lacks, so a default build
+// prints cards in them offline. The CJK font is a subset of the common
+// characters, cut by fonts/subset.go.
+//
+//go:generate go run fonts/subset.go -o fonts/NotoSansCJKjp-Subset.ttf $NOTO_CJK
+//go:embed fonts/*.ttf
+var bundledCardFonts embed.FS
+
+// cardHanHints name the regional font to prefer for the Han characters of a
+// card, as the same characters are drawn differently in Japan, mainland
+// China, Taiwan and Korea.
+var cardHanHints = map[string]string{"Jpan": "JP", "Hans": "SC", "Hant": "TC", "Kore": "KR"}
+
+// initCommCards reads where hosted cards live (CARD_BASE_URL) and loads the
+// fonts of printed cards once, so rendering never touches the network.
+func initCommCards() {
+	commCardBaseURL = strings.TrimRight(envOr("CARD_BASE_URL", commCardBaseURL), "/")
+	face, err := font.ParseTTF(bytes.NewReader(goregular.TTF))
+	if err != nil {
+		log.Fatalf("error parsing the bundled card font: %v", err)
+	}
+	cardFonts = []cardFont{{family: "Go", file: "goregular", font: face.Font}}
+	if dir := os.Getenv("CARD_FONT_DIR"); dir != "" {
+		fonts, err := loadCardFonts(os.DirFS(dir))
+		if err != nil {
+			log.Fatalf("error loading CARD_FONT_DIR: %v", err)
+		}
+		cardFonts = append(cardFonts, fonts...)
+		log.Printf("Loaded %d card fonts from %s", len(fonts), dir)
+	}
+	bundled, err := loadCardFonts(bundledCardFonts)
+	if err != nil {
+		log.Fatalf("error loading the bundled card fonts: %v", err)
+	}
+	cardFonts = append(cardFonts, bundled...)
+}
+
+// commCardURL is where the card with the given ID is hosted.
+func commCardURL(id string) string {
+	return commCardBaseURL + "/" + url.PathEscape(id)
+}
+
+// loadCardFonts parses every font file in fsys, font collections included.
+// Files that don't parse are skipped, so a system font directory works as is.
+func loadCardFonts(fsys fs.FS) ([]cardFont, error) {
+	var fonts []cardFont
+	err := fs.WalkDir(fsys, ".", func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		switch strings.ToLower(filepath.Ext(path)) {
+		case ".ttf", ".otf", ".ttc", ".otc":
+		default:
+			return nil
+		}
+		data, err := fs.ReadFile(fsys, path)
+		if err != nil {
+			return err
+		}
+		faces, err := font.ParseTTC(bytes.NewReader(data))
+		if err != nil {
+			log.Printf("Skipping card font %s: %v", path, err)
+			return nil
+		}
+		for _, face := range faces {
+			fonts = append(fonts, cardFont{family: face.Describe().Family, file: filepath.Base(path), font: face.Font})
+		}
+		return nil
+	})
+	return fonts, err
+}
+
+// matches reports whether f is the regional variant named by hint, like
+// "Noto Sans CJK JP", NotoSansCJKjp-Regular.otf or NotoSansJP-Regular.ttf.
+func (f cardFont) matches(hint string) bool {
+	words := strings.FieldsFunc(f.family+" "+f.file, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	for _, w := range words {
+		if w == hint || strings.HasSuffix(w, hint) || strings.HasSuffix(strings.ToLower(w), "cjk"+strings.ToLower(hint)) {
+			return true
+		}
+	}
+	return false
+}
+
+// CardFontError is returned when a card uses scripts no card font can draw.
+// Boxes in place of letters would be worse than no printout at all.
+type CardFontError struct {
+	Scripts []string
+}
+
+func (e *CardFontError) Error() string {
+	return fmt.Sprintf("no card font covers the %s script", strings.Join(e.Scripts, ", "))
+}
+
+// cardFontmap picks the face of every character of a card. It keeps to the
+// face of the previous character while that face covers it, so spaces and
+// punctuation stay in the font of the words around them.
+type cardFontmap struct {
+	faces []*font.Face
+	last  *font.Face
+}
+
+// newCardFontmap builds fresh faces, which aren't safe to share between
+// renders, preferring the regional fonts of script.
+func newCardFontmap(script string) *cardFontmap {
+	fonts := slices.Clone(cardFonts)
+	if hint, ok := cardHanHints[script]; ok {
+		sort.SliceStable(fonts, func(i, j int) bool { return fonts[i].matches(hint) && !fonts[j].matches(hint) })
+	}
+	m := &cardFontmap{}
+	for _, f := range fonts {
+		m.faces = append(m.faces, font.NewFace(f.font))
+	}
+	return m
+}
+
+func (m *cardFontmap) ResolveFace(r rune) *font.Face {
+	if m.last != nil {
+		if _, ok := m.last.NominalGlyph(r); ok {
+			return m.last
+		}
+	}
+	for _, face := range m.faces {
+		if _, ok := face.NominalGlyph(r); ok {
+			m.last = face
+			return face
+		}
+	}
+	return m.faces[0]
+}
+
+// check returns a CardFontError naming the scripts of texts that no face
+// can draw.
+func (m *cardFontmap) check(texts ...string) error {
+	missing := map[string]bool{}
+	for _, text := range texts {
+		for _, r := range text {
+			if unicode.IsSpace(r) || !unicode.IsGraphic(r) || unicode.Is(unicode.Variation_Selector, r) {
+				continue
+			}
+			covered := false
+			for _, face := range m.faces {
+				if _, ok := face.NominalGlyph(r); ok {
+					covered = true
+					break
+				}
+			}
+			if !covered {
+				script := textlang.LookupScript(r).String()
+				missing[strings.ToUpper(script[:1])+script[1:]] = true
+			}
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	scripts := make([]string, 0, len(missing))
+	for s := range missing {
+		scripts = append(scripts, s)
+	}
+	sort.Strings(scripts)
+	return &CardFontError{Scripts: scripts}
+}
+
+// cardTypesetter shapes text with HarfBuzz, which joins Arabic letters and
+// forms Devanagari conjuncts, and breaks it into lines in visual order.
+type cardTypesetter struct {
+	fonts   *cardFontmap
+	shaper  shaping.HarfbuzzShaper
+	seg     shaping.Segmenter
+	wrapper shaping.LineWrapper
+}
+
+// cardParagraph is a paragraph shaped and broken into lines, each line's runs
+// sorted left to right.
+type cardParagraph struct {
+	lines  []shaping.Line
+	size   float32
+	rtl    bool
+	height float32
+}
+
+func cardPoints(v fixed.Int26_6) float32 {
+	return float32(v) / 64
+}
+
+// cardLineBounds is the distance from the top of line to its baseline, and
+// the full height of the line.
+func cardLineBounds(line shaping.Line) (ascent, height float32) {
+	var a, d, gap fixed.Int26_6
+	for _, run := range line {
+		a, d, gap = max(a, run.LineBounds.Ascent), min(d, run.LineBounds.Descent), max(gap, run.LineBounds.Gap)
+	}
+	return cardPoints(a), cardPoints(a - d + gap)
+}
+
+// paragraph shapes text at size, a whole number of points as the shaper
+// rounds up anything else, and wraps it to width.
+func (t *cardTypesetter) paragraph(text string, size, width float32, dir di.Direction, lang textlang.Language) *cardParagraph {
+	p := &cardParagraph{size: size, rtl: dir == di.DirectionRTL}
+	runes := []rune(text)
+	if len(runes) == 0 {
+		return p
+	}
+	t.fonts.last = nil // English under Arabic shouldn't stay in the Arabic font
+	input := shaping.Input{Text: runes, RunEnd: len(runes), Direction: dir, Size: fixed.I(int(size)), Language: lang}
+	var runs []shaping.Output
+	for _, in := range t.seg.Split(input, t.fonts) {
+		runs = append(runs, t.shaper.Shape(in))
+	}
+	lines, _ := t.wrapper.WrapParagraph(shaping.WrapConfig{Direction: dir}, int(width), runes, shaping.NewSliceIterator(runs))
+	for _, line := range lines {
+		line = slices.Clone(line) // the wrapper reuses its lines
+		sort.Slice(line, func(i, j int) bool { return line[i].VisualIndex < line[j].VisualIndex })
+		_, height := cardLineBounds(line)
+		p.lines = append(p.lines, line)
+		p.height += height
+	}
+	return p
+}
+
+// text draws p with the top of its first line at y, aligned to the start
+// of the x..x+width column, and returns the y below its last line.
+func (c *cardCanvas) text(p *cardParagraph, x, y, width float32) float32 {
+	for _, line := range p.lines {
+		ascent, height := cardLineBounds(line)
+		var advance fixed.Int26_6
+		for _, run := range line {
+			advance += run.Advance
+		}
+		pen := x
+		if p.rtl {
+			pen = x + width - cardPoints(advance)
+		}
+		for _, run := range line {
+			for _, g := range run.Glyphs {
+				c.glyph(run.Face, g.GlyphID, pen+cardPoints(g.XOffset), y+ascent-cardPoints(g.YOffset), p.size)
+				pen += cardPoints(g.XAdvance)
+			}
+		}
+		y += height
+	}
+	return y
+}
+
+// cardItem is one block of the body of a printed card.
+type cardItem struct {
+	text    string
+	size    float32 // type size, or thickness for rules
+	english bool    // in English rather than the card's language
+	rule    bool
+	space   float32 // space above
+}
+
+// layoutCommCard draws card for print: the translated title and phrases in
+// large black type on white, each with the traveller's English in small type
+// beneath, and a footer naming the language next to a QR code that links to
+// the hosted card.
+func layoutCommCard(card *CommCard) (*cardCanvas, error) {
+	fonts := newCardFontmap(card.Script)
+	showEnglish := func(text CommCardText) bool {
+		return !strings.EqualFold(strings.TrimSpace(text.English), strings.TrimSpace(text.Translation))
+	}
+
+	items := []cardItem{{text: card.Title.Translation, size: cardTitleSize}}
+	if showEnglish(card.Title) {
+		items = append(items, cardItem{text: card.Title.English, size: cardEnglishSize, english: true, space: 6})
+	}
+	for i, phrase := range card.Phrases {
+		thickness := float32(1)
+		if i == 0 {
+			thickness = 3
+		}
+		items = append(items,
+			cardItem{size: thickness, rule: true, space: 18},
+			cardItem{text: phrase.Translation, size: cardPhraseSize, space: 18})
+		if showEnglish(phrase.CommCardText) {
+			items = append(items, cardItem{text: phrase.English, size: cardEnglishSize, english: true, space: 6})
+		}
+	}
+	texts := []string{card.NativeName, card.LanguageName, card.URL}
+	for _, item := range items {
+		texts = append(texts, item.text)
+	}
+	if err := fonts.check(texts...); err != nil {
+		return nil, err
+	}
+	qr, err := qrcode.New(card.URL, qrcode.Medium)
+	if err != nil {
+		return nil, err
+	}
+	qr.DisableBorder = true
+
+	t := &cardTypesetter{fonts: fonts}
+	dir := di.DirectionLTR
+	if card.Direction == "rtl" {
+		dir = di.DirectionRTL
+	}
+	lang, english := textlang.NewLanguage(card.Language), textlang.NewLanguage("en")
+	width := float32(cardPageWidth - 2*cardMargin)
+
+	// Shrink the type step by step until the body fits above the footer.
+	var paras []*cardParagraph
+	var scale, height float32
+	for scale = 1; ; scale -= 0.1 {
+		paras, height = paras[:0], 0
+		for _, item := range items {
+			height += item.space * scale
+			if item.rule {
+				paras = append(paras, nil)
+				height += item.size
+				continue
+			}
+			size, pdir, plang := float32(math.Round(float64(item.size*scale))), dir, lang
+			if item.english {
+				size, pdir, plang = item.size, di.DirectionLTR, english // already small
+			}
+			p := t.paragraph(item.text, size, width, pdir, plang)
+			paras = append(paras, p)
+			height += p.height
+		}
+		if height <= cardPageHeight-2*cardMargin-cardFooterGap-cardQRSize || scale <= cardMinScale+0.01 {
+			break
+		}
+	}
+
+	c := &cardCanvas{width: cardPageWidth, height: max(cardPageHeight, height+2*cardMargin+cardFooterGap+cardQRSize)}
+	c.frame(cardFrameInset, cardFrameWidth)
+	y := float32(cardMargin)
+	for i, item := range items {
+		y += item.space * scale
+		if item.rule {
+			c.rect(cardMargin, y, width, item.size)
+			y += item.size
+			continue
+		}
+		y = c.text(paras[i], cardMargin, y, width)
+	}
+
+	footer := c.height - cardMargin - cardQRSize
+	c.qr(qr.Bitmap(), c.width-cardMargin-cardQRSize, footer, cardQRSize)
+	column := width - cardQRSize - cardFooterGap
+	y = c.text(t.paragraph(card.NativeName, cardLabelSize, column, di.DirectionLTR, lang), cardMargin, footer, column)
+	if card.LanguageName != card.NativeName {
+		y = c.text(t.paragraph(card.LanguageName, cardURLSize, column, di.DirectionLTR, english), cardMargin, y, column)
+	}
+	y = c.text(t.paragraph("Scan for the digital card:", cardURLSize, column, di.DirectionLTR, english), cardMargin, y+8, column)
+	c.text(t.paragraph(card.URL, cardURLSize, column, di.DirectionLTR, english), cardMargin, y, column)
+	return c, nil
+}
+
+// handleCommCardExport prints a stored card as /pdf or /png, drawn entirely
+// in Go from local fonts. ?download=true asks browsers to save the file
+// rather than show it.
+func handleCommCardExport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	format := r.PathValue("format")
+	if format != "pdf" && format != "png" {
+		http.NotFound(w, r)
+		return
+	}
+	download, err := queryFlag(r, "download")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	card, ok := loadCommCard(w, r)
+	if !ok {
+		return
+	}
+
+	canvas, err := layoutCommCard(card)
+	var ferr *CardFontError
+	if errors.As(err, &ferr) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotImplemented)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"error":   "missing_font",
+			"message": "This server has no font for the card's script yet. Add one, like Noto Sans Thai or Noto Sans Ethiopic, to CARD_FONT_DIR.",
+			"scripts": ferr.Scripts,
+		})
+		return
+	}
+	var buf bytes.Buffer
+	contentType := "application/pdf"
+	if err == nil {
+		if format == "pdf" {
+			err = canvas.writePDF(&buf, card.Title.Translation, card.Language)
+		} else {
+			contentType = "image/png"
+			err = canvas.writePNG(&buf, cardPNGDPI)
+		}
+	}
+	if err != nil {
+		log.Printf("Failed to render communication card %s: %v", card.ID, err)
+		http.Error(w, "Failed to render card", http.StatusInternalServerError)
+		return
+	}
+
+	disposition := "inline"
+	if download {
+		disposition = "attachment"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("%s; filename=%q", disposition, "comm-card-"+card.Language+"."+format))
+	w.Header().Set("Cache-Control", "public, max-age=86400") // stored cards never change
+	w.Write(buf.Bytes())
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"testing"
+)
+
+// The bundled fonts draw the common scripts without CARD_FONT_DIR.
+func TestLayoutCommCardBundledFonts(t *testing.T) {
+	t.Setenv("CARD_FONT_DIR", "")
+	setGlobal(t, &cardFonts, nil)
+	setGlobal(t, &commCardBaseURL, commCardBaseURL)
+	initCommCards()
+	cards := []struct {
+		lang, name, script, dir, title, phrase string
+	}{
+		{"ja", "日本語", "Jpan", "ltr", "お願いがあります", "私は静かな席が必要です。ピーナッツアレルギーがあります。"},
+		{"zh-Hans", "中文", "Hans", "ltr", "我需要帮助", "我需要一个安静的地方。我对花生过敏。"},
+		{"zh-Hant", "中文", "Hant", "ltr", "我需要幫助", "我需要一個安靜的地方。我對花生過敏。"},
+		{"ko", "한국어", "Kore", "ltr", "도와주세요", "조용한 자리가 필요합니다. 땅콩 알레르기가 있습니다."},
+		{"ar", "العربية", "Arab", "rtl", "أحتاج إلى مساعدة", "أحتاج إلى مكان هادئ. لدي حساسية من الفول السوداني."},
+		{"hi", "हिन्दी", "Deva", "ltr", "मुझे मदद चाहिए", "मुझे एक शांत जगह चाहिए। मुझे मूंगफली से एलर्जी है।"},
+	}
+	for _, c := range cards {
+		card := &CommCard{
+			ID: "card-1", Language: c.lang, LanguageName: c.lang, NativeName: c.name, Script: c.script, Direction: c.dir,
+			Title:   CommCardText{English: "I need help", Translation: c.title},
+			Phrases: []CommPhrase{{Need: "quiet", CommCardText: CommCardText{English: "I need a quiet place.", Translation: c.phrase}}},
+			URL:     commCardURL("card-1"),
+		}
+		canvas, err := layoutCommCard(card)
+		if err != nil {
+			t.Errorf("%s: %v", c.lang, err)
+			continue
+		}
+		if err := canvas.writePNG(io.Discard, 72); err != nil {
+			t.Errorf("%s: %v", c.lang, err)
+		}
+	}
+
+	card := &CommCard{
+		ID: "card-2", Language: "th", LanguageName: "Thai", NativeName: "ไทย", Script: "Thai", Direction: "ltr",
+		Title: CommCardText{English: "I need help", Translation: "ฉันต้องการความช่วยเหลือ"}, URL: commCardURL("card-2"),
+	}
+	var fontErr *CardFontError
+	if _, err := layoutCommCard(card); !errors.As(err, &fontErr) {
+		t.Errorf("Thai card without a Thai font: got %v, want a CardFontError", err)
+	}
+}
@@ -0,0 +1,328 @@
+// backend/collections.go
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	maxCollectionTitleLength = 80
+	maxCollectionTrips       = 100
+	defaultCollectionLimit   = 12
+)
+
+// categorySensoryLoad is roughly how intense each activity category is,
+// from 0 (calm) to 100 (loud, bright, crowded).
+var categorySensoryLoad = map[string]int{
+	"relaxation":    15,
+	"accommodation": 20,
+	"nature":        25,
+	"culture":       45,
+	"food":          50,
+	"sightseeing":   55,
+	"transport":     60,
+	"shopping":      70,
+	"adventure":     70,
+	"nightlife":     90,
+}
+
+// categoryLoad is the sensory load of an activity category; unknown ones count as 50.
+func categoryLoad(category string) int {
+	if load, ok := categorySensoryLoad[strings.ToLower(category)]; ok {
+		return load
+	}
+	return 50
+}
+
+// sensoryScore estimates how intense an itinerary is, 0 to 100, as the
+// average load of its activity categories.
+func sensoryScore(it *Itinerary) int {
+	total, n := 0, 0
+	for _, day := range it.Itinerary {
+		for _, act := range day.Activities {
+			total += categoryLoad(act.Category)
+			n++
+		}
+	}
+	if n == 0 {
+		return 0
+	}
+	return int(math.Round(float64(total) / float64(n)))
+}
+
+// sortCollections puts collections in carousel order: position, then title.
+func sortCollections(colls []Collection) {
+	sort.SliceStable(colls, func(i, j int) bool {
+		if colls[i].Position != colls[j].Position {
+			return colls[i].Position < colls[j].Position
+		}
+		return colls[i].Title < colls[j].Title
+	})
+}
+
+// matches reports whether a public trip passes the parts of the rule that
+// the public trip listing can't filter on by itself.
+func (rule *CollectionRule) matches(p *PublicTrip) bool {
+	if rule.MaxDays != nil && p.Days > *rule.MaxDays {
+		return false
+	}
+	if rule.MaxSensoryScore != nil && sensoryScore(&p.Itinerary) > *rule.MaxSensoryScore {
+		return false
+	}
+	return true
+}
+
+func (rule *CollectionRule) validate() error {
+	rule.Text = strings.TrimSpace(rule.Text)
+	if len(rule.Text) > maxSearchLength {
+		return fmt.Errorf("rule.text must be at most %d characters", maxSearchLength)
+	}
+	if s := rule.MaxSensoryScore; s != nil && (*s < 0 || *s > 100) {
+		return errors.New("rule.maxSensoryScore must be between 0 and 100")
+	}
+	if d := rule.MaxDays; d != nil && *d < 1 {
+		return errors.New("rule.maxDays must be at least 1")
+	}
+	return nil
+}
+
+// collectionInput is the editable part of a collection, sent on create and replace.
+type collectionInput struct {
+	Title       string          `json:"title"`
+	Description string          `json:"description"`
+	CoverImage  string          `json:"coverImage"`
+	Position    int             `json:"position"`
+	TripIDs     []string        `json:"tripIds"`
+	Rule        *CollectionRule `json:"rule"`
+}
+
+func (in *collectionInput) validate() error {
+	in.Title = strings.TrimSpace(in.Title)
+	if in.Title == "" {
+		return errors.New("title is required")
+	}
+	if len(in.Title) > maxCollectionTitleLength {
+		return fmt.Errorf("title must be at most %d characters", maxCollectionTitleLength)
+	}
+	if len(in.TripIDs) > maxCollectionTrips {
+		return fmt.Errorf("a collection can list at most %d trips", maxCollectionTrips)
+	}
+	for _, id := range in.TripIDs {
+		if strings.TrimSpace(id) == "" {
+			return errors.New("tripIds must not contain empty IDs")
+		}
+	}
+	if len(in.TripIDs) == 0 && in.Rule == nil {
+		return errors.New("a collection needs tripIds, a rule or both")
+	}
+	if in.Rule != nil {
+		return in.Rule.validate()
+	}
+	return nil
+}
+
+func (in *collectionInput) applyTo(c *Collection) {
+	c.Title, c.Description, c.CoverImage, c.Position = in.Title, strings.TrimSpace(in.Description), strings.TrimSpace(in.CoverImage), in.Position
+	c.TripIDs, c.Rule = in.TripIDs, in.Rule
+}
+
+// decodeCollectionInput reads and checks a collection body, answering 400 on failure.
+func decodeCollectionInput(w http.ResponseWriter, r *http.Request) (*collectionInput, bool) {
+	var in collectionInput
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&in); err != nil {
+		http.Error(w, "Invalid JSON: "+err.Error(), http.StatusBadRequest)
+		return nil, false
+	}
+	if err := in.validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return nil, false
+	}
+	return &in, true
+}
+
+// collectionTrips resolves the members of c: hand-picked trips first, in the
+// order given, then rule matches, newest listing first. Only approved trips count.
+func collectionTrips(ctx context.Context, c *Collection, limit int) ([]PublicTrip, error) {
+	trips := []PublicTrip{}
+	seen := make(map[string]bool)
+	for _, id := range c.TripIDs {
+		if len(trips) == limit {
+			return trips, nil
+		}
+		p, err := publicTripStore.GetPublicTrip(ctx, id)
+		if errors.Is(err, ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if p.ModerationStatus == moderationApproved && !seen[p.ID] {
+			seen[p.ID] = true
+			trips = append(trips, *p)
+		}
+	}
+	if c.Rule == nil {
+		return trips, nil
+	}
+
+	q := PublicTripQuery{Text: c.Rule.Text, Accessibility: c.Rule.Accessibility, Limit: maxDiscoverLimit}
+	for len(trips) < limit {
+		page, err := publicTripStore.ListPublicTrips(ctx, q)
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range page.Trips {
+			if len(trips) < limit && !seen[p.ID] && c.Rule.matches(&p) {
+				seen[p.ID] = true
+				trips = append(trips, p)
+			}
+		}
+		if page.Next == nil {
+			break
+		}
+		q.After = page.Next
+	}
+	return trips, nil
+}
+
+// moderatorOnly answers 401 or 403 and returns false unless the caller is a moderator.
+func moderatorOnly(w http.ResponseWriter, r *http.Request) bool {
+	userId := userIDFrom(r.Context())
+	if userId == "" {
+		http.Error(w, "Missing or invalid Authorization header", http.StatusUnauthorized)
+		return false
+	}
+	if !isModerator(userId) {
+		http.Error(w, "Only moderators can do that", http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// writeCollectionError maps store errors to responses.
+func writeCollectionError(w http.ResponseWriter, err error) {
+	if errors.Is(err, ErrNotFound) {
+		http.Error(w, "Collection not found", http.StatusNotFound)
+		return
+	}
+	log.Printf("Collection store error: %v", err)
+	http.Error(w, "Failed to process collection", http.StatusInternalServerError)
+}
+
+// handleCollections lists the Discover collections in carousel order (GET)
+// or lets a moderator create one (POST).
+func handleCollections(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	switch r.Method {
+	case "GET":
+		colls, err := collectionStore.ListCollections(ctx)
+		if err != nil {
+			writeCollectionError(w, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"collections": colls})
+
+	case "POST":
+		if !moderatorOnly(w, r) {
+			return
+		}
+		in, ok := decodeCollectionInput(w, r)
+		if !ok {
+			return
+		}
+		c := &Collection{}
+		in.applyTo(c)
+		c.CreatedAt = time.Now().UTC()
+		c.UpdatedAt = c.CreatedAt
+		if err := collectionStore.CreateCollection(ctx, c); err != nil {
+			writeCollectionError(w, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(c)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleCollection returns a collection with its trips (GET, ?limit=), or lets
+// a moderator replace (PUT) or delete (DELETE) it.
+func handleCollection(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	id := r.PathValue("id")
+	switch r.Method {
+	case "GET":
+		limit, err := queryInt(r, "limit", defaultCollectionLimit)
+		if err == nil && (limit < 1 || limit > maxDiscoverLimit) {
+			err = fmt.Errorf("limit must be between 1 and %d", maxDiscoverLimit)
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		c, err := collectionStore.GetCollection(ctx, id)
+		if err != nil {
+			writeCollectionError(w, err)
+			return
+		}
+		trips, err := collectionTrips(ctx, c, limit)
+		if err != nil {
+			log.Printf("Failed to resolve collection %s: %v", id, err)
+			http.Error(w, "Failed to load collection trips", http.StatusInternalServerError)
+			return
+		}
+		for i := range trips {
+			trips[i].AuthorID = ""
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"collection": c, "trips": trips})
+
+	case "PUT":
+		if !moderatorOnly(w, r) {
+			return
+		}
+		in, ok := decodeCollectionInput(w, r)
+		if !ok {
+			return
+		}
+		c, err := collectionStore.UpdateCollection(ctx, id, func(c *Collection) error {
+			in.applyTo(c)
+			c.UpdatedAt = time.Now().UTC()
+			return nil
+		})
+		if err != nil {
+			writeCollectionError(w, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(c)
+
+	case "DELETE":
+		if !moderatorOnly(w, r) {
+			return
+		}
+		if err := collectionStore.DeleteCollection(ctx, id); err != nil {
+			writeCollectionError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
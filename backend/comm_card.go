@@ -0,0 +1,441 @@
+// backend/comm_card.go
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+	"unicode"
+
+	"golang.org/x/text/language"
+	"golang.org/x/text/language/display"
+)
+
+const (
+	maxCommNeeds       = 6
+	maxCommNeedLength  = 300
+	maxCommPlaceLength = 200
+	// commScriptShare is the share of a translation's letters that must be in
+	// the target language's script, leaving room for names and brands.
+	commScriptShare = 0.5
+)
+
+// commNeedKinds are the kinds of need a card can state.
+var commNeedKinds = map[string]bool{
+	"dietary":       true,
+	"allergy":       true,
+	"mobility":      true,
+	"medication":    true,
+	"sensory":       true,
+	"communication": true,
+	"other":         true,
+}
+
+// commScripts maps the ISO 15924 scripts we can check to the Unicode scripts
+// their text is written in.
+var commScripts = map[string][]*unicode.RangeTable{
+	"Latn": {unicode.Latin},
+	"Cyrl": {unicode.Cyrillic},
+	"Grek": {unicode.Greek},
+	"Arab": {unicode.Arabic},
+	"Hebr": {unicode.Hebrew},
+	"Deva": {unicode.Devanagari},
+	"Beng": {unicode.Bengali},
+	"Taml": {unicode.Tamil},
+	"Telu": {unicode.Telugu},
+	"Gujr": {unicode.Gujarati},
+	"Guru": {unicode.Gurmukhi},
+	"Thai": {unicode.Thai},
+	"Hans": {unicode.Han},
+	"Hant": {unicode.Han},
+	"Jpan": {unicode.Han, unicode.Hiragana, unicode.Katakana},
+	"Kore": {unicode.Hangul, unicode.Han},
+	"Geor": {unicode.Georgian},
+	"Armn": {unicode.Armenian},
+	"Ethi": {unicode.Ethiopic},
+	"Khmr": {unicode.Khmer},
+	"Mymr": {unicode.Myanmar},
+	"Sinh": {unicode.Sinhala},
+}
+
+// rtlScripts are written right to left.
+var rtlScripts = map[string]bool{"Arab": true, "Hebr": true, "Thaa": true, "Syrc": true, "Nkoo": true}
+
+// CommNeed is one thing the traveller needs staff to know.
+type CommNeed struct {
+	Kind   string `json:"kind"`
+	Detail string `json:"detail"`
+}
+
+// CommCardText is one message of a card: the English wording, the
+// translation staff read, and that translation rendered back into English
+// by a separate request so the traveller can check it.
+type CommCardText struct {
+	English         string `json:"en" firestore:"en"`
+	Translation     string `json:"translation" firestore:"translation"`
+	BackTranslation string `json:"backTranslation" firestore:"backTranslation"`
+}
+
+// CommPhrase is the message for one need of the card.
+type CommPhrase struct {
+	Need string `json:"need" firestore:"need"`
+	CommCardText
+}
+
+// CommCard is a communication card in one target language. Language is the
+// canonical BCP-47 tag of the translation. Every generated card is stored so
+// it can be printed; URL is where it is hosted for the QR code.
+type CommCard struct {
+	ID           string       `json:"id,omitempty" firestore:"-"`
+	UserID       string       `json:"userId,omitempty" firestore:"userId,omitempty"` // empty for anonymous requests
+	Language     string       `json:"language" firestore:"language"`
+	LanguageName string       `json:"languageName" firestore:"languageName"`
+	NativeName   string       `json:"nativeName" firestore:"nativeName"`
+	Script       string       `json:"script" firestore:"script"`       // ISO 15924, like "Jpan" or "Arab"
+	Direction    string       `json:"direction" firestore:"direction"` // "ltr" or "rtl"
+	Place        string       `json:"place,omitempty" firestore:"place,omitempty"`
+	Title        CommCardText `json:"title" firestore:"title"`
+	Phrases      []CommPhrase `json:"phrases" firestore:"phrases"`
+	CreatedAt    time.Time    `json:"createdAt" firestore:"createdAt"`
+	URL          string       `json:"url,omitempty" firestore:"-"`
+}
+
+// CommCardValidationError is returned when the model never produced a usable card.
+type CommCardValidationError struct {
+	Problems []string
+	Attempts int
+}
+
+func (e *CommCardValidationError) Error() string {
+	return fmt.Sprintf("communication card still invalid after %d attempts: %s", e.Attempts, strings.Join(e.Problems, "; "))
+}
+
+// commLanguage parses a BCP-47 tag and describes the card it leads to.
+func commLanguage(tag string) (*CommCard, language.Tag, error) {
+	t, err := language.Parse(strings.TrimSpace(tag))
+	if err != nil {
+		return nil, language.Und, fmt.Errorf("language %q is not a BCP-47 tag like \"ja\" or \"es-MX\"", tag)
+	}
+	if _, conf := t.Base(); conf == language.No {
+		return nil, language.Und, fmt.Errorf("language %q names no known language", tag)
+	}
+	script, _ := t.Script()
+	card := &CommCard{
+		Language:     t.String(),
+		LanguageName: display.English.Tags().Name(t),
+		NativeName:   display.Self.Name(t),
+		Script:       script.String(),
+		Direction:    "ltr",
+	}
+	if rtlScripts[card.Script] {
+		card.Direction = "rtl"
+	}
+	return card, t, nil
+}
+
+// checkScript reports a problem when too little of text is written in script.
+func checkScript(where, text, script string) []string {
+	tables, ok := commScripts[script]
+	if !ok {
+		return nil
+	}
+	letters, inScript := 0, 0
+	for _, r := range text {
+		if !unicode.IsLetter(r) {
+			continue
+		}
+		letters++
+		if unicode.In(r, tables...) {
+			inScript++
+		}
+	}
+	if letters == 0 || float64(inScript) < commScriptShare*float64(letters) {
+		return []string{fmt.Sprintf("%s: translation is not written in the %s script", where, script)}
+	}
+	return nil
+}
+
+func buildCommCardPrompt(card *CommCard, needs []CommNeed) string {
+	var list strings.Builder
+	for i, n := range needs {
+		fmt.Fprintf(&list, "%d. [%s] %s\n", i+1, n.Kind, n.Detail)
+	}
+	place := card.Place
+	if place == "" {
+		place = "any place the traveller visits"
+	}
+	return fmt.Sprintf(`
+You are Auryvia, a compassionate travel AI. Write a communication card a traveller will show to staff.
+Place: %s
+Target language: %s (BCP-47 tag %s), written in the %s script.
+Needs, in order:
+%s
+Write a short card title, then for each need one or two short, polite, unambiguous sentences in English addressed to staff, and the same message in the target language. Use the wording a native speaker would use, not a word-for-word translation, and keep medical terms exact.
+Output JSON: {"title": {"en": "...", "translation": "..."}, "phrases": [{"need": "dietary", "en": "...", "translation": "..."}]}
+Give exactly %d phrases, one per need in the order given, with "need" set to the kind in brackets.
+Example for Japanese: {"title": {"en": "Please read: my needs", "translation": "お読みください：私の必要なこと"}, "phrases": [{"need": "dietary", "en": "I have coeliac disease. My food cannot contain any wheat, barley or rye.", "translation": "私はセリアック病です。小麦、大麦、ライ麦を含まない食事が必要です。"}]}
+`, place, card.LanguageName, card.Language, card.Script, list.String(), len(needs))
+}
+
+// decodeCommCard parses a model answer into card and checks it covers needs in the target script.
+func decodeCommCard(raw string, card *CommCard, needs []CommNeed, t language.Tag) []string {
+	var answer struct {
+		Title   CommCardText `json:"title"`
+		Phrases []CommPhrase `json:"phrases"`
+	}
+	if err := json.Unmarshal([]byte(raw), &answer); err != nil {
+		return []string{"response is not a valid communication card JSON object: " + err.Error()}
+	}
+	base, _ := t.Base()
+	checkText := func(where string, text CommCardText) []string {
+		var problems []string
+		if strings.TrimSpace(text.English) == "" {
+			problems = append(problems, where+": en is empty")
+		}
+		if strings.TrimSpace(text.Translation) == "" {
+			return append(problems, where+": translation is empty")
+		}
+		if base.String() != "en" && strings.EqualFold(strings.TrimSpace(text.English), strings.TrimSpace(text.Translation)) {
+			problems = append(problems, where+": translation is the English text, not "+card.LanguageName)
+		}
+		return append(problems, checkScript(where, text.Translation, card.Script)...)
+	}
+	problems := checkText("title", answer.Title)
+	if len(answer.Phrases) != len(needs) {
+		problems = append(problems, fmt.Sprintf("expected %d phrases, got %d", len(needs), len(answer.Phrases)))
+	}
+	for i, p := range answer.Phrases {
+		where := fmt.Sprintf("phrases[%d]", i)
+		if i < len(needs) && p.Need != needs[i].Kind {
+			problems = append(problems, fmt.Sprintf("%s: need is %q, expected %q", where, p.Need, needs[i].Kind))
+		}
+		problems = append(problems, checkText(where, p.CommCardText)...)
+	}
+	card.Title, card.Phrases = answer.Title, answer.Phrases
+	return problems
+}
+
+func buildBackTranslationPrompt(card *CommCard, texts []string) string {
+	numbered, _ := json.Marshal(texts)
+	return fmt.Sprintf(`
+Translate each of these %s texts into English as literally as possible, so an English speaker can check exactly what a reader will understand. Do not correct, improve or complete them.
+Texts: %s
+Output JSON: {"translations": ["...", "..."]} with exactly %d strings in the same order.
+`, card.LanguageName, numbered, len(texts))
+}
+
+// backTranslate fills in the back-translations of card. The model only sees
+// the translated texts, never the English it was asked to translate.
+func backTranslate(ctx context.Context, card *CommCard, t language.Tag, retries int) error {
+	texts := []*CommCardText{&card.Title}
+	for i := range card.Phrases {
+		texts = append(texts, &card.Phrases[i].CommCardText)
+	}
+	if base, _ := t.Base(); base.String() == "en" {
+		for _, text := range texts {
+			text.BackTranslation = text.Translation
+		}
+		return nil
+	}
+	sources := make([]string, len(texts))
+	for i, text := range texts {
+		sources[i] = text.Translation
+	}
+	var answer struct {
+		Translations []string `json:"translations"`
+	}
+	decode := func(raw string) []string {
+		answer.Translations = nil
+		if err := json.Unmarshal([]byte(raw), &answer); err != nil {
+			return []string{"response is not a valid translations JSON object: " + err.Error()}
+		}
+		if len(answer.Translations) != len(sources) {
+			return []string{fmt.Sprintf("expected %d translations, got %d", len(sources), len(answer.Translations))}
+		}
+		var problems []string
+		for i, s := range answer.Translations {
+			if strings.TrimSpace(s) == "" {
+				problems = append(problems, fmt.Sprintf("translations[%d] is empty", i))
+			}
+		}
+		return problems
+	}
+	if err := generateRepairedJSON(ctx, taskBackTranslate, buildBackTranslationPrompt(card, sources), retries, decode); err != nil {
+		return err
+	}
+	for i, text := range texts {
+		text.BackTranslation = answer.Translations[i]
+	}
+	return nil
+}
+
+// generateRepairedJSON sends prompt and feeds decode's problems back to the
+// model like generateReshuffle does, until decode is happy or the retries run out.
+func generateRepairedJSON(ctx context.Context, task, prompt string, retries int, decode func(raw string) []string) error {
+	raw, err := llm.GenerateJSON(ctx, LLMRequest{Task: task, Prompt: prompt})
+	if err != nil {
+		return err
+	}
+	problems := decode(raw)
+	attempts := 1
+	for ; len(problems) > 0 && attempts <= retries; attempts++ {
+		repair := fmt.Sprintf("%s\nYour previous answer was:\n%s\n\nIt was rejected because of these problems:\n- %s\n\nReturn the corrected JSON object in exactly the same structure.\n",
+			prompt, raw, strings.Join(problems, "\n- "))
+		raw, err = llm.GenerateJSON(ctx, LLMRequest{Task: task, Prompt: repair})
+		if err != nil {
+			return err
+		}
+		problems = decode(raw)
+	}
+	if len(problems) > 0 {
+		return &CommCardValidationError{Problems: problems, Attempts: attempts}
+	}
+	return nil
+}
+
+// generateCommCard writes, translates and back-translates a card.
+func generateCommCard(ctx context.Context, place, tag string, needs []CommNeed) (*CommCard, error) {
+	card, t, err := commLanguage(tag)
+	if err != nil {
+		return nil, err
+	}
+	card.Place = place
+	prompt := buildCommCardPrompt(card, needs)
+	decode := func(raw string) []string { return decodeCommCard(raw, card, needs, t) }
+	if err := generateRepairedJSON(ctx, taskCommCard, prompt, repairRetries(), decode); err != nil {
+		return nil, err
+	}
+	if err := backTranslate(ctx, card, t, repairRetries()); err != nil {
+		return nil, err
+	}
+	return card, nil
+}
+
+// parseCommNeeds checks the needs of a card request. The older single
+// "dietary" field still works as one dietary need.
+func parseCommNeeds(needs []CommNeed, dietary string) ([]CommNeed, error) {
+	if d := strings.TrimSpace(dietary); d != "" {
+		needs = append([]CommNeed{{Kind: "dietary", Detail: d}}, needs...)
+	}
+	if len(needs) == 0 {
+		return nil, errors.New("needs must list at least one need")
+	}
+	if len(needs) > maxCommNeeds {
+		return nil, fmt.Errorf("a card holds at most %d needs", maxCommNeeds)
+	}
+	for i := range needs {
+		n := &needs[i]
+		n.Kind, n.Detail = strings.ToLower(strings.TrimSpace(n.Kind)), strings.TrimSpace(n.Detail)
+		if !commNeedKinds[n.Kind] {
+			return nil, fmt.Errorf("needs[%d]: kind must be one of dietary, allergy, mobility, medication, sensory, communication or other", i)
+		}
+		if n.Detail == "" {
+			return nil, fmt.Errorf("needs[%d]: detail is required", i)
+		}
+		if len(n.Detail) > maxCommNeedLength {
+			return nil, fmt.Errorf("needs[%d]: detail must be at most %d characters", i, maxCommNeedLength)
+		}
+	}
+	return needs, nil
+}
+
+// handleGenerateCommCard writes a communication card for staff in any
+// language. Body: {"place": "...", "language": "es-MX", "needs": [{"kind":
+// "allergy", "detail": "peanuts"}, {"kind": "mobility", "detail": "wheelchair
+// user"}]}. Each phrase comes with its translation and a back-translation;
+// the card is stored and its id and url come back with it.
+func handleGenerateCommCard(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var req struct {
+		Place    string     `json:"place"`
+		Dietary  string     `json:"dietary"`
+		Language string     `json:"language"`
+		Needs    []CommNeed `json:"needs"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	needs, err := parseCommNeeds(req.Needs, req.Dietary)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	req.Place = strings.TrimSpace(req.Place)
+	if len(req.Place) > maxCommPlaceLength {
+		http.Error(w, fmt.Sprintf("place must be at most %d characters", maxCommPlaceLength), http.StatusBadRequest)
+		return
+	}
+	if _, _, err := commLanguage(req.Language); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	card, err := generateCommCard(r.Context(), req.Place, req.Language, needs)
+	var verr *CommCardValidationError
+	if errors.As(err, &verr) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"error":    "invalid_comm_card",
+			"message":  "The AI could not write a usable card in that language, please try again.",
+			"problems": verr.Problems,
+		})
+		return
+	}
+	if err != nil {
+		log.Printf("Communication card failed: %v", err)
+		http.Error(w, "AI error", http.StatusInternalServerError)
+		return
+	}
+	card.UserID, card.CreatedAt = userIDFrom(r.Context()), time.Now().UTC()
+	if err := commCardStore.CreateCommCard(r.Context(), card); err != nil {
+		// The card is still worth showing; it just can't be printed or shared.
+		log.Printf("Failed to save communication card: %v", err)
+	} else {
+		card.URL = commCardURL(card.ID)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(card)
+}
+
+// loadCommCard fetches a stored card for anyone holding its link, without
+// the owner's UID.
+func loadCommCard(w http.ResponseWriter, r *http.Request) (*CommCard, bool) {
+	card, err := commCardStore.GetCommCard(r.Context(), r.PathValue("id"))
+	if errors.Is(err, ErrNotFound) {
+		http.Error(w, "Card not found", http.StatusNotFound)
+		return nil, false
+	}
+	if err != nil {
+		log.Printf("Failed to load communication card: %v", err)
+		http.Error(w, "Failed to load card", http.StatusInternalServerError)
+		return nil, false
+	}
+	card.UserID, card.URL = "", commCardURL(card.ID)
+	return card, true
+}
+
+// handleCommCard returns a stored card. Cards are shared by link, so it
+// needs no sign-in.
+func handleCommCard(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	card, ok := loadCommCard(w, r)
+	if !ok {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(card)
+}
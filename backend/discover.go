@@ -0,0 +1,191 @@
+// backend/discover.go
+
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultDiscoverLimit = 12
+	maxDiscoverLimit     = 50
+	maxSearchLength      = 100
+)
+
+// encode turns a cursor into an opaque token for the nextCursor field.
+func (c PublicTripCursor) encode() string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.FormatInt(c.ListedAt.UnixNano(), 10) + "." + c.ID))
+}
+
+func decodePublicTripCursor(token string) (*PublicTripCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, errors.New("cursor is not valid")
+	}
+	nanos, id, ok := strings.Cut(string(raw), ".")
+	n, err := strconv.ParseInt(nanos, 10, 64)
+	if !ok || err != nil || id == "" {
+		return nil, errors.New("cursor is not valid")
+	}
+	return &PublicTripCursor{ListedAt: time.Unix(0, n).UTC(), ID: id}, nil
+}
+
+// cursorOf points just past p in the listing order.
+func cursorOf(p *PublicTrip) *PublicTripCursor {
+	return &PublicTripCursor{ListedAt: *p.ListedAt, ID: p.ID}
+}
+
+// follows reports whether p comes after the cursor in the listing order.
+func (c *PublicTripCursor) follows(p *PublicTrip) bool {
+	if !p.ListedAt.Equal(c.ListedAt) {
+		return p.ListedAt.Before(c.ListedAt)
+	}
+	return p.ID < c.ID
+}
+
+// matches reports whether a listed trip satisfies the text and flag filters of q.
+func (q PublicTripQuery) matches(p *PublicTrip) bool {
+	if text := strings.ToLower(q.Text); text != "" &&
+		!strings.Contains(strings.ToLower(p.TripTitle), text) &&
+		!strings.Contains(strings.ToLower(p.Destination), text) {
+		return false
+	}
+	want, have := q.Accessibility, p.Accessibility
+	return (!want.Mobility || have.Mobility) && (!want.Sensory || have.Sensory) &&
+		(!want.Dietary || have.Dietary) && (!want.LowEnergy || have.LowEnergy)
+}
+
+// add counts a matching trip in the facets.
+func (f *AccessibilityFacets) add(a TripAccessibility) {
+	f.Total++
+	if a.Mobility {
+		f.Mobility++
+	}
+	if a.Sensory {
+		f.Sensory++
+	}
+	if a.Dietary {
+		f.Dietary++
+	}
+	if a.LowEnergy {
+		f.LowEnergy++
+	}
+}
+
+// publicTripPager builds a page for stores that scan listed trips themselves.
+// Trips must be added in listing order.
+type publicTripPager struct {
+	q    PublicTripQuery
+	page PublicTripPage
+	full bool
+}
+
+func newPublicTripPager(q PublicTripQuery) *publicTripPager {
+	return &publicTripPager{q: q, page: PublicTripPage{Trips: []PublicTrip{}}}
+}
+
+func (pg *publicTripPager) add(p PublicTrip) {
+	if p.ListedAt == nil || !pg.q.matches(&p) {
+		return
+	}
+	pg.page.Facets.add(p.Accessibility)
+	if pg.q.After != nil && !pg.q.After.follows(&p) {
+		return
+	}
+	switch {
+	case len(pg.page.Trips) < pg.q.Limit:
+		pg.page.Trips = append(pg.page.Trips, p)
+	case !pg.full:
+		// One more match exists, so the page ends at the last trip taken.
+		pg.full = true
+		pg.page.Next = cursorOf(&pg.page.Trips[len(pg.page.Trips)-1])
+	}
+}
+
+// queryFlag reads an optional boolean query parameter.
+func queryFlag(r *http.Request, key string) (bool, error) {
+	v := r.URL.Query().Get(key)
+	if v == "" {
+		return false, nil
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, fmt.Errorf("%s must be true or false", key)
+	}
+	return b, nil
+}
+
+// handlePublicTrips lists approved public trips, newest first.
+// Query parameters: q (title or destination text), mobility, sensory, dietary
+// and lowEnergy (true to require the flag), limit and cursor (the nextCursor of
+// the previous page). Facets count every match, not just this page.
+func handlePublicTrips(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	query := r.URL.Query()
+	q := PublicTripQuery{Text: strings.TrimSpace(query.Get("q"))}
+	if len(q.Text) > maxSearchLength {
+		http.Error(w, fmt.Sprintf("q must be at most %d characters", maxSearchLength), http.StatusBadRequest)
+		return
+	}
+	limit, err := queryInt(r, "limit", defaultDiscoverLimit)
+	if err == nil && (limit < 1 || limit > maxDiscoverLimit) {
+		err = fmt.Errorf("limit must be between 1 and %d", maxDiscoverLimit)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	q.Limit = limit
+	for key, flag := range map[string]*bool{
+		"mobility":  &q.Accessibility.Mobility,
+		"sensory":   &q.Accessibility.Sensory,
+		"dietary":   &q.Accessibility.Dietary,
+		"lowEnergy": &q.Accessibility.LowEnergy,
+	} {
+		if *flag, err = queryFlag(r, key); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	if token := query.Get("cursor"); token != "" {
+		if q.After, err = decodePublicTripCursor(token); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	page, err := publicTripStore.ListPublicTrips(r.Context(), q)
+	if err != nil {
+		log.Printf("Failed to list public trips: %v", err)
+		http.Error(w, "Failed to load public trips", http.StatusInternalServerError)
+		return
+	}
+	resp := struct {
+		Trips      []PublicTrip        `json:"trips"`
+		NextCursor string              `json:"nextCursor,omitempty"`
+		Facets     AccessibilityFacets `json:"facets"`
+	}{Trips: page.Trips, Facets: page.Facets}
+	if resp.Trips == nil {
+		resp.Trips = []PublicTrip{}
+	}
+	for i := range resp.Trips {
+		resp.Trips[i].AuthorID = ""
+	}
+	if page.Next != nil {
+		resp.NextCursor = page.Next.encode()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
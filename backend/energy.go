@@ -0,0 +1,335 @@
+// backend/energy.go
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	defaultDailyCapacity = 100
+	// lowEnergyCapacity is the default for travellers who need frequent rests.
+	lowEnergyCapacity = 70
+	minDailyCapacity  = 20
+	maxDailyCapacity  = 300
+
+	// energyReserve is the level, in percent, we plan never to go under.
+	energyReserve = 25
+	// restRecoveryPerMinute is how many effort points a minute of rest gives back.
+	restRecoveryPerMinute = 0.5
+	minRestMinutes        = 15
+	maxRestMinutes        = 90
+	maxCheckInNoteLength  = 200
+)
+
+// categoryEffortPerHour is the effort points an hour of each category costs.
+// Relaxation is negative: it gives energy back. Other categories cost
+// defaultEffortPerHour.
+var categoryEffortPerHour = map[string]float64{
+	"relaxation":    -10,
+	"accommodation": 0,
+	"food":          5,
+	"transport":     8,
+	"culture":       15,
+	"shopping":      18,
+	"sightseeing":   20,
+	"nature":        22,
+	"nightlife":     25,
+	"adventure":     35,
+}
+
+const defaultEffortPerHour = 15
+
+// modeEffortPerMinute is the effort points a minute of travel costs.
+var modeEffortPerMinute = map[string]float64{
+	modeWalk:       0.5,
+	modeWheelchair: 0.6,
+	modeTransit:    0.2,
+	modeDrive:      0.1,
+}
+
+// EnergyPoint is the projected energy level after one activity.
+type EnergyPoint struct {
+	ActivityIndex int    `json:"activityIndex"`
+	Time          string `json:"time"`
+	Effort        int    `json:"effort"` // getting there plus the activity itself
+	Level         int    `json:"level"`  // percent left afterwards
+}
+
+// EnergyDay is the projected energy curve of one day.
+type EnergyDay struct {
+	Day          int            `json:"day"`
+	Effort       int            `json:"effort"`
+	OverCapacity bool           `json:"overCapacity"`
+	LowestLevel  int            `json:"lowestLevel"`
+	Points       []EnergyPoint  `json:"points"`
+	CheckIn      *EnergyCheckIn `json:"checkIn,omitempty"` // the latest one, which the curve starts from
+}
+
+// RestBlock is a proposed break before an activity the traveller would
+// otherwise reach with too little energy.
+type RestBlock struct {
+	Day                 int    `json:"day"`
+	BeforeActivityIndex int    `json:"beforeActivityIndex"`
+	Start               string `json:"start"`
+	Minutes             int    `json:"minutes"`
+	LevelWithout        int    `json:"levelWithout"` // percent left after the activity without the rest
+	LevelWith           int    `json:"levelWith"`
+	Reason              string `json:"reason"`
+}
+
+// dailyCapacity is the traveller's stated capacity, or a default from their mobility.
+func dailyCapacity(profile *Profile) int {
+	switch {
+	case profile != nil && profile.Energy != nil && profile.Energy.DailyCapacity > 0:
+		return profile.Energy.DailyCapacity
+	case profile != nil && profile.Mobility != nil && profile.Mobility.FrequentRests:
+		return lowEnergyCapacity
+	default:
+		return defaultDailyCapacity
+	}
+}
+
+func activityEffort(act Activity) float64 {
+	perHour, ok := categoryEffortPerHour[strings.ToLower(act.Category)]
+	if !ok {
+		perHour = defaultEffortPerHour
+	}
+	return perHour * float64(dwellMinutes(act)) / 60
+}
+
+// projectDay walks a day in order, draining energy for every transfer and
+// activity. A check-in resets the level at the first activity starting at or
+// after its time. With rests, a break is proposed before any activity that
+// would end below energyReserve, and its recovery counts from then on; no
+// break is proposed before the check-in, as that part of the day is over.
+func projectDay(day *Day, legs map[legKey]*Leg, capacity int, checkIn *EnergyCheckIn, withRests bool) (EnergyDay, []RestBlock) {
+	full := float64(capacity)
+	percent := func(points float64) int { return int(math.Round(math.Max(points, 0) / full * 100)) }
+	reserve := full * energyReserve / 100
+
+	result := EnergyDay{Day: day.Day, LowestLevel: 100, Points: []EnergyPoint{}, CheckIn: checkIn}
+	rests := []RestBlock{}
+	var checkInAt time.Time
+	anchored := checkIn == nil
+	if checkIn != nil {
+		var err error
+		if checkInAt, err = parseActivityTime(checkIn.Time); err != nil {
+			anchored = true
+		}
+	}
+
+	remaining, effort := full, 0.0
+	for i, act := range day.Activities {
+		start, timeErr := parseActivityTime(act.Time)
+		if !anchored && timeErr == nil && !start.Before(checkInAt) {
+			remaining, anchored = full*float64(checkIn.Level)/100, true
+		}
+		cost := activityEffort(act)
+		if leg, ok := legs[legKey{day.Day, i - 1}]; ok {
+			cost += float64(leg.Minutes) * modeEffortPerMinute[leg.Mode]
+		}
+		effort += cost
+		after := remaining - cost
+
+		if withRests && anchored && cost > 0 && after < reserve {
+			minutes := int(math.Ceil((reserve-after)/restRecoveryPerMinute/minRestMinutes)) * minRestMinutes
+			minutes = min(max(minutes, minRestMinutes), maxRestMinutes)
+			restore := math.Min(float64(minutes)*restRecoveryPerMinute, full-remaining)
+			rest := RestBlock{
+				Day:                 day.Day,
+				BeforeActivityIndex: i,
+				Minutes:             minutes,
+				LevelWithout:        percent(after),
+				LevelWith:           percent(after + restore),
+				Reason:              fmt.Sprintf("energy would fall to %d%% after this %s", percent(after), strings.ToLower(act.Category)),
+			}
+			if timeErr == nil {
+				rest.Start = start.Add(-time.Duration(minutes) * time.Minute).Format("3:04 PM")
+			}
+			rests = append(rests, rest)
+			after += restore
+		}
+
+		remaining = math.Min(after, full)
+		level := percent(remaining)
+		result.LowestLevel = min(result.LowestLevel, level)
+		result.Points = append(result.Points, EnergyPoint{ActivityIndex: i, Time: act.Time, Effort: int(math.Round(cost)), Level: level})
+	}
+	result.Effort = int(math.Round(effort))
+	result.OverCapacity = effort > full
+	return result, rests
+}
+
+// EnergyReport is the energy projection of a whole trip.
+type EnergyReport struct {
+	Capacity   int         `json:"capacity"`
+	Days       []EnergyDay `json:"days"`
+	RestBlocks []RestBlock `json:"restBlocks"`
+}
+
+// projectEnergy projects every day of trip for the traveller, starting each
+// day from its latest check-in if there is one.
+func projectEnergy(ctx context.Context, trip *Trip, profile *Profile) (*EnergyReport, error) {
+	var mobility *MobilityPrefs
+	if profile != nil {
+		mobility = profile.Mobility
+	}
+	legs, err := routeLegs(ctx, &trip.Itinerary, "", mobility)
+	if err != nil {
+		return nil, err
+	}
+	checkIns, err := energyStore.ListCheckIns(ctx, trip.ID)
+	if err != nil {
+		return nil, err
+	}
+	latest := make(map[int]*EnergyCheckIn)
+	for i := range checkIns {
+		latest[checkIns[i].Day] = &checkIns[i]
+	}
+
+	report := &EnergyReport{Capacity: dailyCapacity(profile), Days: []EnergyDay{}, RestBlocks: []RestBlock{}}
+	for i := range trip.Itinerary.Itinerary {
+		day := &trip.Itinerary.Itinerary[i]
+		planned, _ := projectDay(day, legs, report.Capacity, latest[day.Day], false)
+		_, rests := projectDay(day, legs, report.Capacity, latest[day.Day], true)
+		report.Days = append(report.Days, planned)
+		report.RestBlocks = append(report.RestBlocks, rests...)
+	}
+	return report, nil
+}
+
+// loadEnergyContext loads the caller's trip and profile, answering on failure.
+func loadEnergyContext(w http.ResponseWriter, r *http.Request) (*Trip, *Profile, bool) {
+	ctx := r.Context()
+	userId := userIDFrom(ctx)
+	trip, err := loadOwnedTrip(ctx, r.PathValue("id"), userId)
+	if err != nil {
+		writeTripError(w, err)
+		return nil, nil, false
+	}
+	profile, err := profileStore.GetProfile(ctx, userId)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		log.Printf("Failed to load profile for %s: %v", userId, err)
+		http.Error(w, "Failed to load profile", http.StatusInternalServerError)
+		return nil, nil, false
+	}
+	return trip, profile, true
+}
+
+// handleTripEnergy projects the traveller's energy across every day of a
+// trip, flags days over their daily capacity and proposes rest blocks.
+func handleTripEnergy(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	trip, profile, ok := loadEnergyContext(w, r)
+	if !ok {
+		return
+	}
+	report, err := projectEnergy(r.Context(), trip, profile)
+	if err != nil {
+		log.Printf("Energy projection failed for %s: %v", trip.ID, err)
+		http.Error(w, "Failed to project energy", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
+
+// handleEnergyCheckIns lists a trip's check-ins (GET) or records a new one
+// (POST) and answers with the re-projected day and its rest blocks.
+// POST body: {"day": 2, "time": "2:30 PM", "level": 40, "note": "..."}.
+func handleEnergyCheckIns(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" && r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	ctx := r.Context()
+	trip, profile, ok := loadEnergyContext(w, r)
+	if !ok {
+		return
+	}
+	if r.Method == "GET" {
+		checkIns, err := energyStore.ListCheckIns(ctx, trip.ID)
+		if err != nil {
+			log.Printf("Failed to list check-ins of %s: %v", trip.ID, err)
+			http.Error(w, "Failed to load check-ins", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"checkIns": checkIns})
+		return
+	}
+
+	var req struct {
+		Day   int    `json:"day"`
+		Time  string `json:"time"`
+		Level *int   `json:"level"`
+		Note  string `json:"note"`
+	}
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	var problem string
+	switch {
+	case req.Day < 1 || req.Day > len(trip.Itinerary.Itinerary):
+		problem = fmt.Sprintf("trip has no day %d", req.Day)
+	case req.Level == nil || *req.Level < 0 || *req.Level > 100:
+		problem = "level must be between 0 and 100"
+	case len(strings.TrimSpace(req.Note)) > maxCheckInNoteLength:
+		problem = fmt.Sprintf("note must be at most %d characters", maxCheckInNoteLength)
+	}
+	if _, err := parseActivityTime(req.Time); problem == "" && err != nil {
+		problem = `time must look like "2:30 PM"`
+	}
+	if problem != "" {
+		http.Error(w, problem, http.StatusBadRequest)
+		return
+	}
+	checkIn := EnergyCheckIn{
+		TripID:    trip.ID,
+		Day:       req.Day,
+		Time:      strings.TrimSpace(req.Time),
+		Level:     *req.Level,
+		Note:      strings.TrimSpace(req.Note),
+		CreatedAt: time.Now().UTC(),
+	}
+	if err := energyStore.AddCheckIn(ctx, &checkIn); err != nil {
+		log.Printf("Failed to save check-in for %s: %v", trip.ID, err)
+		http.Error(w, "Failed to save check-in", http.StatusInternalServerError)
+		return
+	}
+
+	report, err := projectEnergy(ctx, trip, profile)
+	if err != nil {
+		log.Printf("Energy projection failed for %s: %v", trip.ID, err)
+		http.Error(w, "Failed to project energy", http.StatusInternalServerError)
+		return
+	}
+	rests := []RestBlock{}
+	for _, rest := range report.RestBlocks {
+		if rest.Day == checkIn.Day {
+			rests = append(rests, rest)
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"checkIn":    checkIn,
+		"day":        report.Days[checkIn.Day-1],
+		"restBlocks": rests,
+	})
+}
@@ -0,0 +1,440 @@
+//go:build ignore
+
+// Subset writes the bundled CJK card font: the regular weight of a Noto Sans
+// CJK font cut down to the kana, the common Hangul syllables and the Han
+// characters of the first levels of GB 2312, Big5 and JIS X 0208, as a
+// TrueType font small enough to embed. Run it through go generate with the
+// path of NotoSansCJKjp-VF.otf from https://github.com/notofonts/noto-cjk:
+//
+//	NOTO_CJK=/path/to/NotoSansCJKjp-VF.otf go generate ./...
+//
+// Only outlines and advances are kept, which is all cards need: CJK text
+// draws one glyph per character, so there is nothing to shape.
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"flag"
+	"log"
+	"math"
+	"os"
+	"slices"
+	"sort"
+
+	"github.com/go-text/typesetting/font"
+	ot "github.com/go-text/typesetting/font/opentype"
+	"github.com/go-text/typesetting/font/opentype/tables"
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/japanese"
+	"golang.org/x/text/encoding/korean"
+	"golang.org/x/text/encoding/simplifiedchinese"
+	"golang.org/x/text/encoding/traditionalchinese"
+)
+
+// cubicTolerance is how far, in font units, the quadratic curves of the
+// subset may stray from the cubic curves of the source.
+const cubicTolerance = 1.0
+
+func main() {
+	out := flag.String("o", "NotoSansCJKjp-Subset.ttf", "output file")
+	weight := flag.Float64("wght", 400, "weight of a variable source font")
+	flag.Parse()
+	if flag.NArg() != 1 {
+		log.Fatal("usage: subset [-o out.ttf] [-wght 400] NotoSansCJKjp-VF.otf")
+	}
+	src, err := os.ReadFile(flag.Arg(0))
+	if err != nil {
+		log.Fatal(err)
+	}
+	ld, err := ot.NewLoader(bytes.NewReader(src))
+	if err != nil {
+		log.Fatal(err)
+	}
+	ft, err := font.NewFont(ld)
+	if err != nil {
+		log.Fatal(err)
+	}
+	face := font.NewFace(ft)
+	if raw, err := ld.RawTable(ot.MustNewTag("fvar")); err == nil {
+		fvar, _, err := tables.ParseFvar(raw)
+		if err != nil {
+			log.Fatal(err)
+		}
+		coords := make([]float32, len(fvar.Axis))
+		for i, axis := range fvar.Axis {
+			coords[i] = axis.Default
+			if axis.Tag == ot.MustNewTag("wght") {
+				coords[i] = float32(*weight)
+			}
+		}
+		face.SetCoords(ft.NormalizeVariations(coords))
+	}
+
+	// Glyph 0 stays .notdef; every other glyph is drawn for one or more runes.
+	glyphs := []font.GID{0}
+	index := map[font.GID]int{0: 0}
+	cmap := map[rune]int{}
+	for _, r := range charset() {
+		gid, ok := face.NominalGlyph(r)
+		if !ok {
+			continue
+		}
+		if _, ok := index[gid]; !ok {
+			index[gid] = len(glyphs)
+			glyphs = append(glyphs, gid)
+		}
+		cmap[r] = index[gid]
+	}
+
+	var b builder
+	b.upem = ft.Upem()
+	for _, gid := range glyphs {
+		b.addGlyph(face, gid)
+	}
+	extents, _ := face.FontHExtents()
+	os2, err := ld.RawTable(ot.MustNewTag("OS/2"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	name, err := ld.RawTable(ot.MustNewTag("name"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	data := b.font(cmap, extents, os2, name)
+	if err := os.WriteFile(*out, data, 0o644); err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("wrote %s: %d characters, %d glyphs, %d bytes", *out, len(cmap), len(glyphs), len(data))
+}
+
+// charset lists the characters of the subset: ASCII, CJK punctuation, kana,
+// full-width forms and the characters of the common levels of the national
+// character sets.
+func charset() []rune {
+	seen := map[rune]bool{}
+	add := func(lo, hi rune) {
+		for r := lo; r <= hi; r++ {
+			seen[r] = true
+		}
+	}
+	add(0x0020, 0x007E) // ASCII, as spaces between Hangul words stay in the font
+	add(0x00A0, 0x00A0)
+	add(0x3000, 0x303F) // CJK symbols and punctuation
+	add(0x3040, 0x30FF) // hiragana and katakana
+	add(0x3131, 0x318E) // Hangul compatibility jamo
+	add(0x31F0, 0x31FF) // katakana phonetic extensions
+	add(0xFF01, 0xFF9F) // full-width and half-width forms
+	decode := func(enc encoding.Encoding, lead0, lead1, trail0, trail1 byte) {
+		dec := enc.NewDecoder()
+		for lead := int(lead0); lead <= int(lead1); lead++ {
+			for trail := int(trail0); trail <= int(trail1); trail++ {
+				s, err := dec.Bytes([]byte{byte(lead), byte(trail)})
+				if err != nil {
+					continue
+				}
+				for _, r := range string(s) {
+					if r != 0xFFFD && r > 0x7F {
+						seen[r] = true
+					}
+				}
+			}
+		}
+	}
+	decode(simplifiedchinese.GBK, 0xA1, 0xA9, 0xA1, 0xFE)   // GB 2312 symbols
+	decode(simplifiedchinese.GBK, 0xB0, 0xD7, 0xA1, 0xFE)   // GB 2312 level 1 hanzi
+	decode(traditionalchinese.Big5, 0xA4, 0xC6, 0x40, 0xFE) // Big5 frequent hanzi
+	decode(japanese.EUCJP, 0xB0, 0xCF, 0xA1, 0xFE)          // JIS X 0208 level 1 kanji
+	decode(korean.EUCKR, 0xB0, 0xC8, 0xA1, 0xFE)            // KS X 1001 Hangul syllables
+	runes := make([]rune, 0, len(seen))
+	for r := range seen {
+		runes = append(runes, r)
+	}
+	slices.Sort(runes)
+	return runes
+}
+
+// builder accumulates the glyf, loca and hmtx tables of the subset.
+type builder struct {
+	upem                   uint16
+	glyf                   []byte
+	loca                   []uint32
+	hmtx                   []byte
+	bbox                   [4]int16 // xMin, yMin, xMax, yMax of all glyphs
+	maxAdvance             uint16
+	minLSB, minRSB, maxExt int16
+	maxPoints, maxContours int
+}
+
+type point struct {
+	x, y    int16
+	onCurve bool
+}
+
+// addGlyph converts gid of face to a TrueType glyph: cubic curves become
+// runs of quadratic ones, and contours are reversed to run clockwise.
+func (b *builder) addGlyph(face *font.Face, gid font.GID) {
+	advance := uint16(math.Round(float64(face.HorizontalAdvance(gid))))
+	b.maxAdvance = max(b.maxAdvance, advance)
+	b.loca = append(b.loca, uint32(len(b.glyf)))
+	outline, _ := face.GlyphData(gid).(font.GlyphOutline)
+
+	var contours [][]point
+	var pen font.SegmentPoint
+	pt := func(p font.SegmentPoint, on bool) point {
+		return point{int16(math.Round(float64(p.X))), int16(math.Round(float64(p.Y))), on}
+	}
+	for _, s := range outline.Segments {
+		switch s.Op {
+		case ot.SegmentOpMoveTo:
+			contours = append(contours, []point{pt(s.Args[0], true)})
+			pen = s.Args[0]
+			continue
+		case ot.SegmentOpLineTo:
+			contours[len(contours)-1] = append(contours[len(contours)-1], pt(s.Args[0], true))
+			pen = s.Args[0]
+		case ot.SegmentOpQuadTo:
+			contours[len(contours)-1] = append(contours[len(contours)-1], pt(s.Args[0], false), pt(s.Args[1], true))
+			pen = s.Args[1]
+		case ot.SegmentOpCubeTo:
+			for _, q := range cubicToQuads(pen, s.Args[0], s.Args[1], s.Args[2]) {
+				contours[len(contours)-1] = append(contours[len(contours)-1], pt(q[0], false), pt(q[1], true))
+			}
+			pen = s.Args[2]
+		}
+	}
+	if len(contours) == 0 {
+		b.hmtx = binary.BigEndian.AppendUint16(b.hmtx, advance)
+		b.hmtx = binary.BigEndian.AppendUint16(b.hmtx, 0)
+		return
+	}
+
+	var flags, xs, ys []byte
+	var endPts []uint16
+	var x, y int16
+	bbox := [4]int16{math.MaxInt16, math.MaxInt16, math.MinInt16, math.MinInt16}
+	n := 0
+	for _, c := range contours {
+		if len(c) > 1 && c[len(c)-1] == c[0] {
+			c = c[:len(c)-1] // contours close by themselves
+		}
+		slices.Reverse(c)
+		for _, p := range c {
+			flag := byte(0)
+			if p.onCurve {
+				flag = 0x01
+			}
+			flag, xs = appendCoord(flag, xs, p.x-x, 0x02, 0x10)
+			flag, ys = appendCoord(flag, ys, p.y-y, 0x04, 0x20)
+			flags = append(flags, flag)
+			x, y = p.x, p.y
+			bbox = [4]int16{min(bbox[0], p.x), min(bbox[1], p.y), max(bbox[2], p.x), max(bbox[3], p.y)}
+		}
+		n += len(c)
+		endPts = append(endPts, uint16(n-1))
+	}
+	g := binary.BigEndian.AppendUint16(nil, uint16(len(endPts)))
+	for _, v := range bbox {
+		g = binary.BigEndian.AppendUint16(g, uint16(v))
+	}
+	for _, e := range endPts {
+		g = binary.BigEndian.AppendUint16(g, e)
+	}
+	g = binary.BigEndian.AppendUint16(g, 0) // no instructions
+	g = append(g, flags...)
+	g = append(g, xs...)
+	g = append(g, ys...)
+	for len(g)%4 != 0 {
+		g = append(g, 0)
+	}
+	b.glyf = append(b.glyf, g...)
+
+	if b.maxContours == 0 {
+		b.bbox = bbox
+		b.minLSB, b.minRSB, b.maxExt = math.MaxInt16, math.MaxInt16, math.MinInt16
+	}
+	b.bbox = [4]int16{min(b.bbox[0], bbox[0]), min(b.bbox[1], bbox[1]), max(b.bbox[2], bbox[2]), max(b.bbox[3], bbox[3])}
+	b.minLSB = min(b.minLSB, bbox[0])
+	b.minRSB = min(b.minRSB, int16(advance)-bbox[2])
+	b.maxExt = max(b.maxExt, bbox[2])
+	b.maxPoints, b.maxContours = max(b.maxPoints, n), max(b.maxContours, len(endPts))
+	b.hmtx = binary.BigEndian.AppendUint16(b.hmtx, advance)
+	b.hmtx = binary.BigEndian.AppendUint16(b.hmtx, uint16(bbox[0]))
+}
+
+// appendCoord appends the coordinate delta d to coords in the shortest
+// encoding, setting the short and same-or-positive bits of flag to match.
+func appendCoord(flag byte, coords []byte, d int16, short, same byte) (byte, []byte) {
+	switch {
+	case d == 0:
+		return flag | same, coords
+	case d > -256 && d < 256:
+		if d > 0 {
+			return flag | short | same, append(coords, byte(d))
+		}
+		return flag | short, append(coords, byte(-d))
+	default:
+		return flag, binary.BigEndian.AppendUint16(coords, uint16(d))
+	}
+}
+
+// font assembles the subset, taking the OS/2 and name tables (with the
+// copyright and license) from the source font.
+func (b *builder) font(cmap map[rune]int, extents font.FontExtents, os2, name []byte) []byte {
+	numGlyphs := uint16(len(b.loca))
+	loca := make([]byte, 0, 4*(len(b.loca)+1))
+	for _, offset := range append(b.loca, uint32(len(b.glyf))) {
+		loca = binary.BigEndian.AppendUint32(loca, offset)
+	}
+	u16 := func(buf []byte, vs ...int) []byte {
+		for _, v := range vs {
+			buf = binary.BigEndian.AppendUint16(buf, uint16(v))
+		}
+		return buf
+	}
+
+	head := u16(nil, 1, 0, 1, 0)    // version 1.0, fontRevision 1.0
+	head = append(head, 0, 0, 0, 0) // checkSumAdjustment, set last
+	head = binary.BigEndian.AppendUint32(head, 0x5F0F3CF5)
+	head = u16(head, 0x000B, int(b.upem))
+	head = append(head, make([]byte, 16)...) // created, modified
+	head = u16(head, int(b.bbox[0]), int(b.bbox[1]), int(b.bbox[2]), int(b.bbox[3]))
+	head = u16(head, 0, 8, 2, 1, 0) // macStyle, lowestRecPPEM, fontDirectionHint, long loca, glyphDataFormat
+
+	hhea := u16(nil, 1, 0,
+		int(math.Round(float64(extents.Ascender))), int(math.Round(float64(extents.Descender))), int(math.Round(float64(extents.LineGap))),
+		int(b.maxAdvance), int(b.minLSB), int(b.minRSB), int(b.maxExt),
+		1, 0, 0, // caret slope rise, run and offset
+		0, 0, 0, 0, 0, // reserved, metricDataFormat
+		int(numGlyphs))
+
+	maxp := u16(nil, 1, 0, int(numGlyphs), b.maxPoints, b.maxContours, 0, 0, 2, 0, 0, 0, 0, 0, 0, 0, 0)
+
+	// A format 12 cmap of consecutive runs, for both Unicode encodings.
+	runes := make([]rune, 0, len(cmap))
+	for r := range cmap {
+		runes = append(runes, r)
+	}
+	sort.Slice(runes, func(i, j int) bool { return runes[i] < runes[j] })
+	var groups []byte
+	nGroups := 0
+	for i := 0; i < len(runes); {
+		j := i + 1
+		for j < len(runes) && runes[j] == runes[j-1]+1 && cmap[runes[j]] == cmap[runes[j-1]]+1 {
+			j++
+		}
+		groups = binary.BigEndian.AppendUint32(groups, uint32(runes[i]))
+		groups = binary.BigEndian.AppendUint32(groups, uint32(runes[j-1]))
+		groups = binary.BigEndian.AppendUint32(groups, uint32(cmap[runes[i]]))
+		nGroups++
+		i = j
+	}
+	sub := u16(nil, 12, 0)
+	sub = binary.BigEndian.AppendUint32(sub, uint32(16+len(groups)))
+	sub = binary.BigEndian.AppendUint32(sub, 0)
+	sub = binary.BigEndian.AppendUint32(sub, uint32(nGroups))
+	sub = append(sub, groups...)
+	cmapTable := u16(nil, 0, 2, 0, 4)
+	cmapTable = binary.BigEndian.AppendUint32(cmapTable, 20)
+	cmapTable = u16(cmapTable, 3, 10)
+	cmapTable = binary.BigEndian.AppendUint32(cmapTable, 20)
+	cmapTable = append(cmapTable, sub...)
+
+	post := u16(nil, 3, 0, 0, 0, -100, 50) // version 3, upright, underline
+	post = append(post, make([]byte, 20)...)
+
+	os2 = slices.Clone(os2)
+	binary.BigEndian.PutUint16(os2[4:], 400) // usWeightClass
+	binary.BigEndian.PutUint16(os2[64:], uint16(min(runes[0], 0xFFFF)))
+	binary.BigEndian.PutUint16(os2[66:], uint16(min(runes[len(runes)-1], 0xFFFF)))
+
+	tablesByTag := map[string][]byte{
+		"OS/2": os2, "cmap": cmapTable, "glyf": b.glyf, "head": head, "hhea": hhea,
+		"hmtx": b.hmtx, "loca": loca, "maxp": maxp, "name": name, "post": post,
+	}
+	tags := make([]string, 0, len(tablesByTag))
+	for tag := range tablesByTag {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+
+	numTables := len(tags)
+	entrySelector := int(math.Floor(math.Log2(float64(numTables))))
+	searchRange := (1 << entrySelector) * 16
+	out := binary.BigEndian.AppendUint32(nil, 0x00010000)
+	out = u16(out, numTables, searchRange, entrySelector, numTables*16-searchRange)
+	offset := len(out) + 16*numTables
+	var body []byte
+	headOffset := 0
+	for _, tag := range tags {
+		data := tablesByTag[tag]
+		if tag == "head" {
+			headOffset = offset
+		}
+		out = append(out, tag...)
+		out = binary.BigEndian.AppendUint32(out, checksum(data))
+		out = binary.BigEndian.AppendUint32(out, uint32(offset))
+		out = binary.BigEndian.AppendUint32(out, uint32(len(data)))
+		body = append(body, data...)
+		for len(body)%4 != 0 {
+			body = append(body, 0)
+		}
+		offset = 12 + 16*numTables + len(body)
+	}
+	out = append(out, body...)
+	binary.BigEndian.PutUint32(out[headOffset+8:], 0xB1B0AFBA-checksum(out))
+	return out
+}
+
+func checksum(data []byte) uint32 {
+	var sum uint32
+	for i := 0; i < len(data); i += 4 {
+		var word [4]byte
+		copy(word[:], data[i:])
+		sum += binary.BigEndian.Uint32(word[:])
+	}
+	return sum
+}
+
+// cubicToQuads splits the cubic curve p0 c1 c2 p3 into as few quadratic
+// curves as keep within cubicTolerance, returned as control and end points.
+func cubicToQuads(p0, c1, c2, p3 font.SegmentPoint) [][2]font.SegmentPoint {
+	// The error of approximating a cubic by one quadratic is bounded by
+	// sqrt(3)/36 |p3 - 3c2 + 3c1 - p0|, which shrinks with the cube of the
+	// number of pieces.
+	dx, dy := p3.X-3*c2.X+3*c1.X-p0.X, p3.Y-3*c2.Y+3*c1.Y-p0.Y
+	bound := math.Sqrt(3) / 36 * math.Hypot(float64(dx), float64(dy))
+	n := max(1, int(math.Ceil(math.Cbrt(bound/cubicTolerance))))
+
+	quads := make([][2]font.SegmentPoint, n)
+	for i := range quads {
+		s0, s1, s2, s3 := segment(p0, c1, c2, p3, float32(i)/float32(n), float32(i+1)/float32(n))
+		// The midpoint of the two cubic control points raised to degree two.
+		q := font.SegmentPoint{X: (3*(s1.X+s2.X) - s0.X - s3.X) / 4, Y: (3*(s1.Y+s2.Y) - s0.Y - s3.Y) / 4}
+		quads[i] = [2]font.SegmentPoint{q, s3}
+	}
+	quads[n-1][1] = p3 // exactly, so the contour stays closed
+	return quads
+}
+
+// segment returns the control points of the part of cubic p0 c1 c2 p3
+// between t0 and t1.
+func segment(p0, c1, c2, p3 font.SegmentPoint, t0, t1 float32) (font.SegmentPoint, font.SegmentPoint, font.SegmentPoint, font.SegmentPoint) {
+	eval := func(t float32) font.SegmentPoint {
+		u := 1 - t
+		a, b, c, d := u*u*u, 3*u*u*t, 3*u*t*t, t*t*t
+		return font.SegmentPoint{X: a*p0.X + b*c1.X + c*c2.X + d*p3.X, Y: a*p0.Y + b*c1.Y + c*c2.Y + d*p3.Y}
+	}
+	deriv := func(t float32) font.SegmentPoint {
+		u := 1 - t
+		a, b, c := 3*u*u, 6*u*t, 3*t*t
+		return font.SegmentPoint{
+			X: a*(c1.X-p0.X) + b*(c2.X-c1.X) + c*(p3.X-c2.X),
+			Y: a*(c1.Y-p0.Y) + b*(c2.Y-c1.Y) + c*(p3.Y-c2.Y),
+		}
+	}
+	s0, s3 := eval(t0), eval(t1)
+	d0, d1 := deriv(t0), deriv(t1)
+	k := (t1 - t0) / 3
+	return s0, font.SegmentPoint{X: s0.X + d0.X*k, Y: s0.Y + d0.Y*k}, font.SegmentPoint{X: s3.X - d1.X*k, Y: s3.Y - d1.Y*k}, s3
+}
@@ -0,0 +1,257 @@
+// backend/fork.go
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// How a fork is fitted to the caller's profile.
+const (
+	adaptNone = "none"
+	adaptMark = "mark"
+	adaptSwap = "swap"
+)
+
+// AdaptationIssue is one activity the model found at odds with the traveller's profile.
+type AdaptationIssue struct {
+	Day           int       `json:"day"`
+	ActivityIndex int       `json:"activityIndex"`
+	Reason        string    `json:"reason"`
+	Replacement   *Activity `json:"replacement,omitempty"`
+}
+
+// Adaptation is the model's structured review of a whole itinerary.
+type Adaptation struct {
+	Conflicts []AdaptationIssue `json:"conflicts"`
+}
+
+// AdaptationValidationError is returned when the model never produced a usable review.
+type AdaptationValidationError struct {
+	Problems []string
+	Attempts int
+}
+
+func (e *AdaptationValidationError) Error() string {
+	return fmt.Sprintf("adaptation still invalid after %d attempts: %s", e.Attempts, strings.Join(e.Problems, "; "))
+}
+
+// ForkChange reports what adaptation did to one activity of the fork.
+type ForkChange struct {
+	Day           int       `json:"day"`
+	ActivityIndex int       `json:"activityIndex"`
+	Action        string    `json:"action"` // "marked" or "swapped"
+	Reason        string    `json:"reason"`
+	Original      *Activity `json:"original,omitempty"`
+}
+
+func buildAdaptPrompt(it *Itinerary, constraints string, swap bool) string {
+	itJSON, _ := json.Marshal(it)
+	task := `Do not suggest replacements; leave "replacement" out.`
+	if swap {
+		task = `For each conflict suggest a "replacement" close to the original, at about the same time of day, that respects every constraint.`
+	}
+	return fmt.Sprintf(`
+You are Auryvia, a compassionate travel AI. A traveller is copying another traveller's trip and it has to fit their own needs.
+
+TRAVELLER CONSTRAINTS:
+%s
+Here is the itinerary as JSON: %s
+
+Check every activity against the constraints and list only the ones that conflict with them. %s
+Output JSON: {"conflicts": [{"day": 1, "activityIndex": 0-based index within the day, "reason": "why it conflicts", "replacement": {"time": "9:00 AM", "description": "...", "category": "...", "lat": 0.0, "lng": 0.0}}]}
+Return {"conflicts": []} when everything fits. Times must look like "9:00 AM", categories must be one of: %s, and lat/lng must be real coordinates.
+`, constraints, itJSON, task, categoryList())
+}
+
+// decodeAdaptation parses a model answer and checks every conflict points at
+// a real activity of it. Replacements are only checked when swapping.
+func decodeAdaptation(raw string, it *Itinerary, swap bool) (*Adaptation, []string) {
+	var a Adaptation
+	if err := json.Unmarshal([]byte(raw), &a); err != nil {
+		return nil, []string{"response is not a valid conflicts JSON object: " + err.Error()}
+	}
+	var problems []string
+	seen := make(map[[2]int]bool)
+	for i, c := range a.Conflicts {
+		where := fmt.Sprintf("conflicts[%d]", i)
+		if c.Day < 1 || c.Day > len(it.Itinerary) {
+			problems = append(problems, fmt.Sprintf("%s: day %d is out of range, the trip has %d days", where, c.Day, len(it.Itinerary)))
+			continue
+		}
+		if n := len(it.Itinerary[c.Day-1].Activities); c.ActivityIndex < 0 || c.ActivityIndex >= n {
+			problems = append(problems, fmt.Sprintf("%s: activityIndex %d is out of range, day %d has %d activities", where, c.ActivityIndex, c.Day, n))
+			continue
+		}
+		if key := [2]int{c.Day, c.ActivityIndex}; seen[key] {
+			problems = append(problems, fmt.Sprintf("%s: day %d activity %d is listed twice", where, c.Day, c.ActivityIndex))
+		} else {
+			seen[key] = true
+		}
+		if strings.TrimSpace(c.Reason) == "" {
+			problems = append(problems, where+": reason is empty")
+		}
+		if swap && c.Replacement != nil {
+			problems = append(problems, validateActivity(where+".replacement", *c.Replacement)...)
+		}
+	}
+	return &a, problems
+}
+
+// generateAdaptation asks the model to review it against the constraints and
+// repairs the answer like generateReshuffle does.
+func generateAdaptation(ctx context.Context, it *Itinerary, constraints string, swap bool, retries int) (*Adaptation, error) {
+	prompt := buildAdaptPrompt(it, constraints, swap)
+	raw, err := llm.GenerateJSON(ctx, LLMRequest{Task: taskAdapt, Prompt: prompt})
+	if err != nil {
+		return nil, err
+	}
+	a, problems := decodeAdaptation(raw, it, swap)
+	attempts := 1
+	for ; len(problems) > 0 && attempts <= retries; attempts++ {
+		repair := fmt.Sprintf("%s\nYour previous answer was:\n%s\n\nIt was rejected because of these problems:\n- %s\n\nReturn the corrected JSON object in exactly the same structure.\n",
+			prompt, raw, strings.Join(problems, "\n- "))
+		raw, err = llm.GenerateJSON(ctx, LLMRequest{Task: taskAdapt, Prompt: repair})
+		if err != nil {
+			return nil, err
+		}
+		a, problems = decodeAdaptation(raw, it, swap)
+	}
+	if len(problems) > 0 {
+		return nil, &AdaptationValidationError{Problems: problems, Attempts: attempts}
+	}
+	return a, nil
+}
+
+// applyAdaptation marks every conflicting activity, or swaps it for the
+// replacement when swapping and the model offered one.
+func applyAdaptation(it *Itinerary, a *Adaptation, swap bool) []ForkChange {
+	changes := []ForkChange{}
+	for _, c := range a.Conflicts {
+		act := &it.Itinerary[c.Day-1].Activities[c.ActivityIndex]
+		change := ForkChange{Day: c.Day, ActivityIndex: c.ActivityIndex, Action: "marked", Reason: c.Reason}
+		if swap && c.Replacement != nil {
+			original := *act
+			*act = *c.Replacement
+			act.Conflict = ""
+			change.Action, change.Original = "swapped", &original
+		} else {
+			act.Conflict = c.Reason
+		}
+		changes = append(changes, change)
+	}
+	return changes
+}
+
+// handleForkPublicTrip copies an approved public trip into the caller's trips,
+// crediting the original.
+// Body (optional): {"adapt": "none"|"mark"|"swap"}. "mark" flags activities
+// that clash with the caller's profile; "swap" replaces them where the model
+// has a better fit and flags the rest.
+func handleForkPublicTrip(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var req struct {
+		Adapt string `json:"adapt"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+	}
+	switch req.Adapt {
+	case "":
+		req.Adapt = adaptNone
+	case adaptNone, adaptMark, adaptSwap:
+	default:
+		http.Error(w, `adapt must be "none", "mark" or "swap"`, http.StatusBadRequest)
+		return
+	}
+
+	ctx := r.Context()
+	userId := userIDFrom(ctx)
+	public, err := publicTripStore.GetPublicTrip(ctx, r.PathValue("id"))
+	if err == nil && public.ModerationStatus != moderationApproved {
+		err = ErrNotFound
+	}
+	if err != nil {
+		writeTripError(w, err)
+		return
+	}
+	profile, err := profileStore.GetProfile(ctx, userId)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		log.Printf("Failed to load profile for %s: %v", userId, err)
+		http.Error(w, "Failed to load profile", http.StatusInternalServerError)
+		return
+	}
+
+	trip := &Trip{
+		UserID:        userId,
+		Accessibility: profileAccessibility(profile),
+		ForkedFrom: &TripAttribution{
+			PublicTripID: public.ID,
+			TripTitle:    public.TripTitle,
+			AuthorName:   public.UserName,
+			ForkedAt:     time.Now().UTC(),
+		},
+	}
+	cloneJSON(&trip.Itinerary, public.Itinerary)
+	// Marks left by the author's own adaptation were about someone else's needs.
+	for i := range trip.Itinerary.Itinerary {
+		for j := range trip.Itinerary.Itinerary[i].Activities {
+			trip.Itinerary.Itinerary[i].Activities[j].Conflict = ""
+		}
+	}
+
+	changes := []ForkChange{}
+	if req.Adapt != adaptNone {
+		constraints := buildConstraints(profile)
+		if constraints == "" {
+			http.Error(w, "Set up your accessibility profile before adapting a trip", http.StatusBadRequest)
+			return
+		}
+		swap := req.Adapt == adaptSwap
+		adaptation, err := generateAdaptation(ctx, &trip.Itinerary, constraints, swap, repairRetries())
+		var verr *AdaptationValidationError
+		if errors.As(err, &verr) {
+			log.Printf("Adaptation rejected: %v", verr)
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"error":    "invalid_adaptation",
+				"message":  "The AI could not check this trip against your profile, please try again.",
+				"problems": verr.Problems,
+				"attempts": verr.Attempts,
+			})
+			return
+		}
+		if err != nil {
+			http.Error(w, "The AI Brain is thinking too hard, try again!", http.StatusInternalServerError)
+			return
+		}
+		changes = applyAdaptation(&trip.Itinerary, adaptation, swap)
+	}
+
+	if err := tripStore.CreateTrip(ctx, trip); err != nil {
+		log.Printf("Failed to save fork of %s: %v", public.ID, err)
+		http.Error(w, "Failed to save trip", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", fmt.Sprintf(`"%d"`, trip.Version))
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"trip":    trip,
+		"changes": changes,
+	})
+}
@@ -0,0 +1,130 @@
+// backend/idempotency.go
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+)
+
+const (
+	idempotencyHeader       = "Idempotency-Key"
+	maxIdempotencyKeyLength = 255
+	maxIdempotentBody       = 1 << 20
+)
+
+// responseRecorder copies everything a handler writes so it can be replayed later.
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (rr *responseRecorder) WriteHeader(status int) {
+	if rr.status == 0 {
+		rr.status = status
+	}
+	rr.ResponseWriter.WriteHeader(status)
+}
+
+func (rr *responseRecorder) Write(b []byte) (int, error) {
+	if rr.status == 0 {
+		rr.status = http.StatusOK
+	}
+	rr.body.Write(b)
+	return rr.ResponseWriter.Write(b)
+}
+
+// requireIdempotency makes a POST safe to retry. The first request with a
+// given Idempotency-Key runs normally and its response is stored; retries get
+// the stored response back without running the handler again. Keys are scoped
+// to the caller, so it must run inside requireAuth. Server errors and panics
+// release the key so the client can try again.
+func requireIdempotency(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			next(w, r)
+			return
+		}
+		key := strings.TrimSpace(r.Header.Get(idempotencyHeader))
+		if key == "" {
+			http.Error(w, "Idempotency-Key header is required", http.StatusBadRequest)
+			return
+		}
+		if len(key) > maxIdempotencyKeyLength {
+			http.Error(w, "Idempotency-Key is too long", http.StatusBadRequest)
+			return
+		}
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxIdempotentBody))
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			http.Error(w, fmt.Sprintf("request body must be at most %d MB", maxIdempotentBody>>20), http.StatusRequestEntityTooLarge)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Can't read request body", http.StatusBadRequest)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		sum := sha256.Sum256([]byte(r.Method + " " + r.URL.Path + "\n" + string(body)))
+		fingerprint := hex.EncodeToString(sum[:])
+		scope := userIDFrom(r.Context())
+
+		rec, err := idempotencyStore.ClaimIdempotencyKey(r.Context(), scope, key, fingerprint)
+		if err != nil {
+			log.Printf("Failed to claim idempotency key: %v", err)
+			http.Error(w, "Failed to process request", http.StatusInternalServerError)
+			return
+		}
+		if rec != nil {
+			switch {
+			case rec.Fingerprint != fingerprint:
+				http.Error(w, "Idempotency-Key was already used for a different request", http.StatusUnprocessableEntity)
+			case rec.StatusCode == 0:
+				http.Error(w, "A request with this Idempotency-Key is still in progress", http.StatusConflict)
+			default:
+				if rec.ContentType != "" {
+					w.Header().Set("Content-Type", rec.ContentType)
+				}
+				w.Header().Set("Idempotent-Replayed", "true")
+				w.WriteHeader(rec.StatusCode)
+				w.Write(rec.Body)
+			}
+			return
+		}
+
+		rr := &responseRecorder{ResponseWriter: w}
+		// A panicking handler must not leave the key in progress until it expires.
+		defer func() {
+			if v := recover(); v != nil {
+				if err := idempotencyStore.ReleaseIdempotencyKey(context.WithoutCancel(r.Context()), scope, key); err != nil {
+					log.Printf("Failed to release idempotency key: %v", err)
+				}
+				panic(v)
+			}
+		}()
+		next(rr, r)
+		if rr.status == 0 {
+			rr.status = http.StatusOK
+		}
+		// The key must be settled even if the client has already gone away.
+		ctx := context.WithoutCancel(r.Context())
+		if rr.status >= 500 {
+			err = idempotencyStore.ReleaseIdempotencyKey(ctx, scope, key)
+		} else {
+			err = idempotencyStore.CompleteIdempotencyKey(ctx, scope, key, rr.status, w.Header().Get("Content-Type"), rr.body.Bytes())
+		}
+		if err != nil {
+			log.Printf("Failed to settle idempotency key: %v", err)
+		}
+	}
+}
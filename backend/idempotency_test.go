@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRequireIdempotency(t *testing.T) {
+	useMemoryStore(t)
+	calls := 0
+	handler := requireIdempotency(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"id": "booking-1"}`))
+	})
+	post := func(key, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/api/bookings", strings.NewReader(body))
+		req = req.WithContext(context.WithValue(req.Context(), userIDKey, "user-1"))
+		req.Header.Set(idempotencyHeader, key)
+		rec := httptest.NewRecorder()
+		handler(rec, req)
+		return rec
+	}
+
+	first, retry := post("key-1", `{"hotel": "h1"}`), post("key-1", `{"hotel": "h1"}`)
+	if first.Code != http.StatusCreated || retry.Code != http.StatusCreated || calls != 1 {
+		t.Fatalf("statuses %d, %d after %d calls", first.Code, retry.Code, calls)
+	}
+	if retry.Header().Get("Idempotent-Replayed") != "true" || retry.Body.String() != first.Body.String() {
+		t.Errorf("retry was not replayed: %q", retry.Body.String())
+	}
+	if rec := post("key-1", `{"hotel": "h2"}`); rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("reused key with another body: status %d, want 422", rec.Code)
+	}
+
+	// A body over the limit is refused rather than cut, which would let two
+	// different requests share a fingerprint.
+	if rec := post("key-2", strings.Repeat("x", maxIdempotentBody+1)); rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("oversized body: status %d, want 413", rec.Code)
+	}
+	if calls != 1 {
+		t.Errorf("handler ran for a rejected request")
+	}
+}
+
+// A handler that panics releases its key so the client can retry.
+func TestRequireIdempotencyReleasesOnPanic(t *testing.T) {
+	useMemoryStore(t)
+	panics := true
+	handler := requireIdempotency(func(w http.ResponseWriter, r *http.Request) {
+		if panics {
+			panic("boom")
+		}
+		w.WriteHeader(http.StatusCreated)
+	})
+	post := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/api/bookings", strings.NewReader(`{}`))
+		req = req.WithContext(context.WithValue(req.Context(), userIDKey, "user-1"))
+		req.Header.Set(idempotencyHeader, "key-1")
+		rec := httptest.NewRecorder()
+		handler(rec, req)
+		return rec
+	}
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("panic was swallowed")
+			}
+		}()
+		post()
+	}()
+	panics = false
+	if rec := post(); rec.Code != http.StatusCreated {
+		t.Errorf("retry after a panic: status %d, want 201", rec.Code)
+	}
+}
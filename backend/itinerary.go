@@ -0,0 +1,215 @@
+// backend/itinerary.go
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// knownCategories is the closed set of activity categories the frontend knows how to render.
+var knownCategories = map[string]bool{
+	"food":          true,
+	"sightseeing":   true,
+	"adventure":     true,
+	"relaxation":    true,
+	"culture":       true,
+	"shopping":      true,
+	"nature":        true,
+	"nightlife":     true,
+	"transport":     true,
+	"accommodation": true,
+}
+
+// activityTimeLayouts are the time formats we accept in Activity.Time.
+var activityTimeLayouts = []string{"3:04 PM", "3:04PM", "03:04 PM", "15:04", "3 PM", "3PM"}
+
+// defaultRepairRetries is how many repair prompts we send after the first attempt.
+const defaultRepairRetries = 2
+
+// ItineraryValidationError is returned when the model keeps producing an
+// itinerary that does not match the schema.
+type ItineraryValidationError struct {
+	Problems []string `json:"problems"`
+	Attempts int      `json:"attempts"`
+}
+
+func (e *ItineraryValidationError) Error() string {
+	return fmt.Sprintf("itinerary failed validation after %d attempts: %s", e.Attempts, strings.Join(e.Problems, "; "))
+}
+
+// parseActivityTime parses the clock time of an activity.
+func parseActivityTime(s string) (time.Time, error) {
+	s = strings.ToUpper(strings.TrimSpace(s))
+	for _, layout := range activityTimeLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("unrecognised time %q", s)
+}
+
+// itineraryCheck is an extra rule a generated itinerary must pass on top of
+// the schema, such as staying under a budget. Its problems go into the repair prompt.
+type itineraryCheck func(it *Itinerary) []string
+
+// decodeItinerary decodes raw model output and returns every schema problem
+// found. The extra checks only run once the schema is valid.
+func decodeItinerary(raw string, checks ...itineraryCheck) (*Itinerary, []string) {
+	var it Itinerary
+	if err := json.Unmarshal([]byte(raw), &it); err != nil {
+		return nil, []string{"response is not a valid itinerary JSON object: " + err.Error()}
+	}
+	problems := validateItinerary(&it)
+	if len(problems) > 0 {
+		return &it, problems
+	}
+	for _, check := range checks {
+		problems = append(problems, check(&it)...)
+	}
+	return &it, problems
+}
+
+// validateItinerary checks the structure the frontend and map rely on.
+func validateItinerary(it *Itinerary) []string {
+	var problems []string
+	if strings.TrimSpace(it.TripTitle) == "" {
+		problems = append(problems, "tripTitle is empty")
+	}
+	if strings.TrimSpace(it.Destination) == "" {
+		problems = append(problems, "destination is empty")
+	}
+	if len(it.Itinerary) == 0 {
+		problems = append(problems, "itinerary has no days")
+	}
+	for i, day := range it.Itinerary {
+		problems = append(problems, validateDay(i, day)...)
+	}
+	return problems
+}
+
+// validateDay checks a single day that should sit at position i of the itinerary.
+func validateDay(i int, day Day) []string {
+	var problems []string
+	where := "itinerary[" + strconv.Itoa(i) + "]"
+	if day.Day != i+1 {
+		problems = append(problems, fmt.Sprintf("%s: day is %d, expected %d", where, day.Day, i+1))
+	}
+	if len(day.Activities) == 0 {
+		problems = append(problems, where+": has no activities")
+	}
+	for j, act := range day.Activities {
+		problems = append(problems, validateActivity(fmt.Sprintf("%s.activities[%d]", where, j), act)...)
+	}
+	return problems
+}
+
+func validateActivity(where string, act Activity) []string {
+	var problems []string
+	if strings.TrimSpace(act.Description) == "" {
+		problems = append(problems, where+": description is empty")
+	}
+	if _, err := parseActivityTime(act.Time); err != nil {
+		problems = append(problems, fmt.Sprintf("%s: time %q is not a clock time like \"9:00 AM\"", where, act.Time))
+	}
+	if !knownCategories[strings.ToLower(act.Category)] {
+		problems = append(problems, fmt.Sprintf("%s: unknown category %q", where, act.Category))
+	}
+	if act.Lat < -90 || act.Lat > 90 {
+		problems = append(problems, fmt.Sprintf("%s: lat %v is out of range", where, act.Lat))
+	}
+	if act.Lng < -180 || act.Lng > 180 {
+		problems = append(problems, fmt.Sprintf("%s: lng %v is out of range", where, act.Lng))
+	}
+	if act.Lat == 0 && act.Lng == 0 {
+		problems = append(problems, where+": lat/lng are missing")
+	}
+	if act.Cost != (Money{}) {
+		if err := act.Cost.validate(); err != nil {
+			problems = append(problems, fmt.Sprintf("%s: cost %v", where, err))
+		}
+	}
+	return problems
+}
+
+func categoryList() string {
+	names := make([]string, 0, len(knownCategories))
+	for name := range knownCategories {
+		names = append(names, strings.ToUpper(name[:1])+name[1:])
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+func buildRepairPrompt(original, previous string, problems []string) string {
+	return fmt.Sprintf(`
+%s
+
+Your previous answer was:
+%s
+
+It was rejected because of these problems:
+- %s
+
+Return the corrected itinerary as a single JSON object in exactly the same structure. Days must be numbered 1, 2, 3... in order, every time must look like "9:00 AM", every category must be one of: %s, and lat/lng must be real coordinates.
+`, original, previous, strings.Join(problems, "\n- "), categoryList())
+}
+
+// generateItinerary asks the model for an itinerary and, when it fails
+// validation, sends repair prompts until the retry budget runs out.
+func generateItinerary(ctx context.Context, prompt string, retries int, checks ...itineraryCheck) (*Itinerary, error) {
+	raw, err := llm.GenerateJSON(ctx, LLMRequest{Task: taskItinerary, Prompt: prompt})
+	if err != nil {
+		return nil, err
+	}
+	return repairItinerary(ctx, prompt, raw, retries, checks...)
+}
+
+// repairItinerary validates raw model output for prompt and asks the model to
+// fix it, at most retries times.
+func repairItinerary(ctx context.Context, prompt, raw string, retries int, checks ...itineraryCheck) (*Itinerary, error) {
+	it, problems := decodeItinerary(raw, checks...)
+	attempts := 1
+	for ; len(problems) > 0 && attempts <= retries; attempts++ {
+		var err error
+		raw, err = llm.GenerateJSON(ctx, LLMRequest{Task: taskItinerary, Prompt: buildRepairPrompt(prompt, raw, problems)})
+		if err != nil {
+			return nil, err
+		}
+		it, problems = decodeItinerary(raw, checks...)
+	}
+	if len(problems) > 0 {
+		return nil, &ItineraryValidationError{Problems: problems, Attempts: attempts}
+	}
+	return it, nil
+}
+
+func repairRetries() int {
+	n, err := strconv.Atoi(envOr("ITINERARY_REPAIR_RETRIES", ""))
+	if err != nil || n < 0 {
+		return defaultRepairRetries
+	}
+	return n
+}
+
+// body is the JSON payload clients receive for a rejected itinerary.
+func (e *ItineraryValidationError) body() map[string]interface{} {
+	return map[string]interface{}{
+		"error":    "invalid_itinerary",
+		"message":  "The AI produced an itinerary we could not use, please try again.",
+		"problems": e.Problems,
+		"attempts": e.Attempts,
+	}
+}
+
+func writeValidationError(w http.ResponseWriter, verr *ItineraryValidationError) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusUnprocessableEntity)
+	json.NewEncoder(w).Encode(verr.body())
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// scriptedProvider answers with its responses in order and records the
+// prompts it was sent.
+type scriptedProvider struct {
+	FakeProvider
+	responses []string
+	prompts   []string
+}
+
+func (s *scriptedProvider) GenerateJSON(ctx context.Context, req LLMRequest) (string, error) {
+	s.prompts = append(s.prompts, req.Prompt)
+	if len(s.responses) == 0 {
+		return "", errors.New("no more responses")
+	}
+	body := s.responses[0]
+	s.responses = s.responses[1:]
+	return body, nil
+}
+
+func TestValidateItinerary(t *testing.T) {
+	valid := func() *Itinerary {
+		it, problems := decodeItinerary(fakeFixtures[taskItinerary])
+		if len(problems) > 0 {
+			t.Fatalf("fixture is invalid: %v", problems)
+		}
+		return it
+	}
+	tests := []struct {
+		name  string
+		edit  func(it *Itinerary)
+		wants string
+	}{
+		{"empty title", func(it *Itinerary) { it.TripTitle = " " }, "tripTitle is empty"},
+		{"no days", func(it *Itinerary) { it.Itinerary = nil }, "itinerary has no days"},
+		{"days out of order", func(it *Itinerary) { it.Itinerary[1].Day = 3 }, "itinerary[1]: day is 3, expected 2"},
+		{"bad time", func(it *Itinerary) { it.Itinerary[0].Activities[0].Time = "morning" }, `time "morning" is not a clock time`},
+		{"unknown category", func(it *Itinerary) { it.Itinerary[0].Activities[1].Category = "Spa" }, `unknown category "Spa"`},
+		{"missing coordinates", func(it *Itinerary) { it.Itinerary[1].Activities[0].Lat, it.Itinerary[1].Activities[0].Lng = 0, 0 }, "lat/lng are missing"},
+		{"latitude out of range", func(it *Itinerary) { it.Itinerary[0].Activities[0].Lat = 91 }, "lat 91 is out of range"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			it := valid()
+			tt.edit(it)
+			problems := validateItinerary(it)
+			if !strings.Contains(strings.Join(problems, "\n"), tt.wants) {
+				t.Errorf("problems %q do not mention %q", problems, tt.wants)
+			}
+		})
+	}
+}
+
+func TestGenerateItineraryRepairs(t *testing.T) {
+	broken := strings.Replace(fakeFixtures[taskItinerary], `"time": "9:00 AM"`, `"time": "morning"`, 1)
+	provider := &scriptedProvider{responses: []string{broken, fakeFixtures[taskItinerary]}}
+	setGlobal[LLMProvider](t, &llm, provider)
+
+	it, err := generateItinerary(context.Background(), "A week in Kyoto", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if it.TripTitle != "A Gentle Week in Kyoto" {
+		t.Errorf("tripTitle = %q", it.TripTitle)
+	}
+	if len(provider.prompts) != 2 {
+		t.Fatalf("sent %d prompts, want 2", len(provider.prompts))
+	}
+	repair := provider.prompts[1]
+	if !strings.Contains(repair, "A week in Kyoto") || !strings.Contains(repair, `time "morning" is not a clock time`) {
+		t.Errorf("repair prompt lacks the original prompt or the problem:\n%s", repair)
+	}
+}
+
+func TestGenerateItineraryGivesUp(t *testing.T) {
+	fake := NewFakeProvider()
+	fake.Responses[taskItinerary] = `{"tripTitle": "Kyoto"`
+	setGlobal[LLMProvider](t, &llm, fake)
+
+	_, err := generateItinerary(context.Background(), "A week in Kyoto", 2)
+	var verr *ItineraryValidationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("got %v, want an ItineraryValidationError", err)
+	}
+	if verr.Attempts != 3 {
+		t.Errorf("attempts = %d, want 3", verr.Attempts)
+	}
+}
+
+func TestHandleGenerateRejectsInvalidItinerary(t *testing.T) {
+	t.Setenv("ITINERARY_REPAIR_RETRIES", "1")
+	fake := NewFakeProvider()
+	fake.Responses[taskItinerary] = `{"tripTitle": "Kyoto", "destination": "Kyoto, Japan", "itinerary": []}`
+	setGlobal[LLMProvider](t, &llm, fake)
+
+	rec := httptest.NewRecorder()
+	handleGenerate(rec, httptest.NewRequest("POST", "/api/generate", strings.NewReader("A week in Kyoto")))
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("status = %d, want 422: %s", rec.Code, rec.Body.String())
+	}
+	var body struct {
+		Error    string   `json:"error"`
+		Problems []string `json:"problems"`
+		Attempts int      `json:"attempts"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	if body.Error != "invalid_itinerary" || body.Attempts != 2 || len(body.Problems) == 0 {
+		t.Errorf("unexpected body %+v", body)
+	}
+}
@@ -0,0 +1,124 @@
+// backend/jsondiff.go
+
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// JSONChange is one difference between two JSON documents. Path is a JSON
+// Pointer (RFC 6901); Op is "add", "remove" or "replace".
+type JSONChange struct {
+	Op   string      `json:"op"`
+	Path string      `json:"path"`
+	From interface{} `json:"from,omitempty"`
+	To   interface{} `json:"to,omitempty"`
+}
+
+// toJSONValue converts v into the generic maps and slices encoding/json produces.
+func toJSONValue(v interface{}) (interface{}, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var out interface{}
+	err = json.Unmarshal(b, &out)
+	return out, err
+}
+
+// diffJSON lists the changes that turn a into b. Arrays are compared by index.
+func diffJSON(a, b interface{}) ([]JSONChange, error) {
+	av, err := toJSONValue(a)
+	if err != nil {
+		return nil, err
+	}
+	bv, err := toJSONValue(b)
+	if err != nil {
+		return nil, err
+	}
+	var changes []JSONChange
+	diffValues("", av, bv, &changes)
+	return changes, nil
+}
+
+func diffValues(path string, a, b interface{}, changes *[]JSONChange) {
+	switch av := a.(type) {
+	case map[string]interface{}:
+		bv, ok := b.(map[string]interface{})
+		if !ok {
+			break
+		}
+		keys := make([]string, 0, len(av)+len(bv))
+		for k := range av {
+			keys = append(keys, k)
+		}
+		for k := range bv {
+			if _, seen := av[k]; !seen {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			child := path + "/" + escapePointer(k)
+			x, inA := av[k]
+			y, inB := bv[k]
+			switch {
+			case !inA:
+				*changes = append(*changes, JSONChange{Op: "add", Path: child, To: y})
+			case !inB:
+				*changes = append(*changes, JSONChange{Op: "remove", Path: child, From: x})
+			default:
+				diffValues(child, x, y, changes)
+			}
+		}
+		return
+	case []interface{}:
+		bv, ok := b.([]interface{})
+		if !ok {
+			break
+		}
+		for i := 0; i < max(len(av), len(bv)); i++ {
+			child := path + "/" + strconv.Itoa(i)
+			switch {
+			case i >= len(av):
+				*changes = append(*changes, JSONChange{Op: "add", Path: child, To: bv[i]})
+			case i >= len(bv):
+				*changes = append(*changes, JSONChange{Op: "remove", Path: child, From: av[i]})
+			default:
+				diffValues(child, av[i], bv[i], changes)
+			}
+		}
+		return
+	}
+	if !reflect.DeepEqual(a, b) {
+		*changes = append(*changes, JSONChange{Op: "replace", Path: path, From: a, To: b})
+	}
+}
+
+func escapePointer(s string) string {
+	return strings.NewReplacer("~", "~0", "/", "~1").Replace(s)
+}
+
+// mergePatch applies a JSON Merge Patch (RFC 7386) to target.
+func mergePatch(target, patch interface{}) interface{} {
+	p, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+	t, ok := target.(map[string]interface{})
+	if !ok {
+		t = make(map[string]interface{})
+	}
+	for k, v := range p {
+		if v == nil {
+			delete(t, k)
+		} else {
+			t[k] = mergePatch(t[k], v)
+		}
+	}
+	return t
+}
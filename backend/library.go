@@ -0,0 +1,208 @@
+// backend/library.go
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+)
+
+const (
+	tripDateLayout      = "2006-01-02"
+	defaultLibraryLimit = 20
+	maxLibraryLimit     = 100
+)
+
+// TripSummary is the card-sized view of a trip used by the library page.
+type TripSummary struct {
+	ID            string            `json:"id"`
+	TripTitle     string            `json:"tripTitle"`
+	Destination   string            `json:"destination"`
+	StartDate     string            `json:"startDate,omitempty"`
+	EndDate       string            `json:"endDate,omitempty"`
+	Accessibility TripAccessibility `json:"accessibility"`
+	IsPast        bool              `json:"isPast"`
+
+	createdAt time.Time
+}
+
+// createdBefore orders summaries that tie on date: newest first, then by ID,
+// so every request pages through the same order.
+func (s TripSummary) createdBefore(o TripSummary) bool {
+	if !s.createdAt.Equal(o.createdAt) {
+		return s.createdAt.After(o.createdAt)
+	}
+	return s.ID < o.ID
+}
+
+// resolveTripDates validates start/end dates. A missing end date is derived
+// from the number of days in the itinerary.
+func resolveTripDates(start, end string, days int) (string, string, error) {
+	if start == "" {
+		if end != "" {
+			return "", "", errors.New("endDate requires a startDate")
+		}
+		return "", "", nil
+	}
+	startDay, err := time.Parse(tripDateLayout, start)
+	if err != nil {
+		return "", "", fmt.Errorf("startDate %q must look like 2006-01-02", start)
+	}
+	if end == "" {
+		return start, startDay.AddDate(0, 0, max(days-1, 0)).Format(tripDateLayout), nil
+	}
+	endDay, err := time.Parse(tripDateLayout, end)
+	if err != nil {
+		return "", "", fmt.Errorf("endDate %q must look like 2006-01-02", end)
+	}
+	if endDay.Before(startDay) {
+		return "", "", errors.New("endDate is before startDate")
+	}
+	return start, end, nil
+}
+
+// profileAccessibility derives the trip card flags from a user's profile.
+func profileAccessibility(profile *Profile) TripAccessibility {
+	var a TripAccessibility
+	if profile == nil {
+		return a
+	}
+	if m := profile.Mobility; m != nil {
+		a.Mobility = m.Wheelchair || m.AvoidStairs || m.FrequentRests
+		a.LowEnergy = m.FrequentRests
+	}
+	if s := profile.Sensory; s != nil {
+		a.Sensory = s.Noise < 50 || s.Visual < 50
+	}
+	a.Dietary = len(profile.Dietary) > 0
+	return a
+}
+
+// splitTrips separates trips into upcoming (soonest first, undated last) and
+// past (most recent first). A trip is past once its end date is before today.
+// Trips on the same date, undated ones included, are newest first.
+func splitTrips(trips []Trip, today string) (upcoming, past []TripSummary) {
+	for _, t := range trips {
+		s := TripSummary{
+			ID:            t.ID,
+			TripTitle:     t.Itinerary.TripTitle,
+			Destination:   t.Itinerary.Destination,
+			StartDate:     t.StartDate,
+			EndDate:       t.EndDate,
+			Accessibility: t.Accessibility,
+			createdAt:     t.CreatedAt,
+		}
+		// Dates share one layout, so string comparison is chronological.
+		if t.EndDate != "" && t.EndDate < today {
+			s.IsPast = true
+			past = append(past, s)
+		} else {
+			upcoming = append(upcoming, s)
+		}
+	}
+	sort.Slice(upcoming, func(i, j int) bool {
+		a, b := upcoming[i].StartDate, upcoming[j].StartDate
+		if a != b {
+			if a == "" || b == "" {
+				return b == ""
+			}
+			return a < b
+		}
+		return upcoming[i].createdBefore(upcoming[j])
+	})
+	sort.Slice(past, func(i, j int) bool {
+		if a, b := past[i].EndDate, past[j].EndDate; a != b {
+			return a > b
+		}
+		return past[i].createdBefore(past[j])
+	})
+	return upcoming, past
+}
+
+// page returns items[offset:offset+limit] and the offset of the next page, or nil.
+func page(items []TripSummary, offset, limit int) ([]TripSummary, *int) {
+	if offset >= len(items) {
+		return []TripSummary{}, nil
+	}
+	end := min(offset+limit, len(items))
+	if end == len(items) {
+		return items[offset:end], nil
+	}
+	return items[offset:end], &end
+}
+
+func queryInt(r *http.Request, key string, fallback int) (int, error) {
+	v := r.URL.Query().Get(key)
+	if v == "" {
+		return fallback, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("%s must be a non-negative integer", key)
+	}
+	return n, nil
+}
+
+// handleMyTrips lists the caller's trips split into upcoming and past.
+// Query parameters: limit, upcomingOffset, pastOffset and an optional today
+// (2006-01-02) so the split follows the traveller's own calendar.
+func handleMyTrips(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	userId := userIDFrom(r.Context())
+
+	limit, err := queryInt(r, "limit", defaultLibraryLimit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if limit == 0 {
+		limit = defaultLibraryLimit
+	}
+	limit = min(limit, maxLibraryLimit)
+	upcomingOffset, err := queryInt(r, "upcomingOffset", 0)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	pastOffset, err := queryInt(r, "pastOffset", 0)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	today := r.URL.Query().Get("today")
+	if today == "" {
+		today = time.Now().UTC().Format(tripDateLayout)
+	} else if _, err := time.Parse(tripDateLayout, today); err != nil {
+		http.Error(w, "today must look like 2006-01-02", http.StatusBadRequest)
+		return
+	}
+
+	trips, err := tripStore.ListUserTrips(r.Context(), userId)
+	if err != nil {
+		log.Printf("Failed to list trips for %s: %v", userId, err)
+		http.Error(w, "Failed to load trips", http.StatusInternalServerError)
+		return
+	}
+	upcoming, past := splitTrips(trips, today)
+	upcomingPage, nextUpcoming := page(upcoming, upcomingOffset, limit)
+	pastPage, nextPast := page(past, pastOffset, limit)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"upcoming":           upcomingPage,
+		"past":               pastPage,
+		"upcomingTotal":      len(upcoming),
+		"pastTotal":          len(past),
+		"nextUpcomingOffset": nextUpcoming,
+		"nextPastOffset":     nextPast,
+	})
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+)
+
+// Undated trips and trips on the same date page in one order on every
+// request, however the store returns them.
+func TestMyTripsPagesTiesInOrder(t *testing.T) {
+	useMemoryStore(t)
+	ctx := context.WithValue(context.Background(), userIDKey, "user-1")
+	created := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+	add := func(title, start, end string, at time.Time) string {
+		trip := &Trip{UserID: "user-1", Itinerary: Itinerary{TripTitle: title}, StartDate: start, EndDate: end, CreatedAt: at}
+		if err := tripStore.CreateTrip(ctx, trip); err != nil {
+			t.Fatal(err)
+		}
+		return trip.ID
+	}
+	var undated, sameDay []string
+	for i := range 4 {
+		undated = append(undated, add(fmt.Sprintf("undated %d", i), "", "", created.Add(time.Duration(i)*time.Hour)))
+	}
+	// Two undated trips created at the same moment fall back to their IDs.
+	undated = append(undated, add("undated twin", "", "", created.Add(3*time.Hour)))
+	for i := range 3 {
+		sameDay = append(sameDay, add(fmt.Sprintf("past %d", i), "2026-03-01", "2026-03-03", created.Add(time.Duration(i)*time.Hour)))
+	}
+
+	twins := []string{undated[3], undated[4]}
+	slices.Sort(twins)
+	wantUpcoming := append(twins, undated[2], undated[1], undated[0])
+	wantPast := []string{sameDay[2], sameDay[1], sameDay[0]}
+
+	fetch := func(offsetKey string, offset int) (ids []string, next *int) {
+		url := fmt.Sprintf("/api/my-trips?limit=2&today=2026-06-01&%s=%d", offsetKey, offset)
+		rec := httptest.NewRecorder()
+		handleMyTrips(rec, httptest.NewRequest("GET", url, nil).WithContext(ctx))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s returned %d: %s", url, rec.Code, rec.Body.String())
+		}
+		var body struct {
+			Upcoming, Past                     []TripSummary
+			NextUpcomingOffset, NextPastOffset *int
+		}
+		if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+			t.Fatal(err)
+		}
+		list, next := body.Upcoming, body.NextUpcomingOffset
+		if offsetKey == "pastOffset" {
+			list, next = body.Past, body.NextPastOffset
+		}
+		for _, s := range list {
+			ids = append(ids, s.ID)
+		}
+		return ids, next
+	}
+	all := func(offsetKey string) []string {
+		var ids []string
+		for offset := 0; ; {
+			got, next := fetch(offsetKey, offset)
+			ids = append(ids, got...)
+			if next == nil {
+				return ids
+			}
+			offset = *next
+		}
+	}
+
+	for range 5 {
+		if got := all("upcomingOffset"); !slices.Equal(got, wantUpcoming) {
+			t.Fatalf("upcoming pages %v, want %v", got, wantUpcoming)
+		}
+		if got := all("pastOffset"); !slices.Equal(got, wantPast) {
+			t.Fatalf("past pages %v, want %v", got, wantPast)
+		}
+	}
+}
@@ -0,0 +1,336 @@
+// backend/llm.go
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/google/generative-ai-go/genai"
+	"google.golang.org/api/iterator"
+	"google.golang.org/api/option"
+)
+
+// Task names tell a provider which kind of JSON the prompt asks for.
+// Real models ignore them; the fake provider uses them to pick a fixture.
+const (
+	taskItinerary     = "itinerary"
+	taskChecklist     = "checklist"
+	taskCommCard      = "comm-card"
+	taskBackTranslate = "back-translate"
+	taskSensory       = "sensory-profile"
+	taskReshuffle     = "reshuffle"
+	taskScript        = "script"
+	taskHotelRequest  = "hotel-request"
+	taskAdapt         = "adapt"
+)
+
+const defaultGeminiModel = "gemini-1.5-flash"
+
+// LLMRequest is a single JSON-mode prompt sent to a provider.
+type LLMRequest struct {
+	Task   string
+	Prompt string
+}
+
+// LLMProvider is the blueprint every AI backend must follow.
+// GenerateJSON returns the raw JSON text produced by the model.
+// StreamJSON delivers the same text in chunks as the model produces it.
+type LLMProvider interface {
+	GenerateJSON(ctx context.Context, req LLMRequest) (string, error)
+	StreamJSON(ctx context.Context, req LLMRequest, onChunk func(string) error) error
+	Close() error
+}
+
+var llm LLMProvider
+
+// initLLM picks a provider from LLM_PROVIDER: "gemini" (default), "openai" or "fake".
+func initLLM() {
+	provider, err := newLLMProvider(context.Background(), os.Getenv("LLM_PROVIDER"))
+	if err != nil {
+		log.Fatalf("error initializing LLM provider: %v", err)
+	}
+	llm = provider
+}
+
+func newLLMProvider(ctx context.Context, name string) (LLMProvider, error) {
+	switch strings.ToLower(name) {
+	case "", "gemini":
+		return NewGeminiProvider(ctx, os.Getenv("GEMINI_API_KEY"), envOr("GEMINI_MODEL", defaultGeminiModel))
+	case "openai", "local":
+		baseURL := os.Getenv("LLM_BASE_URL")
+		if baseURL == "" {
+			return nil, errors.New("LLM_BASE_URL is required for the openai provider")
+		}
+		return NewOpenAIProvider(baseURL, os.Getenv("LLM_API_KEY"), os.Getenv("LLM_MODEL")), nil
+	case "fake":
+		return NewFakeProvider(), nil
+	}
+	return nil, fmt.Errorf("unknown LLM_PROVIDER %q", name)
+}
+
+func envOr(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
+
+// GeminiProvider talks to Google Gemini through one shared client.
+type GeminiProvider struct {
+	client *genai.Client
+	model  string
+}
+
+func NewGeminiProvider(ctx context.Context, apiKey, model string) (*GeminiProvider, error) {
+	client, err := genai.NewClient(ctx, option.WithAPIKey(apiKey))
+	if err != nil {
+		return nil, err
+	}
+	return &GeminiProvider{client: client, model: model}, nil
+}
+
+func (g *GeminiProvider) jsonModel() *genai.GenerativeModel {
+	model := g.client.GenerativeModel(g.model)
+	model.GenerationConfig = genai.GenerationConfig{
+		ResponseMIMEType: "application/json",
+	}
+	return model
+}
+
+func (g *GeminiProvider) GenerateJSON(ctx context.Context, req LLMRequest) (string, error) {
+	resp, err := g.jsonModel().GenerateContent(ctx, genai.Text(req.Prompt))
+	if err != nil {
+		return "", err
+	}
+	return printResponse(resp), nil
+}
+
+func (g *GeminiProvider) StreamJSON(ctx context.Context, req LLMRequest, onChunk func(string) error) error {
+	iter := g.jsonModel().GenerateContentStream(ctx, genai.Text(req.Prompt))
+	for {
+		resp, err := iter.Next()
+		if err == iterator.Done {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := onChunk(printResponse(resp)); err != nil {
+			return err
+		}
+	}
+}
+
+func (g *GeminiProvider) Close() error {
+	return g.client.Close()
+}
+
+// OpenAIProvider talks to any OpenAI-compatible chat completions server,
+// e.g. a local Ollama, llama.cpp or vLLM instance.
+type OpenAIProvider struct {
+	baseURL string
+	apiKey  string
+	model   string
+	http    *http.Client
+}
+
+func NewOpenAIProvider(baseURL, apiKey, model string) *OpenAIProvider {
+	return &OpenAIProvider{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		apiKey:  apiKey,
+		model:   model,
+		http:    &http.Client{Timeout: 2 * time.Minute},
+	}
+}
+
+type openAIMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+type openAIChatRequest struct {
+	Model          string            `json:"model"`
+	Messages       []openAIMessage   `json:"messages"`
+	ResponseFormat map[string]string `json:"response_format,omitempty"`
+	Stream         bool              `json:"stream,omitempty"`
+}
+
+type openAIChatResponse struct {
+	Choices []struct {
+		Message openAIMessage `json:"message"`
+		Delta   openAIMessage `json:"delta"`
+	} `json:"choices"`
+}
+
+func (o *OpenAIProvider) newRequest(ctx context.Context, payload interface{}) (*http.Request, error) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", o.baseURL+"/chat/completions", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	if o.apiKey != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+o.apiKey)
+	}
+	return httpReq, nil
+}
+
+func (o *OpenAIProvider) do(ctx context.Context, req LLMRequest, stream bool) (*http.Response, error) {
+	httpReq, err := o.newRequest(ctx, openAIChatRequest{
+		Model:          o.model,
+		Messages:       []openAIMessage{{Role: "user", Content: req.Prompt}},
+		ResponseFormat: map[string]string{"type": "json_object"},
+		Stream:         stream,
+	})
+	if err != nil {
+		return nil, err
+	}
+	resp, err := o.http.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, fmt.Errorf("llm server returned %s: %s", resp.Status, msg)
+	}
+	return resp, nil
+}
+
+func (o *OpenAIProvider) GenerateJSON(ctx context.Context, req LLMRequest) (string, error) {
+	resp, err := o.do(ctx, req, false)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	var out openAIChatResponse
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return "", err
+	}
+	if len(out.Choices) == 0 {
+		return "", errors.New("llm server returned no choices")
+	}
+	return out.Choices[0].Message.Content, nil
+}
+
+// StreamJSON reads the server-sent "data:" lines of a streamed chat completion.
+func (o *OpenAIProvider) StreamJSON(ctx context.Context, req LLMRequest, onChunk func(string) error) error {
+	resp, err := o.do(ctx, req, true)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data:")
+		if !ok {
+			continue
+		}
+		data = strings.TrimSpace(data)
+		if data == "[DONE]" {
+			return nil
+		}
+		var chunk openAIChatResponse
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			return err
+		}
+		if len(chunk.Choices) == 0 || chunk.Choices[0].Delta.Content == "" {
+			continue
+		}
+		if err := onChunk(chunk.Choices[0].Delta.Content); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+func (o *OpenAIProvider) Close() error {
+	return nil
+}
+
+// FakeProvider returns canned, deterministic JSON for every task so the API
+// can run offline. Responses can be overridden per task.
+type FakeProvider struct {
+	Responses map[string]string
+}
+
+func NewFakeProvider() *FakeProvider {
+	responses := make(map[string]string, len(fakeFixtures))
+	for task, body := range fakeFixtures {
+		responses[task] = body
+	}
+	return &FakeProvider{Responses: responses}
+}
+
+func (f *FakeProvider) GenerateJSON(ctx context.Context, req LLMRequest) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	body, ok := f.Responses[req.Task]
+	if !ok {
+		return "", fmt.Errorf("fake provider has no response for task %q", req.Task)
+	}
+	return body, nil
+}
+
+// StreamJSON replays the canned response in small fixed-size chunks.
+func (f *FakeProvider) StreamJSON(ctx context.Context, req LLMRequest, onChunk func(string) error) error {
+	body, err := f.GenerateJSON(ctx, req)
+	if err != nil {
+		return err
+	}
+	for len(body) > 0 {
+		n := min(fakeChunkSize, len(body))
+		if err := onChunk(body[:n]); err != nil {
+			return err
+		}
+		body = body[n:]
+	}
+	return nil
+}
+
+func (f *FakeProvider) Close() error {
+	return nil
+}
+
+const fakeChunkSize = 48
+
+var fakeFixtures = map[string]string{
+	taskItinerary: `{"tripTitle": "A Gentle Week in Kyoto", "destination": "Kyoto, Japan", "itinerary": [` +
+		`{"day": 1, "title": "Arrival and Temples", "activities": [` +
+		`{"time": "9:00 AM", "description": "Step-free stroll around Kiyomizu-dera.", "category": "Sightseeing", "lat": 34.9948, "lng": 135.7850, "cost": {"amount": 400, "currency": "JPY"}},` +
+		`{"time": "1:00 PM", "description": "Quiet lunch at a tofu restaurant.", "category": "Food", "lat": 35.0037, "lng": 135.7788, "cost": {"amount": 3000, "currency": "JPY"}}]},` +
+		`{"day": 2, "title": "Gardens and Rest", "activities": [` +
+		`{"time": "10:00 AM", "description": "Morning at the Philosopher's Path.", "category": "Sightseeing", "lat": 35.0270, "lng": 135.7944, "cost": {"amount": 0, "currency": "JPY"}},` +
+		`{"time": "3:00 PM", "description": "Rest at the hotel.", "category": "Relaxation", "lat": 35.0116, "lng": 135.7681, "cost": {"amount": 0, "currency": "JPY"}}]}]}`,
+	taskChecklist: `["Pack noise-cancelling headphones", "Download offline map for step-free routes", "Prepare medication documents for customs"]`,
+	taskCommCard: `{"title": {"en": "Please read: my needs", "translation": "お読みください：私の必要なこと"}, "phrases": [` +
+		`{"need": "dietary", "en": "I have a severe gluten allergy. My food cannot contain any wheat, barley, or rye.", "translation": "私は重度のグルテンアレルギーです。小麦、大麦、ライ麦は一切含まないようにしてください。"}]}`,
+	taskBackTranslate: `{"translations": ["Please read: the things I need", "I have a severe gluten allergy. Please make sure it contains no wheat, barley or rye at all."]}`,
+	taskSensory: `{"summary": "Quiet early mornings; traffic noise and crowds peak from noon to early evening, with calmer side streets.", "buckets": [` +
+		`{"hour": 0, "audio": 10, "visual": 15, "crowds": 5}, {"hour": 2, "audio": 5, "visual": 10, "crowds": 5}, {"hour": 4, "audio": 10, "visual": 10, "crowds": 5},` +
+		`{"hour": 6, "audio": 25, "visual": 20, "crowds": 15}, {"hour": 8, "audio": 45, "visual": 35, "crowds": 40}, {"hour": 10, "audio": 50, "visual": 40, "crowds": 55},` +
+		`{"hour": 12, "audio": 60, "visual": 45, "crowds": 70}, {"hour": 14, "audio": 55, "visual": 45, "crowds": 65}, {"hour": 16, "audio": 60, "visual": 50, "crowds": 70},` +
+		`{"hour": 18, "audio": 50, "visual": 55, "crowds": 55}, {"hour": 20, "audio": 35, "visual": 45, "crowds": 35}, {"hour": 22, "audio": 20, "visual": 30, "crowds": 15}]}`,
+	taskReshuffle: `{"activityIndex": 0, "reason": "A long walk is hard on a low-energy day.", "activity": ` +
+		`{"time": "10:00 AM", "description": "Relax at a nearby tea house.", "category": "Relaxation", "lat": 35.0265, "lng": 135.7932}}`,
+	taskScript:       `{"user": ["I'd like a table for one, please."], "staff": ["Of course, follow me."], "tips": "A small bow is a polite greeting."}`,
+	taskHotelRequest: `{"email": "Dear Hotel Team,\nI am looking forward to my stay. Could you please provide a low floor room?\nBest regards,\n[Your Name]"}`,
+	taskAdapt: `{"conflicts": [{"day": 1, "activityIndex": 1, "reason": "Tofu dishes are often seasoned with soy sauce, which contains wheat.", "replacement": ` +
+		`{"time": "1:00 PM", "description": "Lunch at a dedicated gluten-free cafe.", "category": "Food", "lat": 35.0050, "lng": 135.7680}}]}`,
+}
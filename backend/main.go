@@ -5,13 +5,14 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
-	"math/rand"
 	"net/http"
 	"os"
-	"time"
+	"strings"
+	"sync"
 
 	"cloud.google.com/go/firestore"
 	firebase "firebase.google.com/go"
@@ -22,44 +23,70 @@ import (
 
 // This is the blueprint for a single activity.
 type Activity struct {
-	Time        string  `json:"time"`
-	Description string  `json:"description"`
-	Category    string  `json:"category"` // e.g., "Food", "Sightseeing", "Adventure"
-	Lat         float64 `json:"lat"`      // Latitude for map pin
-	Lng         float64 `json:"lng"`      // Longitude for map pin
+	Time        string  `json:"time" firestore:"time"`
+	Description string  `json:"description" firestore:"description"`
+	Category    string  `json:"category" firestore:"category"` // e.g., "Food", "Sightseeing", "Adventure"
+	Lat         float64 `json:"lat" firestore:"lat"`           // Latitude for map pin
+	Lng         float64 `json:"lng" firestore:"lng"`           // Longitude for map pin
+
+	// Optional estimated cost per person
+	Cost Money `json:"cost,omitzero" firestore:"cost,omitempty"`
+	// Why the activity may not suit the traveller, set when a forked trip is adapted
+	Conflict string `json:"conflict,omitempty" firestore:"conflict,omitempty"`
+	// Set by the traveller to keep the activity in its slot when a day is optimized
+	Locked bool `json:"locked,omitempty" firestore:"locked,omitempty"`
+	// Expected sensory load, set when the activity went over the traveller's limits
+	Sensory *ActivitySensory `json:"sensory,omitempty" firestore:"sensory,omitempty"`
 }
 
 // This is the blueprint for a single day.
 type Day struct {
-	Day        int        `json:"day"`
-	Title      string     `json:"title"`
-	Activities []Activity `json:"activities"`
+	Day        int        `json:"day" firestore:"day"`
+	Title      string     `json:"title" firestore:"title"`
+	Activities []Activity `json:"activities" firestore:"activities"`
 }
 
 // This is the blueprint for the entire itinerary.
 type Itinerary struct {
-	TripTitle   string `json:"tripTitle"`
-	Destination string `json:"destination"`
-	Itinerary   []Day  `json:"itinerary"`
+	TripTitle   string `json:"tripTitle" firestore:"tripTitle"`
+	Destination string `json:"destination" firestore:"destination"`
+	Itinerary   []Day  `json:"itinerary" firestore:"itinerary"`
 }
 
 var firestoreClient *firestore.Client
 
+var (
+	fbApp     *firebase.App
+	fbAppOnce sync.Once
+)
+
+// firebaseApp returns the one Firebase app shared by Firestore and Auth.
+func firebaseApp() *firebase.App {
+	fbAppOnce.Do(func() {
+		ctx := context.Background()
+		// Get project ID from environment or hardcode for now
+		projectID := os.Getenv("FIREBASE_PROJECT_ID")
+		if projectID == "" {
+			log.Fatalf("FIREBASE_PROJECT_ID environment variable is required but not set.")
+		}
+		conf := &firebase.Config{ProjectID: projectID}
+		var opts []option.ClientOption
+		// Verifying ID tokens only needs the project ID; Firestore needs the service account.
+		if _, err := os.Stat("serviceAccountKey.json"); err == nil {
+			opts = append(opts, option.WithCredentialsFile("serviceAccountKey.json"))
+		}
+		app, err := firebase.NewApp(ctx, conf, opts...)
+		if err != nil {
+			log.Fatalf("error initializing firebase app: %v", err)
+		}
+		fbApp = app
+	})
+	return fbApp
+}
+
 func initFirebase() {
-	ctx := context.Background()
-	// TODO: Replace with your actual service account key file path
-	sa := option.WithCredentialsFile("serviceAccountKey.json")
-	// Get project ID from environment or hardcode for now
-	projectID := os.Getenv("FIREBASE_PROJECT_ID")
-	if projectID == "" {
-		log.Fatalf("FIREBASE_PROJECT_ID environment variable is required but not set.")
-	}
-	conf := &firebase.Config{ProjectID: projectID}
-	app, err := firebase.NewApp(ctx, conf, sa)
-	if err != nil {
-		log.Fatalf("error initializing firebase app: %v", err)
-	}
-	firestoreClient, err = app.Firestore(ctx)
+	var err error
+	firestoreClient, err = firebaseApp().Firestore(context.Background())
 	if err != nil {
 		log.Fatalf("error initializing firestore client: %v", err)
 	}
@@ -69,8 +96,8 @@ func initFirebase() {
 func corsMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "POST, GET, OPTIONS, PUT, DELETE")
-		w.Header().Set("Access-Control-Allow-Headers", "Accept, Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, X-User-Id")
+		w.Header().Set("Access-Control-Allow-Methods", "POST, GET, OPTIONS, PUT, PATCH, DELETE")
+		w.Header().Set("Access-Control-Allow-Headers", "Accept, Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, If-Match, Idempotency-Key")
 		if r.Method == "OPTIONS" {
 			return
 		}
@@ -79,23 +106,63 @@ func corsMiddleware(next http.Handler) http.Handler {
 }
 
 func main() {
-	err := godotenv.Load(".env.local")
-	if err != nil {
-		log.Fatal("Error loading .env file")
+	// .env.local is optional; self-hosted setups can configure everything through the environment.
+	if err := godotenv.Load(".env.local"); err != nil {
+		log.Println("No .env.local file loaded, using process environment")
 	}
 
 	mux := http.NewServeMux()
-	mux.HandleFunc("/api/generate", handleGenerate)
-	mux.HandleFunc("/api/save-trip", handleSaveTrip)
-	mux.HandleFunc("/api/mock-prices", handleMockPrices)
+	mux.HandleFunc("/api/generate", optionalAuth(handleGenerate))
+	mux.HandleFunc("/api/generate-stream", optionalAuth(handleGenerateStream))
+	mux.HandleFunc("/api/save-trip", requireAuth(handleSaveTrip))
+	mux.HandleFunc("/api/save-profile", requireAuth(handleSaveProfile))
+	mux.HandleFunc("/api/check-onboarding", requireAuth(handleCheckOnboarding))
+	mux.HandleFunc("/api/my-trips", requireAuth(handleMyTrips))
+	mux.HandleFunc("/api/trips/{id}", requireAuth(handleTrip))
+	mux.HandleFunc("/api/trips/{id}/revisions", requireAuth(handleTripRevisions))
+	mux.HandleFunc("/api/trips/{id}/revisions/{version}", requireAuth(handleTripRevision))
+	mux.HandleFunc("/api/trips/{id}/revisions/{version}/restore", requireAuth(handleRestoreTripRevision))
+	mux.HandleFunc("/api/trips/{id}/diff", requireAuth(handleTripDiff))
+	mux.HandleFunc("/api/trips/{id}/bookings", requireAuth(handleTripBookings))
+	mux.HandleFunc("/api/trips/{id}/budget", requireAuth(handleTripBudget))
+	mux.HandleFunc("/api/trips/{id}/transfers", requireAuth(handleTripTransfers))
+	mux.HandleFunc("/api/trips/{id}/optimize", requireAuth(handleOptimizeTrip))
+	mux.HandleFunc("/api/trips/{id}/energy", requireAuth(handleTripEnergy))
+	mux.HandleFunc("/api/trips/{id}/energy/check-ins", requireAuth(handleEnergyCheckIns))
+	mux.HandleFunc("/api/trips/{id}/relief-points", requireAuth(handleTripReliefPoints))
+	mux.HandleFunc("/api/trips/{id}/publish", requireAuth(handlePublishTrip))
+	mux.HandleFunc("/api/prices", handlePrices)
+	mux.HandleFunc("/api/bookings", requireAuth(requireIdempotency(handleCreateBooking)))
+	mux.HandleFunc("/api/bookings/{id}", requireAuth(handleBooking))
+	mux.HandleFunc("/api/bookings/{id}/{action}", requireAuth(requireIdempotency(handleBookingAction)))
 	mux.HandleFunc("/api/public-trips", handlePublicTrips)
+	mux.HandleFunc("/api/public-trips/{id}", handlePublicTrip)
+	mux.HandleFunc("/api/public-trips/{id}/moderation", requireAuth(handleModeratePublicTrip))
+	mux.HandleFunc("/api/public-trips/{id}/fork", requireAuth(handleForkPublicTrip))
+	mux.HandleFunc("/api/public-trips/{id}/reviews", optionalAuth(handlePublicTripReviews))
+	mux.HandleFunc("/api/collections", optionalAuth(handleCollections))
+	mux.HandleFunc("/api/collections/{id}", optionalAuth(handleCollection))
+	mux.HandleFunc("/api/relief-points", optionalAuth(handleReliefPoints))
+	mux.HandleFunc("/api/relief-points/pending", requireAuth(handlePendingReliefPoints))
+	mux.HandleFunc("/api/relief-points/import", requireAuth(handleImportReliefPoints))
+	mux.HandleFunc("/api/relief-points/{id}/moderation", requireAuth(handleModerateReliefPoint))
 	mux.HandleFunc("/api/generate-checklist", handleGenerateChecklist)
-	mux.HandleFunc("/api/generate-comm-card", handleGenerateCommCard)
-	mux.HandleFunc("/api/sensory-profile", handleSensoryProfile)
-	mux.HandleFunc("/api/reshuffle-day", handleReshuffleDay)
+	mux.HandleFunc("/api/generate-comm-card", optionalAuth(handleGenerateCommCard))
+	mux.HandleFunc("/api/comm-cards/{id}", handleCommCard)
+	mux.HandleFunc("/api/comm-cards/{id}/{format}", handleCommCardExport)
+	mux.HandleFunc("/api/sensory-profile", optionalAuth(handleSensoryProfile))
+	mux.HandleFunc("/api/reshuffle-day", requireAuth(handleReshuffleDay))
 	mux.HandleFunc("/api/generate-script", handleGenerateScript)
 	mux.HandleFunc("/api/compose-hotel-request", handleComposeHotelRequest)
-	initFirebase()
+	initStorage()
+	initAuth()
+	initLLM()
+	initPrices()
+	initRates()
+	initBookings()
+	initRouting()
+	initSensory()
+	initCommCards()
 	fmt.Println("Backend engine with SUPER-SMART AI Brain is starting on port 8080...")
 	log.Fatal(http.ListenAndServe(":8080", corsMiddleware(mux)))
 }
@@ -106,32 +173,8 @@ func handleSaveTrip(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
-	ctx := context.Background()
-	// Get ID token from Authorization header
-	authHeader := r.Header.Get("Authorization")
-	if authHeader == "" || len(authHeader) < 8 {
-		http.Error(w, "Missing or invalid Authorization header", http.StatusUnauthorized)
-		return
-	}
-	idToken := authHeader[7:] // Remove 'Bearer '
-
-	// Verify ID token
-	app, err := firebase.NewApp(ctx, nil, option.WithCredentialsFile("serviceAccountKey.json"))
-	if err != nil {
-		http.Error(w, "Failed to init Firebase app", http.StatusInternalServerError)
-		return
-	}
-	client, err := app.Auth(ctx)
-	if err != nil {
-		http.Error(w, "Failed to get Auth client", http.StatusInternalServerError)
-		return
-	}
-	token, err := client.VerifyIDToken(ctx, idToken)
-	if err != nil {
-		http.Error(w, "Invalid ID token", http.StatusUnauthorized)
-		return
-	}
-	userId := token.UID
+	ctx := r.Context()
+	userId := userIDFrom(ctx)
 
 	// Read itinerary JSON from request body
 	body, err := io.ReadAll(r.Body)
@@ -140,26 +183,47 @@ func handleSaveTrip(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	var req struct {
-		Itinerary interface{} `json:"itinerary"`
+		Itinerary     Itinerary          `json:"itinerary"`
+		StartDate     string             `json:"startDate"`
+		EndDate       string             `json:"endDate"`
+		Accessibility *TripAccessibility `json:"accessibility"`
+		Budget        Money              `json:"budget"`
 	}
 	if err := json.Unmarshal(body, &req); err != nil {
 		http.Error(w, "Invalid JSON", http.StatusBadRequest)
 		return
 	}
-
-	// Save to Firestore
-	if firestoreClient != nil {
-		_, _, err := firestoreClient.Collection("trips").Add(ctx, map[string]interface{}{
-			"userId":    userId,
-			"itinerary": req.Itinerary,
-		})
-		if err != nil {
-			http.Error(w, "Failed to save itinerary to Firestore: "+err.Error(), http.StatusInternalServerError)
+	if req.Budget != (Money{}) {
+		if err := req.Budget.validate(); err != nil {
+			http.Error(w, "budget: "+err.Error(), http.StatusBadRequest)
 			return
 		}
 	}
-	w.WriteHeader(http.StatusOK)
-	w.Write([]byte("Saved"))
+	startDate, endDate, err := resolveTripDates(req.StartDate, req.EndDate, len(req.Itinerary.Itinerary))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	trip := &Trip{UserID: userId, Itinerary: req.Itinerary, StartDate: startDate, EndDate: endDate, Budget: req.Budget}
+
+	// Flag the trip with the traveller's needs unless the client says otherwise
+	if req.Accessibility != nil {
+		trip.Accessibility = *req.Accessibility
+	} else {
+		profile, err := profileStore.GetProfile(ctx, userId)
+		if err != nil && !errors.Is(err, ErrNotFound) {
+			log.Printf("Failed to load profile for %s: %v", userId, err)
+		}
+		trip.Accessibility = profileAccessibility(profile)
+	}
+
+	// Save to the trip store
+	if err := tripStore.CreateTrip(ctx, trip); err != nil {
+		http.Error(w, "Failed to save itinerary: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	// Return the stored trip so clients can link bookings and edits to its ID
+	writeTrip(w, trip)
 }
 
 func handleGenerate(w http.ResponseWriter, r *http.Request) {
@@ -169,43 +233,73 @@ func handleGenerate(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	tripIdea := string(body)
+	ceiling, err := budgetCeiling(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	optimize, err := queryFlag(r, "optimize")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
-	// Optionally get User ID from header (e.g., "X-User-Id")
-	userId := r.Header.Get("X-User-Id")
+	// Signed-in users get their profile applied and the trip saved
+	userId := userIDFrom(r.Context())
 
-	ctx := context.Background()
-	apiKey := os.Getenv("GEMINI_API_KEY")
-	client, err := genai.NewClient(ctx, option.WithAPIKey(apiKey))
-	if err != nil {
-		log.Fatal(err)
-	}
-	defer client.Close()
-
-	// Fetch user constraints from Firestore if userId is present
-	var mobility, sensory, dietary interface{}
-	if userId != "" && firestoreClient != nil {
-		userDoc, err := firestoreClient.Collection("users").Doc(userId).Get(ctx)
-		if err == nil {
-			mobility = userDoc.Data()["mobility"]
-			sensory = userDoc.Data()["sensory"]
-			dietary = userDoc.Data()["dietary"]
-		}
+	ctx := r.Context()
+	prompt := buildItineraryPrompt(ctx, userId, tripIdea)
+	var checks []itineraryCheck
+	if ceiling != nil {
+		prompt += budgetPrompt(*ceiling)
+		checks = append(checks, budgetCheck(ctx, *ceiling))
 	}
 
-	// Build constraints string for prompt
-	constraints := ""
-	if mobility != nil {
-		constraints += fmt.Sprintf("- Mobility: %v\n", mobility)
+	itinerary, err := generateItinerary(ctx, prompt, repairRetries(), checks...)
+	var verr *ItineraryValidationError
+	if errors.As(err, &verr) {
+		log.Printf("Itinerary rejected: %v", verr)
+		writeValidationError(w, verr)
+		return
 	}
-	if sensory != nil {
-		constraints += fmt.Sprintf("- Sensory: %v\n", sensory)
+	if err != nil {
+		http.Error(w, "The AI Brain is thinking too hard, try again!", http.StatusInternalServerError)
+		return
 	}
-	if dietary != nil {
-		constraints += fmt.Sprintf("- Dietary: %v\n", dietary)
+	if optimize {
+		optimizeItinerary(itinerary)
+	}
+	// Scored after optimizing, since reordering changes when each place is visited
+	if limits := sensoryLimitsFor(ctx, userId); limits != nil {
+		if over := enforceSensoryLimits(ctx, itinerary, *limits); over > 0 {
+			log.Printf("%d activities left over the sensory limits of %s", over, userId)
+		}
+	}
+	// Save to the trip store if userId is present
+	if err := saveGeneratedTrip(ctx, userId, itinerary); err != nil {
+		http.Error(w, "Failed to save itinerary: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(itinerary)
+}
+
+// buildItineraryPrompt turns the trip idea and the user's stored constraints into the generation prompt.
+func buildItineraryPrompt(ctx context.Context, userId, tripIdea string) string {
+	// Fetch user constraints if userId is present
+	var profile *Profile
+	if userId != "" {
+		p, err := profileStore.GetProfile(ctx, userId)
+		if err != nil && !errors.Is(err, ErrNotFound) {
+			log.Printf("Failed to load profile for %s: %v", userId, err)
+		}
+		profile = p
 	}
+	constraints := buildConstraints(profile)
 
 	// Sophisticated, constraint-based prompt
-	prompt := fmt.Sprintf(`
+	return fmt.Sprintf(`
 You are Auryvia, a compassionate AI travel assistant. Your primary goal is user safety, comfort, and joy. You MUST adhere to all constraints. Your output MUST be JSON.
 
 USER CONSTRAINTS:
@@ -214,38 +308,43 @@ USER REQUEST: "%s"
 
 Generate an itinerary that strictly follows every single constraint. The JSON object must follow this exact structure:
 {"tripTitle": "A Catchy Title", "destination": "City, Country", "itinerary": [{"day": 1, "title": "Arrival and Exploration", "activities": [{"time": "9:00 AM", "description": "Visit a famous landmark.", "category": "Sightseeing", "lat": 12.345, "lng": 67.890}]}]}
-`, constraints, tripIdea)
+Days are numbered 1, 2, 3... in order, times look like "9:00 AM", and every category is one of: %s.
+Activities may carry an estimated per-person "cost": {"amount": 12.5, "currency": "EUR"} using ISO 4217 codes.
+`, constraints, tripIdea, categoryList())
+}
 
-	model := client.GenerativeModel("gemini-1.5-flash")
-	model.GenerationConfig = genai.GenerationConfig{
-		ResponseMIMEType: "application/json",
+// buildConstraints renders a profile as the bullet list the prompts expect.
+func buildConstraints(profile *Profile) string {
+	if profile == nil {
+		return ""
 	}
-
-	resp, err := model.GenerateContent(ctx, genai.Text(prompt))
-	if err != nil {
-		http.Error(w, "The AI Brain is thinking too hard, try again!", http.StatusInternalServerError)
-		return
+	constraints := ""
+	if profile.Mobility != nil {
+		constraints += fmt.Sprintf("- Mobility: %+v\n", *profile.Mobility)
 	}
-
-	itineraryJSON := printResponse(resp)
-
-	// Save to Firestore if userId is present
-	if userId != "" && firestoreClient != nil {
-		_, _, err := firestoreClient.Collection("trips").Add(ctx, map[string]interface{}{
-			"userId":    userId,
-			"itinerary": itineraryJSON,
-		})
-		if err != nil {
-			log.Printf("Failed to save itinerary: %v", err)
-			http.Error(w, "Failed to save itinerary to Firestore: "+err.Error(), http.StatusInternalServerError)
-			return
-		} else {
-			log.Printf("Itinerary saved to Firestore for userId: %s", userId)
-		}
+	if profile.Sensory != nil {
+		constraints += fmt.Sprintf("- Sensory (0 = needs calm, 100 = handles anything): {Noise:%d Visual:%d}\n", profile.Sensory.Noise, profile.Sensory.Visual)
+	}
+	if profile.Energy != nil {
+		constraints += fmt.Sprintf("- Daily energy capacity: %d effort points, where 100 is a typical traveller's full day\n", profile.Energy.DailyCapacity)
+	}
+	if len(profile.Dietary) > 0 {
+		constraints += fmt.Sprintf("- Dietary: %s\n", strings.Join(profile.Dietary, ", "))
 	}
+	return constraints
+}
 
-	w.Header().Set("Content-Type", "application/json")
-	fmt.Fprintf(w, itineraryJSON)
+// saveGeneratedTrip stores a freshly generated itinerary for userId, if any.
+func saveGeneratedTrip(ctx context.Context, userId string, itinerary *Itinerary) error {
+	if userId == "" {
+		return nil
+	}
+	if err := tripStore.CreateTrip(ctx, &Trip{UserID: userId, Itinerary: *itinerary}); err != nil {
+		log.Printf("Failed to save itinerary: %v", err)
+		return err
+	}
+	log.Printf("Itinerary saved for userId: %s", userId)
+	return nil
 }
 
 func printResponse(resp *genai.GenerateContentResponse) string {
@@ -261,74 +360,6 @@ func printResponse(resp *genai.GenerateContentResponse) string {
 	return result
 }
 
-func handleMockPrices(w http.ResponseWriter, r *http.Request) {
-	if r.Method != "POST" {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-	type Req struct {
-		Destination string `json:"destination"`
-	}
-	var req Req
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid JSON", http.StatusBadRequest)
-		return
-	}
-
-	// Seed random for demo
-	rand.Seed(time.Now().UnixNano())
-
-	// Fake airlines and hotels
-	airlines := []string{"IndiGo", "Air India", "SpiceJet", "Vistara"}
-	hotels := []string{"Taj Palace", "Leela", "Oberoi", "ITC Grand"}
-
-	resp := map[string]interface{}{
-		"flights": map[string]interface{}{
-			"airline": airlines[rand.Intn(len(airlines))],
-			"price":   rand.Intn(8000) + 7000, // 7000-15000
-		},
-		"hotels": map[string]interface{}{
-			"name":            hotels[rand.Intn(len(hotels))],
-			"price_per_night": rand.Intn(4000) + 6000, // 6000-10000
-		},
-	}
-
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(resp)
-}
-
-func handlePublicTrips(w http.ResponseWriter, r *http.Request) {
-	if r.Method != "GET" {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-	ctx := context.Background()
-	if firestoreClient == nil {
-		http.Error(w, "Firestore not initialized", http.StatusInternalServerError)
-		return
-	}
-
-	iter := firestoreClient.Collection("trips").
-		Where("isPublic", "==", true).
-		OrderBy("createdAt", firestore.Desc).
-		Limit(10).
-		Documents(ctx)
-
-	var trips []map[string]interface{}
-	for {
-		doc, err := iter.Next()
-		if err != nil {
-			break
-		}
-		data := doc.Data()
-		data["id"] = doc.Ref.ID
-		trips = append(trips, data)
-	}
-
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(trips)
-}
-
 func handleGenerateChecklist(w http.ResponseWriter, r *http.Request) {
 	if r.Method != "POST" {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -344,14 +375,7 @@ func handleGenerateChecklist(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	ctx := context.Background()
-	apiKey := os.Getenv("GEMINI_API_KEY")
-	client, err := genai.NewClient(ctx, option.WithAPIKey(apiKey))
-	if err != nil {
-		http.Error(w, "AI error", http.StatusInternalServerError)
-		return
-	}
-	defer client.Close()
+	ctx := r.Context()
 
 	prompt := fmt.Sprintf(`
 You are Auryvia, a compassionate travel AI. Your job is to create a personalized pre-flight checklist for the user.
@@ -363,19 +387,14 @@ Checklist must be a JSON array of strings. Each item should be a clear, actionab
 Example: ["Pack noise-cancelling headphones", "Download offline map for step-free routes", "Prepare medication documents for customs"]
 `, req.Destination, req.TripTitle, req.Accessibility)
 
-	model := client.GenerativeModel("gemini-1.5-flash")
-	model.GenerationConfig = genai.GenerationConfig{
-		ResponseMIMEType: "application/json",
-	}
-
-	resp, err := model.GenerateContent(ctx, genai.Text(prompt))
+	resp, err := llm.GenerateJSON(ctx, LLMRequest{Task: taskChecklist, Prompt: prompt})
 	if err != nil {
 		http.Error(w, "AI error", http.StatusInternalServerError)
 		return
 	}
 
 	var checklist []string
-	if err := json.Unmarshal([]byte(printResponse(resp)), &checklist); err != nil {
+	if err := json.Unmarshal([]byte(resp), &checklist); err != nil {
 		http.Error(w, "Failed to parse checklist", http.StatusInternalServerError)
 		return
 	}
@@ -386,152 +405,6 @@ Example: ["Pack noise-cancelling headphones", "Download offline map for step-fre
 	})
 }
 
-func handleGenerateCommCard(w http.ResponseWriter, r *http.Request) {
-	if r.Method != "POST" {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-	var req struct {
-		Place    string `json:"place"`
-		Dietary  string `json:"dietary"`
-		Language string `json:"language"`
-	}
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid JSON", http.StatusBadRequest)
-		return
-	}
-
-	ctx := context.Background()
-	apiKey := os.Getenv("GEMINI_API_KEY")
-	client, err := genai.NewClient(ctx, option.WithAPIKey(apiKey))
-	if err != nil {
-		http.Error(w, "AI error", http.StatusInternalServerError)
-		return
-	}
-	defer client.Close()
-
-	prompt := fmt.Sprintf(`
-You are Auryvia, a compassionate travel AI. Generate a clear, professional communication card for a traveler with dietary needs.
-Place: %s
-Dietary: %s
-Language: %s
-
-First, output the message in English for staff. Then, output the same message translated into the target language in large, clear text for staff to read. Output as JSON: {"en": "...", "jp": "..."} 
-Example: {"en": "I have a severe gluten allergy (Celiac Disease). My food cannot contain any wheat, barley, or rye. Please ensure there is no cross-contamination.", "jp": "私は重度のグルテンアレルギー（セリアック病）です。小麦、大麦、ライ麦は一切含まないようにしてください。"}
-`, req.Place, req.Dietary, req.Language)
-
-	model := client.GenerativeModel("gemini-1.5-flash")
-	model.GenerationConfig = genai.GenerationConfig{
-		ResponseMIMEType: "application/json",
-	}
-
-	resp, err := model.GenerateContent(ctx, genai.Text(prompt))
-	if err != nil {
-		http.Error(w, "AI error", http.StatusInternalServerError)
-		return
-	}
-
-	var card struct {
-		En string `json:"en"`
-		Jp string `json:"jp"`
-	}
-	if err := json.Unmarshal([]byte(printResponse(resp)), &card); err != nil {
-		http.Error(w, "Failed to parse card", http.StatusInternalServerError)
-		return
-	}
-
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(card)
-}
-
-func handleSensoryProfile(w http.ResponseWriter, r *http.Request) {
-	if r.Method != "POST" {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-	var req struct {
-		Location string `json:"location"`
-	}
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid JSON", http.StatusBadRequest)
-		return
-	}
-
-	ctx := context.Background()
-	apiKey := os.Getenv("GEMINI_API_KEY")
-	client, err := genai.NewClient(ctx, option.WithAPIKey(apiKey))
-	if err != nil {
-		http.Error(w, "AI error", http.StatusInternalServerError)
-		return
-	}
-	defer client.Close()
-
-	prompt := fmt.Sprintf(`
-Act as a sensory data analyst. Analyze '%s' and generate a sensory profile. Consider noise from traffic, visual clutter from shops, and crowd density on a typical afternoon.
-Output JSON: {"audio": 1-100, "visual": 1-100, "crowds": 1-100, "summary": "Short descriptive paragraph."}
-`, req.Location)
-
-	model := client.GenerativeModel("gemini-1.5-flash")
-	model.GenerationConfig = genai.GenerationConfig{
-		ResponseMIMEType: "application/json",
-	}
-
-	resp, err := model.GenerateContent(ctx, genai.Text(prompt))
-	if err != nil {
-		http.Error(w, "AI error", http.StatusInternalServerError)
-		return
-	}
-
-	w.Header().Set("Content-Type", "application/json")
-	fmt.Fprint(w, printResponse(resp))
-}
-
-func handleReshuffleDay(w http.ResponseWriter, r *http.Request) {
-	if r.Method != "POST" {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-	var req struct {
-		Itinerary  interface{} `json:"itinerary"`
-		Constraint string      `json:"constraint"`
-	}
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid JSON", http.StatusBadRequest)
-		return
-	}
-
-	ctx := context.Background()
-	apiKey := os.Getenv("GEMINI_API_KEY")
-	client, err := genai.NewClient(ctx, option.WithAPIKey(apiKey))
-	if err != nil {
-		http.Error(w, "AI error", http.StatusInternalServerError)
-		return
-	}
-	defer client.Close()
-
-	prompt := fmt.Sprintf(`
-You are Auryvia, a compassionate travel AI. The user is feeling tired and needs a low-energy day.
-Given this itinerary: %v
-Constraint: %s
-
-Suggest a single, relaxing replacement activity for the most demanding item on the list. Output JSON: {"replace": "original activity", "suggestion": "relaxing alternative"}
-`, req.Itinerary, req.Constraint)
-
-	model := client.GenerativeModel("gemini-1.5-flash")
-	model.GenerationConfig = genai.GenerationConfig{
-		ResponseMIMEType: "application/json",
-	}
-
-	resp, err := model.GenerateContent(ctx, genai.Text(prompt))
-	if err != nil {
-		http.Error(w, "AI error", http.StatusInternalServerError)
-		return
-	}
-
-	w.Header().Set("Content-Type", "application/json")
-	fmt.Fprint(w, printResponse(resp))
-}
-
 func handleGenerateScript(w http.ResponseWriter, r *http.Request) {
 	if r.Method != "POST" {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -545,14 +418,7 @@ func handleGenerateScript(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	ctx := context.Background()
-	apiKey := os.Getenv("GEMINI_API_KEY")
-	client, err := genai.NewClient(ctx, option.WithAPIKey(apiKey))
-	if err != nil {
-		http.Error(w, "AI error", http.StatusInternalServerError)
-		return
-	}
-	defer client.Close()
+	ctx := r.Context()
 
 	prompt := fmt.Sprintf(`
 You are Auryvia, a compassionate travel AI. Generate a simple, step-by-step social script for the following context: %s.
@@ -564,19 +430,14 @@ Output JSON: {"user": ["..."], "staff": ["..."], "tips": "..." }
 Example: {"user": ["I'd like to order pasta, please.", "Could I have the bill?"], "staff": ["Of course, which pasta would you like?", "Here is your bill."], "tips": "In Rome, it's polite to greet staff with 'Buonasera' and ask for the bill by saying 'Il conto, per favore.'}
 `, req.Context)
 
-	model := client.GenerativeModel("gemini-1.5-flash")
-	model.GenerationConfig = genai.GenerationConfig{
-		ResponseMIMEType: "application/json",
-	}
-
-	resp, err := model.GenerateContent(ctx, genai.Text(prompt))
+	resp, err := llm.GenerateJSON(ctx, LLMRequest{Task: taskScript, Prompt: prompt})
 	if err != nil {
 		http.Error(w, "AI error", http.StatusInternalServerError)
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	fmt.Fprint(w, printResponse(resp))
+	fmt.Fprint(w, resp)
 }
 
 func handleComposeHotelRequest(w http.ResponseWriter, r *http.Request) {
@@ -593,14 +454,7 @@ func handleComposeHotelRequest(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	ctx := context.Background()
-	apiKey := os.Getenv("GEMINI_API_KEY")
-	client, err := genai.NewClient(ctx, option.WithAPIKey(apiKey))
-	if err != nil {
-		http.Error(w, "AI error", http.StatusInternalServerError)
-		return
-	}
-	defer client.Close()
+	ctx := r.Context()
 
 	prompt := fmt.Sprintf(`
 You are Auryvia, a compassionate travel AI. Compose a perfectly worded email for a hotel amenity request.
@@ -611,12 +465,7 @@ The email should be polite, clear, and specific. Include a greeting, the user's
 Example: {"email": "Dear Hotel Team,\nI am looking forward to my upcoming stay. I have a few requests to ensure my comfort: unscented products, a low floor room, and a fridge for medication. Thank you for your understanding and support.\nBest regards,\n[Your Name]}
 `, req.Hotel, req.Needs)
 
-	model := client.GenerativeModel("gemini-1.5-flash")
-	model.GenerationConfig = genai.GenerationConfig{
-		ResponseMIMEType: "application/json",
-	}
-
-	resp, err := model.GenerateContent(ctx, genai.Text(prompt))
+	resp, err := llm.GenerateJSON(ctx, LLMRequest{Task: taskHotelRequest, Prompt: prompt})
 	if err != nil {
 		http.Error(w, "AI error", http.StatusInternalServerError)
 		return
@@ -625,7 +474,7 @@ Example: {"email": "Dear Hotel Team,\nI am looking forward to my upcoming stay.
 	var result struct {
 		Email string `json:"email"`
 	}
-	if err := json.Unmarshal([]byte(printResponse(resp)), &result); err != nil {
+	if err := json.Unmarshal([]byte(resp), &result); err != nil {
 		http.Error(w, "Failed to parse email", http.StatusInternalServerError)
 		return
 	}
@@ -0,0 +1,30 @@
+package main
+
+import "testing"
+
+// setGlobal points a package global at value until the test ends.
+func setGlobal[T any](t testing.TB, global *T, value T) {
+	t.Helper()
+	old := *global
+	*global = value
+	t.Cleanup(func() { *global = old })
+}
+
+// useMemoryStore backs every store with one fresh MemoryStore until the
+// test ends, as STORAGE_BACKEND=memory does.
+func useMemoryStore(t testing.TB) *MemoryStore {
+	t.Helper()
+	store := NewMemoryStore()
+	setGlobal[TripStore](t, &tripStore, store)
+	setGlobal[ProfileStore](t, &profileStore, store)
+	setGlobal[PublicTripStore](t, &publicTripStore, store)
+	setGlobal[CollectionStore](t, &collectionStore, store)
+	setGlobal[ReviewStore](t, &reviewStore, store)
+	setGlobal[EnergyStore](t, &energyStore, store)
+	setGlobal[ReliefPointStore](t, &reliefStore, store)
+	setGlobal[SensoryProfileStore](t, &sensoryStore, store)
+	setGlobal[CommCardStore](t, &commCardStore, store)
+	setGlobal[BookingStore](t, &bookingStore, store)
+	setGlobal[IdempotencyStore](t, &idempotencyStore, store)
+	return store
+}
@@ -0,0 +1,341 @@
+// backend/optimize.go
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// mealWindowMinutes is how far a meal may move from the time the model gave it.
+const mealWindowMinutes = 90
+
+// anchoredCategories never move: trains, flights and check-ins keep their slot.
+var anchoredCategories = map[string]bool{
+	"transport":     true,
+	"accommodation": true,
+}
+
+// TimeWindow bounds when an activity may start. Either end may be left out.
+type TimeWindow struct {
+	ActivityIndex int    `json:"activityIndex"`
+	NotBefore     string `json:"notBefore,omitempty"`
+	NotAfter      string `json:"notAfter,omitempty"`
+}
+
+// DayOptimization reports how a day was reordered.
+type DayOptimization struct {
+	Day          int    `json:"day"`
+	Order        []int  `json:"order"` // original activity indices in their new order
+	BeforeMeters int    `json:"beforeMeters"`
+	AfterMeters  int    `json:"afterMeters"`
+	Changed      bool   `json:"changed"`
+	Skipped      string `json:"skipped,omitempty"` // why the day was left as it was
+}
+
+// window is a parsed TimeWindow; a zero end is open.
+type window struct{ notBefore, notAfter time.Time }
+
+func (w window) allows(t time.Time) bool {
+	return (w.notBefore.IsZero() || !t.Before(w.notBefore)) && (w.notAfter.IsZero() || !t.After(w.notAfter))
+}
+
+// dayRoute is the working state of one day's optimization. Positions are the
+// day's time slots in chronological order; order[p] is the activity in slot p.
+type dayRoute struct {
+	acts    []Activity
+	slots   []time.Time
+	fixed   []bool // slot p must keep its activity
+	windows map[int]window
+}
+
+func (dr *dayRoute) dist(a, b int) float64 {
+	return haversineMeters(LatLng{dr.acts[a].Lat, dr.acts[a].Lng}, LatLng{dr.acts[b].Lat, dr.acts[b].Lng})
+}
+
+func (dr *dayRoute) cost(order []int) float64 {
+	total := 0.0
+	for p := 1; p < len(order); p++ {
+		total += dr.dist(order[p-1], order[p])
+	}
+	return total
+}
+
+func (dr *dayRoute) fits(a, p int) bool {
+	w, ok := dr.windows[a]
+	return !ok || w.allows(dr.slots[p])
+}
+
+func (dr *dayRoute) feasible(order []int) bool {
+	for p, a := range order {
+		if !dr.fits(a, p) {
+			return false
+		}
+	}
+	return true
+}
+
+// nearestNeighbour fills the free slots in time order, each with the closest
+// unplaced activity allowed there. It returns nil when it paints itself into
+// a corner with an activity no remaining slot can take.
+func (dr *dayRoute) nearestNeighbour(baseline []int) []int {
+	order := make([]int, len(baseline))
+	placed := make(map[int]bool)
+	for p, a := range baseline {
+		if dr.fixed[p] {
+			order[p] = a
+			placed[a] = true
+		}
+	}
+	for p := range order {
+		if dr.fixed[p] {
+			continue
+		}
+		best, bestDist := -1, math.Inf(1)
+		for _, a := range baseline {
+			if placed[a] || !dr.fits(a, p) {
+				continue
+			}
+			d := 0.0
+			if p > 0 {
+				d = dr.dist(order[p-1], a)
+			} else if a != baseline[0] {
+				// Nothing to measure from yet, so keep the model's first pick if we can.
+				d = 1
+			}
+			if d < bestDist {
+				best, bestDist = a, d
+			}
+		}
+		if best < 0 {
+			return nil
+		}
+		order[p] = best
+		placed[best] = true
+	}
+	return order
+}
+
+// twoOpt reverses runs of free slots while that shortens the day and every
+// window still holds. Runs never cross a fixed slot.
+func (dr *dayRoute) twoOpt(order []int) []int {
+	best := dr.cost(order)
+	for improved := true; improved; {
+		improved = false
+		for i := 0; i < len(order)-1; i++ {
+			if dr.fixed[i] {
+				continue
+			}
+			for j := i + 1; j < len(order) && !dr.fixed[j]; j++ {
+				candidate := append([]int(nil), order...)
+				for l, r := i, j; l < r; l, r = l+1, r-1 {
+					candidate[l], candidate[r] = candidate[r], candidate[l]
+				}
+				if c := dr.cost(candidate); c < best-1e-6 && dr.feasible(candidate) {
+					order, best, improved = candidate, c, true
+				}
+			}
+		}
+	}
+	return order
+}
+
+// optimizeDay reorders the flexible activities of day to shorten the distance
+// travelled. Time slots stay where they are; activities move between them.
+// Locked activities, anchored categories and activities without coordinates
+// keep their slot, meals stay within mealWindowMinutes of their time, and
+// windows (keyed by activity index) bound the rest. The day is only changed
+// when a shorter order meets every window.
+func optimizeDay(day *Day, locked map[int]bool, windows map[int]window) DayOptimization {
+	result := DayOptimization{Day: day.Day, Order: []int{}}
+	n := len(day.Activities)
+	dr := &dayRoute{acts: day.Activities, windows: make(map[int]window)}
+	times := make([]time.Time, n)
+	baseline := make([]int, n)
+	for i, act := range day.Activities {
+		t, err := parseActivityTime(act.Time)
+		if err != nil {
+			result.Skipped = fmt.Sprintf("activity %d has an unreadable time %q", i, act.Time)
+			return result
+		}
+		times[i], baseline[i] = t, i
+		if strings.EqualFold(act.Category, "food") {
+			dr.windows[i] = window{t.Add(-mealWindowMinutes * time.Minute), t.Add(mealWindowMinutes * time.Minute)}
+		}
+	}
+	for i, w := range windows {
+		dr.windows[i] = w
+	}
+	sort.SliceStable(baseline, func(x, y int) bool { return times[baseline[x]].Before(times[baseline[y]]) })
+	dr.slots = make([]time.Time, n)
+	dr.fixed = make([]bool, n)
+	for p, a := range baseline {
+		act := day.Activities[a]
+		dr.slots[p] = times[a]
+		dr.fixed[p] = act.Locked || locked[a] || anchoredCategories[strings.ToLower(act.Category)] || (act.Lat == 0 && act.Lng == 0)
+	}
+	result.Order = baseline
+	result.BeforeMeters = int(math.Round(dr.cost(baseline)))
+	result.AfterMeters = result.BeforeMeters
+
+	order := dr.nearestNeighbour(baseline)
+	if order == nil {
+		if !dr.feasible(baseline) {
+			result.Skipped = "no order meets every time window"
+			return result
+		}
+		order = baseline
+	}
+	order = dr.twoOpt(order)
+	cost := dr.cost(order)
+	if dr.feasible(baseline) && cost >= dr.cost(baseline)-1e-6 {
+		return result
+	}
+
+	reordered := make([]Activity, n)
+	for p, a := range order {
+		reordered[p] = day.Activities[a]
+		reordered[p].Time = day.Activities[baseline[p]].Time
+	}
+	day.Activities = reordered
+	result.Order = order
+	result.AfterMeters = int(math.Round(cost))
+	for p := range order {
+		if order[p] != baseline[p] {
+			result.Changed = true
+		}
+	}
+	return result
+}
+
+// optimizeItinerary reorders every day with the default rules only. It is the
+// optional post-processing step of the generate endpoints (?optimize=true).
+func optimizeItinerary(it *Itinerary) []DayOptimization {
+	results := []DayOptimization{}
+	for i := range it.Itinerary {
+		results = append(results, optimizeDay(&it.Itinerary[i], nil, nil))
+	}
+	return results
+}
+
+// optimizeRequest is the body of POST /api/trips/{id}/optimize.
+type optimizeRequest struct {
+	Day     int          `json:"day"` // 0 optimizes every day
+	Locked  []int        `json:"locked"`
+	Windows []TimeWindow `json:"windows"`
+	Apply   bool         `json:"apply"`
+}
+
+// parse checks the request against it and returns the locks and windows of the chosen day.
+func (req *optimizeRequest) parse(it *Itinerary) (map[int]bool, map[int]window, error) {
+	if req.Day == 0 {
+		if len(req.Locked) > 0 || len(req.Windows) > 0 {
+			return nil, nil, errors.New("locked and windows need a day")
+		}
+		return nil, nil, nil
+	}
+	if req.Day < 1 || req.Day > len(it.Itinerary) {
+		return nil, nil, fmt.Errorf("trip has no day %d", req.Day)
+	}
+	n := len(it.Itinerary[req.Day-1].Activities)
+	locked := make(map[int]bool)
+	for _, i := range req.Locked {
+		if i < 0 || i >= n {
+			return nil, nil, fmt.Errorf("locked: day %d has no activity %d", req.Day, i)
+		}
+		locked[i] = true
+	}
+	windows := make(map[int]window)
+	for k, tw := range req.Windows {
+		where := fmt.Sprintf("windows[%d]", k)
+		if tw.ActivityIndex < 0 || tw.ActivityIndex >= n {
+			return nil, nil, fmt.Errorf("%s: day %d has no activity %d", where, req.Day, tw.ActivityIndex)
+		}
+		var w window
+		var err error
+		if tw.NotBefore != "" {
+			if w.notBefore, err = parseActivityTime(tw.NotBefore); err != nil {
+				return nil, nil, fmt.Errorf("%s: notBefore: %v", where, err)
+			}
+		}
+		if tw.NotAfter != "" {
+			if w.notAfter, err = parseActivityTime(tw.NotAfter); err != nil {
+				return nil, nil, fmt.Errorf("%s: notAfter: %v", where, err)
+			}
+		}
+		if !w.notBefore.IsZero() && !w.notAfter.IsZero() && w.notAfter.Before(w.notBefore) {
+			return nil, nil, fmt.Errorf("%s: notAfter is before notBefore", where)
+		}
+		windows[tw.ActivityIndex] = w
+	}
+	return locked, windows, nil
+}
+
+// handleOptimizeTrip reorders the activities of one day, or of every day, to
+// cut the distance travelled. Body: {"day": 1, "locked": [0], "windows":
+// [{"activityIndex": 2, "notBefore": "11:00 AM", "notAfter": "2:00 PM"}],
+// "apply": false}. Without apply it only previews the new order; with apply
+// the result is saved as a new revision (If-Match honoured).
+func handleOptimizeTrip(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var req optimizeRequest
+	if r.ContentLength != 0 {
+		dec := json.NewDecoder(r.Body)
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&req); err != nil {
+			http.Error(w, "Invalid JSON: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	ctx := r.Context()
+	trip, err := loadOwnedTrip(ctx, r.PathValue("id"), userIDFrom(ctx))
+	if err != nil {
+		writeTripError(w, err)
+		return
+	}
+	locked, windows, err := req.parse(&trip.Itinerary)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	optimize := func(it *Itinerary) []DayOptimization {
+		if req.Day == 0 {
+			return optimizeItinerary(it)
+		}
+		return []DayOptimization{optimizeDay(&it.Itinerary[req.Day-1], locked, windows)}
+	}
+	if !req.Apply {
+		days := optimize(&trip.Itinerary)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"days": days, "itinerary": trip.Itinerary})
+		return
+	}
+
+	// Indices in the request refer to the version just loaded.
+	loaded := trip.Version
+	var days []DayOptimization
+	trip, err = updateOwnedTrip(r, trip.ID, revisionOptimize, func(t *Trip) error {
+		if t.Version != loaded {
+			return errVersionConflict
+		}
+		days = optimize(&t.Itinerary)
+		return nil
+	})
+	if err != nil {
+		writeTripError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", fmt.Sprintf(`"%d"`, trip.Version))
+	json.NewEncoder(w).Encode(map[string]interface{}{"days": days, "trip": trip})
+}
@@ -0,0 +1,307 @@
+// backend/prices.go
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"math"
+	"math/rand"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	maxTravellers   = 9
+	offersPerSearch = 3
+)
+
+// PriceQuery is what a traveller asks prices for. Dates are "2006-01-02" and optional.
+type PriceQuery struct {
+	Origin      string `json:"origin" firestore:"origin"`
+	Destination string `json:"destination" firestore:"destination"`
+	DepartDate  string `json:"departDate,omitempty" firestore:"departDate,omitempty"`
+	ReturnDate  string `json:"returnDate,omitempty" firestore:"returnDate,omitempty"`
+	Travellers  int    `json:"travellers" firestore:"travellers"`
+}
+
+// This is the blueprint for one flight offer. Price covers every traveller.
+type FlightOffer struct {
+	ID          string  `json:"id"`
+	Airline     string  `json:"airline"`
+	Flight      string  `json:"flight"`
+	Origin      string  `json:"origin"`
+	Destination string  `json:"destination"`
+	DepartDate  string  `json:"departDate,omitempty"`
+	ReturnDate  string  `json:"returnDate,omitempty"`
+	Stops       int     `json:"stops"`
+	Price       float64 `json:"price"`
+	Currency    string  `json:"currency"`
+}
+
+// This is the blueprint for one hotel offer. TotalPrice covers every night.
+type HotelOffer struct {
+	ID            string  `json:"id"`
+	Name          string  `json:"name"`
+	Stars         int     `json:"stars"`
+	Nights        int     `json:"nights"`
+	PricePerNight float64 `json:"pricePerNight"`
+	TotalPrice    float64 `json:"totalPrice"`
+	Currency      string  `json:"currency"`
+}
+
+// PriceQuote is a provider's answer, offers sorted cheapest first.
+type PriceQuote struct {
+	Query    PriceQuery    `json:"query"`
+	Provider string        `json:"provider"`
+	Flights  []FlightOffer `json:"flights"`
+	Hotels   []HotelOffer  `json:"hotels"`
+}
+
+// PriceProvider is the blueprint for every source of flight and hotel prices.
+type PriceProvider interface {
+	Quote(ctx context.Context, q PriceQuery) (*PriceQuote, error)
+}
+
+var prices PriceProvider
+
+// initPrices picks a provider from PRICE_PROVIDER: "fixture" (default) or "http".
+func initPrices() {
+	switch name := strings.ToLower(os.Getenv("PRICE_PROVIDER")); name {
+	case "", "fixture":
+		seed, err := strconv.ParseInt(envOr("PRICE_FIXTURE_SEED", "1"), 10, 64)
+		if err != nil {
+			log.Fatalf("PRICE_FIXTURE_SEED must be an integer: %v", err)
+		}
+		prices = &FixturePriceProvider{Seed: seed}
+	case "http":
+		baseURL := os.Getenv("PRICE_PROVIDER_URL")
+		if baseURL == "" {
+			log.Fatalf("PRICE_PROVIDER_URL is required for the http price provider")
+		}
+		prices = NewHTTPPriceProvider(baseURL)
+	default:
+		log.Fatalf("unknown PRICE_PROVIDER %q", name)
+	}
+}
+
+// normalize validates q and fills in defaults.
+func (q *PriceQuery) normalize() error {
+	q.Origin = strings.TrimSpace(q.Origin)
+	q.Destination = strings.TrimSpace(q.Destination)
+	if q.Destination == "" {
+		return errors.New("destination is required")
+	}
+	if q.Travellers == 0 {
+		q.Travellers = 1
+	}
+	if q.Travellers < 0 || q.Travellers > maxTravellers {
+		return fmt.Errorf("travellers must be between 1 and %d", maxTravellers)
+	}
+	if q.DepartDate == "" && q.ReturnDate != "" {
+		return errors.New("returnDate requires a departDate")
+	}
+	if q.DepartDate != "" {
+		if _, err := time.Parse(tripDateLayout, q.DepartDate); err != nil {
+			return fmt.Errorf("departDate %q must look like 2006-01-02", q.DepartDate)
+		}
+	}
+	if q.ReturnDate != "" {
+		if _, err := time.Parse(tripDateLayout, q.ReturnDate); err != nil {
+			return fmt.Errorf("returnDate %q must look like 2006-01-02", q.ReturnDate)
+		}
+		if q.ReturnDate < q.DepartDate {
+			return errors.New("returnDate is before departDate")
+		}
+	}
+	return nil
+}
+
+// nights is the hotel stay length; one night when the dates are unknown.
+func (q PriceQuery) nights() int {
+	if q.DepartDate == "" || q.ReturnDate == "" {
+		return 1
+	}
+	start, _ := time.Parse(tripDateLayout, q.DepartDate)
+	end, _ := time.Parse(tripDateLayout, q.ReturnDate)
+	return max(int(end.Sub(start).Hours()/24), 1)
+}
+
+// FixturePriceProvider makes up plausible offers. The same seed and query
+// always give the same offers, so demos and tests are reproducible.
+type FixturePriceProvider struct {
+	Seed int64
+}
+
+var (
+	fixtureAirlines = []struct{ Name, Code string }{
+		{"SkyLine Air", "SL"}, {"Meridian Airways", "MR"}, {"Horizon Connect", "HZ"},
+		{"Azure Wings", "AW"}, {"Northwind", "NW"}, {"Coastal Jet", "CJ"},
+	}
+	fixtureHotelPatterns = []string{
+		"%s Grand Hotel", "Hotel Central %s", "The %s Garden Inn",
+		"%s Riverside Suites", "Quiet Corner %s", "%s Station Hotel",
+	}
+	// fixtureCurrencies maps a destination country (the last part of the
+	// destination) to its currency and roughly how many units make one USD.
+	fixtureCurrencies = map[string]struct {
+		Code  string
+		Scale float64
+	}{
+		"japan":          {"JPY", 150},
+		"india":          {"INR", 83},
+		"france":         {"EUR", 0.92},
+		"italy":          {"EUR", 0.92},
+		"spain":          {"EUR", 0.92},
+		"germany":        {"EUR", 0.92},
+		"united kingdom": {"GBP", 0.79},
+		"uk":             {"GBP", 0.79},
+		"thailand":       {"THB", 36},
+		"australia":      {"AUD", 1.5},
+		"canada":         {"CAD", 1.36},
+	}
+)
+
+// fixtureCurrency guesses the local currency from "City, Country", defaulting to USD.
+func fixtureCurrency(destination string) (string, float64) {
+	parts := strings.Split(destination, ",")
+	country := strings.ToLower(strings.TrimSpace(parts[len(parts)-1]))
+	if c, ok := fixtureCurrencies[country]; ok {
+		return c.Code, c.Scale
+	}
+	return "USD", 1
+}
+
+func (f *FixturePriceProvider) rng(q PriceQuery) *rand.Rand {
+	h := fnv.New64a()
+	fmt.Fprintf(h, "%d|%s|%s|%s|%s|%d", f.Seed, strings.ToLower(q.Origin), strings.ToLower(q.Destination),
+		q.DepartDate, q.ReturnDate, q.Travellers)
+	return rand.New(rand.NewSource(int64(h.Sum64())))
+}
+
+func (f *FixturePriceProvider) Quote(ctx context.Context, q PriceQuery) (*PriceQuote, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	rng := f.rng(q)
+	currency, scale := fixtureCurrency(q.Destination)
+	city := strings.TrimSpace(strings.Split(q.Destination, ",")[0])
+	quote := &PriceQuote{Query: q, Provider: "fixture", Flights: []FlightOffer{}}
+
+	// Prices are rounded to whole units, which reads naturally in every fixture currency.
+	if q.Origin != "" {
+		for i, a := range rng.Perm(len(fixtureAirlines))[:offersPerSearch] {
+			airline := fixtureAirlines[a]
+			fare := 180 + rng.Float64()*720 // USD per traveller
+			stops := rng.Intn(2)
+			quote.Flights = append(quote.Flights, FlightOffer{
+				ID:          fmt.Sprintf("fx-fl-%d-%d", i, a),
+				Airline:     airline.Name,
+				Flight:      fmt.Sprintf("%s%d", airline.Code, 100+rng.Intn(900)),
+				Origin:      q.Origin,
+				Destination: q.Destination,
+				DepartDate:  q.DepartDate,
+				ReturnDate:  q.ReturnDate,
+				Stops:       stops,
+				Price:       math.Round(fare * float64(q.Travellers) * scale * (1 - 0.15*float64(stops))),
+				Currency:    currency,
+			})
+		}
+	}
+
+	nights := q.nights()
+	for i, p := range rng.Perm(len(fixtureHotelPatterns))[:offersPerSearch] {
+		stars := 3 + rng.Intn(3)
+		nightly := math.Round((40 + float64(stars)*25 + rng.Float64()*60) * scale)
+		quote.Hotels = append(quote.Hotels, HotelOffer{
+			ID:            fmt.Sprintf("fx-ht-%d-%d", i, p),
+			Name:          fmt.Sprintf(fixtureHotelPatterns[p], city),
+			Stars:         stars,
+			Nights:        nights,
+			PricePerNight: nightly,
+			TotalPrice:    nightly * float64(nights),
+			Currency:      currency,
+		})
+	}
+
+	sort.Slice(quote.Flights, func(i, j int) bool { return quote.Flights[i].Price < quote.Flights[j].Price })
+	sort.Slice(quote.Hotels, func(i, j int) bool { return quote.Hotels[i].TotalPrice < quote.Hotels[j].TotalPrice })
+	return quote, nil
+}
+
+// HTTPPriceProvider asks an external adapter for quotes: POST {baseURL}/quotes
+// with a PriceQuery, answered with a PriceQuote. GDS and aggregator adapters
+// sit behind this contract, and a local stand-in can serve it during development.
+type HTTPPriceProvider struct {
+	baseURL string
+	http    *http.Client
+}
+
+func NewHTTPPriceProvider(baseURL string) *HTTPPriceProvider {
+	return &HTTPPriceProvider{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		http:    &http.Client{Timeout: 20 * time.Second},
+	}
+}
+
+func (h *HTTPPriceProvider) Quote(ctx context.Context, q PriceQuery) (*PriceQuote, error) {
+	body, err := json.Marshal(q)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", h.baseURL+"/quotes", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := h.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("price provider returned %s", resp.Status)
+	}
+	var quote PriceQuote
+	if err := json.NewDecoder(resp.Body).Decode(&quote); err != nil {
+		return nil, fmt.Errorf("decoding price quote: %w", err)
+	}
+	quote.Query = q
+	return &quote, nil
+}
+
+// handlePrices returns flight and hotel offers for a PriceQuery.
+func handlePrices(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var q PriceQuery
+	if err := json.NewDecoder(r.Body).Decode(&q); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if err := q.normalize(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	quote, err := prices.Quote(r.Context(), q)
+	if err != nil {
+		log.Printf("Price lookup failed for %q: %v", q.Destination, err)
+		http.Error(w, "Failed to load prices", http.StatusBadGateway)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(quote)
+}
@@ -0,0 +1,203 @@
+// backend/profile.go
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	maxDietaryItems      = 20
+	maxDietaryLength     = 60
+	maxDisplayNameLength = 60
+)
+
+// ProfileUpdate is a partial profile: only the fields that are present are changed.
+type ProfileUpdate struct {
+	Mobility *struct {
+		Wheelchair    *bool `json:"wheelchair"`
+		AvoidStairs   *bool `json:"avoidStairs"`
+		FrequentRests *bool `json:"frequentRests"`
+	} `json:"mobility"`
+	Sensory *struct {
+		Noise  *int  `json:"noise"`
+		Visual *int  `json:"visual"`
+		Limits *bool `json:"limits"`
+	} `json:"sensory"`
+	Energy *struct {
+		DailyCapacity *int `json:"dailyCapacity"`
+	} `json:"energy"`
+	Dietary      *[]string `json:"dietary"`
+	HomeCurrency *string   `json:"homeCurrency"`
+	DisplayName  *string   `json:"displayName"`
+}
+
+// validate checks ranges and cleans up the dietary tags in place.
+func (u *ProfileUpdate) validate() error {
+	if u.Sensory != nil {
+		if err := checkPercent("sensory.noise", u.Sensory.Noise); err != nil {
+			return err
+		}
+		if err := checkPercent("sensory.visual", u.Sensory.Visual); err != nil {
+			return err
+		}
+	}
+	if e := u.Energy; e != nil && e.DailyCapacity != nil && (*e.DailyCapacity < minDailyCapacity || *e.DailyCapacity > maxDailyCapacity) {
+		return fmt.Errorf("energy.dailyCapacity must be between %d and %d", minDailyCapacity, maxDailyCapacity)
+	}
+	if u.Dietary != nil {
+		seen := make(map[string]bool)
+		var cleaned []string
+		for _, tag := range *u.Dietary {
+			tag = strings.TrimSpace(tag)
+			if tag == "" || seen[strings.ToLower(tag)] {
+				continue
+			}
+			if len(tag) > maxDietaryLength {
+				return fmt.Errorf("dietary entries must be at most %d characters", maxDietaryLength)
+			}
+			seen[strings.ToLower(tag)] = true
+			cleaned = append(cleaned, tag)
+		}
+		if len(cleaned) > maxDietaryItems {
+			return fmt.Errorf("at most %d dietary entries are allowed", maxDietaryItems)
+		}
+		*u.Dietary = cleaned
+	}
+	if u.HomeCurrency != nil {
+		*u.HomeCurrency = strings.ToUpper(strings.TrimSpace(*u.HomeCurrency))
+		if *u.HomeCurrency != "" {
+			if err := validateCurrency(*u.HomeCurrency); err != nil {
+				return fmt.Errorf("homeCurrency: %w", err)
+			}
+		}
+	}
+	if u.DisplayName != nil {
+		*u.DisplayName = strings.TrimSpace(*u.DisplayName)
+		if len(*u.DisplayName) > maxDisplayNameLength {
+			return fmt.Errorf("displayName must be at most %d characters", maxDisplayNameLength)
+		}
+	}
+	return nil
+}
+
+// apply merges the update into profile.
+func (u *ProfileUpdate) apply(profile *Profile) {
+	if m := u.Mobility; m != nil {
+		if profile.Mobility == nil {
+			profile.Mobility = &MobilityPrefs{}
+		}
+		setBool(&profile.Mobility.Wheelchair, m.Wheelchair)
+		setBool(&profile.Mobility.AvoidStairs, m.AvoidStairs)
+		setBool(&profile.Mobility.FrequentRests, m.FrequentRests)
+	}
+	if s := u.Sensory; s != nil {
+		if profile.Sensory == nil {
+			profile.Sensory = &SensoryPrefs{}
+		}
+		setInt(&profile.Sensory.Noise, s.Noise)
+		setInt(&profile.Sensory.Visual, s.Visual)
+		setBool(&profile.Sensory.Limits, s.Limits)
+	}
+	if e := u.Energy; e != nil {
+		if profile.Energy == nil {
+			profile.Energy = &EnergyPrefs{DailyCapacity: defaultDailyCapacity}
+		}
+		setInt(&profile.Energy.DailyCapacity, e.DailyCapacity)
+	}
+	if u.Dietary != nil {
+		profile.Dietary = *u.Dietary
+	}
+	if u.HomeCurrency != nil {
+		profile.HomeCurrency = *u.HomeCurrency
+	}
+	if u.DisplayName != nil {
+		profile.DisplayName = *u.DisplayName
+	}
+}
+
+func checkPercent(name string, v *int) error {
+	if v != nil && (*v < 0 || *v > 100) {
+		return fmt.Errorf("%s must be between 0 and 100", name)
+	}
+	return nil
+}
+
+func setBool(dst *bool, v *bool) {
+	if v != nil {
+		*dst = *v
+	}
+}
+
+func setInt(dst *int, v *int) {
+	if v != nil {
+		*dst = *v
+	}
+}
+
+// handleSaveProfile stores the caller's accessibility profile. Both POST and
+// PATCH are partial: fields left out of the body keep their stored value.
+func handleSaveProfile(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" && r.Method != "PATCH" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	userId := userIDFrom(r.Context())
+
+	var update ProfileUpdate
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&update); err != nil {
+		http.Error(w, "Invalid JSON: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := update.validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	profile, err := profileStore.UpdateProfile(r.Context(), userId, func(p *Profile) error {
+		update.apply(p)
+		if p.OnboardedAt == nil {
+			now := time.Now().UTC()
+			p.OnboardedAt = &now
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("Failed to save profile for %s: %v", userId, err)
+		http.Error(w, "Failed to save profile", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(profile)
+}
+
+// handleCheckOnboarding tells the frontend whether the caller still needs the onboarding flow.
+func handleCheckOnboarding(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	userId := userIDFrom(r.Context())
+
+	profile, err := profileStore.GetProfile(r.Context(), userId)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		log.Printf("Failed to load profile for %s: %v", userId, err)
+		http.Error(w, "Failed to load profile", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"onboarded": profile != nil && profile.OnboardedAt != nil,
+		"profile":   profile,
+	})
+}
@@ -0,0 +1,229 @@
+// backend/publish.go
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	maxKeyInsightLength = 280
+	defaultAuthorName   = "Auryvia Pioneer"
+)
+
+// publicTripModeration reports whether new public trips wait for a moderator.
+// PUBLIC_TRIP_MODERATION is "auto" (default, approved straight away) or "manual".
+func publicTripModeration() string {
+	if strings.ToLower(os.Getenv("PUBLIC_TRIP_MODERATION")) == "manual" {
+		return moderationPending
+	}
+	return moderationApproved
+}
+
+// isModerator reports whether uid is listed in MODERATOR_UIDS (comma separated).
+func isModerator(uid string) bool {
+	for _, id := range strings.Split(os.Getenv("MODERATOR_UIDS"), ",") {
+		if id = strings.TrimSpace(id); id != "" && id == uid {
+			return true
+		}
+	}
+	return false
+}
+
+// setModeration changes the status of p and keeps ListedAt in step with it.
+func (p *PublicTrip) setModeration(status, note string, now time.Time) {
+	p.ModerationStatus, p.ModerationNote = status, note
+	p.UpdatedAt = now
+	if status == moderationApproved {
+		if p.ListedAt == nil {
+			p.ListedAt = &now
+		}
+	} else {
+		p.ListedAt = nil
+	}
+}
+
+// projectTrip builds the public copy of a trip. Only the itinerary, the card
+// accessibility flags and the author's chosen display name are copied. Marks
+// derived from the author's profile, such as dietary or accessibility
+// conflicts and sensory flags, are left out: they are health data.
+func projectTrip(trip *Trip, author, keyInsight string) *PublicTrip {
+	p := &PublicTrip{
+		ID:            trip.ID,
+		AuthorID:      trip.UserID,
+		UserName:      author,
+		TripTitle:     trip.Itinerary.TripTitle,
+		Destination:   trip.Itinerary.Destination,
+		KeyInsight:    keyInsight,
+		Days:          len(trip.Itinerary.Itinerary),
+		Accessibility: trip.Accessibility,
+	}
+	cloneJSON(&p.Itinerary, trip.Itinerary)
+	for i := range p.Itinerary.Itinerary {
+		for j := range p.Itinerary.Itinerary[i].Activities {
+			act := &p.Itinerary.Itinerary[i].Activities[j]
+			act.Conflict, act.Sensory = "", nil
+		}
+	}
+	return p
+}
+
+// authorName picks the name shown on a public trip.
+func authorName(ctx context.Context, userId, requested string) string {
+	if requested = strings.TrimSpace(requested); requested != "" {
+		return requested
+	}
+	profile, err := profileStore.GetProfile(ctx, userId)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		log.Printf("Failed to load profile for %s: %v", userId, err)
+	}
+	if profile != nil && profile.DisplayName != "" {
+		return profile.DisplayName
+	}
+	return defaultAuthorName
+}
+
+// handlePublishTrip publishes (POST) or unpublishes (DELETE) one of the
+// caller's trips. Publishing writes a snapshot to the public projection;
+// publish again after editing to refresh it.
+// POST body: {"keyInsight": "...", "displayName": "..."}, both optional.
+func handlePublishTrip(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	id := r.PathValue("id")
+	switch r.Method {
+	case "POST":
+		var req struct {
+			KeyInsight  string `json:"keyInsight"`
+			DisplayName string `json:"displayName"`
+		}
+		if r.ContentLength != 0 {
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, "Invalid JSON", http.StatusBadRequest)
+				return
+			}
+		}
+		req.KeyInsight = strings.TrimSpace(req.KeyInsight)
+		if len(req.KeyInsight) > maxKeyInsightLength {
+			http.Error(w, fmt.Sprintf("keyInsight must be at most %d characters", maxKeyInsightLength), http.StatusBadRequest)
+			return
+		}
+		if len(strings.TrimSpace(req.DisplayName)) > maxDisplayNameLength {
+			http.Error(w, fmt.Sprintf("displayName must be at most %d characters", maxDisplayNameLength), http.StatusBadRequest)
+			return
+		}
+
+		trip, err := updateOwnedTrip(r, id, revisionPublish, func(trip *Trip) error {
+			trip.IsPublic = true
+			return nil
+		})
+		if err != nil {
+			writeTripError(w, err)
+			return
+		}
+
+		public := projectTrip(trip, authorName(ctx, trip.UserID, req.DisplayName), req.KeyInsight)
+		now := time.Now().UTC()
+		public.CreatedAt = now
+		if existing, err := publicTripStore.GetPublicTrip(ctx, id); err == nil {
+			public.CreatedAt, public.ListedAt = existing.CreatedAt, existing.ListedAt
+		} else if !errors.Is(err, ErrNotFound) {
+			writeTripError(w, err)
+			return
+		}
+		// Reviews outlive unpublishing, so the aggregates come from the review store.
+		if public.Ratings, err = tripRatings(ctx, id); err != nil {
+			writeTripError(w, err)
+			return
+		}
+		// A re-published trip goes back to review when moderation is manual.
+		public.setModeration(publicTripModeration(), "", now)
+		if err := publicTripStore.SavePublicTrip(ctx, public); err != nil {
+			writeTripError(w, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(public)
+
+	case "DELETE":
+		if _, err := updateOwnedTrip(r, id, revisionUnpublish, func(trip *Trip) error {
+			trip.IsPublic = false
+			return nil
+		}); err != nil {
+			writeTripError(w, err)
+			return
+		}
+		if err := publicTripStore.DeletePublicTrip(ctx, id); err != nil && !errors.Is(err, ErrNotFound) {
+			writeTripError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handlePublicTrip returns one approved public trip.
+func handlePublicTrip(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	public, err := publicTripStore.GetPublicTrip(r.Context(), r.PathValue("id"))
+	if err == nil && public.ModerationStatus != moderationApproved {
+		err = ErrNotFound
+	}
+	if err != nil {
+		writeTripError(w, err)
+		return
+	}
+	public.AuthorID = ""
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(public)
+}
+
+// handleModeratePublicTrip lets a moderator approve or reject a public trip.
+// Body: {"status": "approved"|"rejected"|"pending", "note": "..."}.
+func handleModeratePublicTrip(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !isModerator(userIDFrom(r.Context())) {
+		http.Error(w, "Only moderators can do that", http.StatusForbidden)
+		return
+	}
+	var req struct {
+		Status string `json:"status"`
+		Note   string `json:"note"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	switch req.Status {
+	case moderationApproved, moderationRejected, moderationPending:
+	default:
+		http.Error(w, `status must be "approved", "rejected" or "pending"`, http.StatusBadRequest)
+		return
+	}
+
+	public, err := publicTripStore.UpdatePublicTrip(r.Context(), r.PathValue("id"), func(p *PublicTrip) error {
+		p.setModeration(req.Status, strings.TrimSpace(req.Note), time.Now().UTC())
+		return nil
+	})
+	if err != nil {
+		writeTripError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(public)
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// Conflicts and sensory flags come from the author's profile and never
+// reach the public copy of a trip.
+func TestPublishedTripLeavesOutProfileMarks(t *testing.T) {
+	useMemoryStore(t)
+	ctx := context.WithValue(context.Background(), userIDKey, "user-1")
+	trip := &Trip{
+		UserID: "user-1",
+		Itinerary: Itinerary{TripTitle: "Kyoto", Destination: "Kyoto, Japan", Itinerary: []Day{{
+			Day:   1,
+			Title: "Markets",
+			Activities: []Activity{{
+				Time: "9:00 AM", Description: "Nishiki Market.", Category: "Food", Lat: 35.005, Lng: 135.765,
+				Conflict: "Most stalls fry in peanut oil.",
+				Sensory:  &ActivitySensory{SensoryScores: SensoryScores{Audio: 80, Visual: 70, Crowds: 90}, Source: sensorySourceProfile, Exceeds: []string{"audio"}},
+			}},
+		}}},
+	}
+	if err := tripStore.CreateTrip(ctx, trip); err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest("POST", "/api/trips/"+trip.ID+"/publish", nil).WithContext(ctx)
+	req.SetPathValue("id", trip.ID)
+	rec := httptest.NewRecorder()
+	handlePublishTrip(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("publish returned %d: %s", rec.Code, rec.Body.String())
+	}
+
+	req = httptest.NewRequest("GET", "/api/public-trips/"+trip.ID, nil)
+	req.SetPathValue("id", trip.ID)
+	one := httptest.NewRecorder()
+	handlePublicTrip(one, req)
+	list := httptest.NewRecorder()
+	handlePublicTrips(list, httptest.NewRequest("GET", "/api/public-trips", nil))
+
+	for name, rec := range map[string]*httptest.ResponseRecorder{"publish": rec, "get": one, "list": list} {
+		body := rec.Body.String()
+		if rec.Code != http.StatusOK || !strings.Contains(body, "Nishiki Market.") {
+			t.Fatalf("%s returned %d: %s", name, rec.Code, body)
+		}
+		for _, private := range []string{`"conflict"`, "peanut", `"sensory":{`} {
+			if strings.Contains(body, private) {
+				t.Errorf("%s response contains %s: %s", name, private, body)
+			}
+		}
+	}
+}
@@ -0,0 +1,557 @@
+// backend/relief.go
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Relief point kinds.
+const (
+	reliefRestroom  = "accessibleRestroom"
+	reliefQuietRoom = "quietRoom"
+	reliefCharging  = "mobilityCharging"
+	reliefSeating   = "seating"
+)
+
+var reliefKinds = map[string]bool{
+	reliefRestroom:  true,
+	reliefQuietRoom: true,
+	reliefCharging:  true,
+	reliefSeating:   true,
+}
+
+const (
+	defaultReliefLimit   = 100
+	maxReliefLimit       = 500
+	defaultReliefRadius  = 500  // meters
+	maxReliefRadius      = 5000 // meters
+	maxReliefBoxDegrees  = 0.5
+	maxReliefNameLength  = 100
+	maxReliefNotesLength = 500
+	maxReliefImportBytes = 50 << 20
+	// reliefScanLimit caps how many points a lookup reads before sorting by distance.
+	reliefScanLimit = 2000
+	// reliefPerActivity is how many points are listed around each activity of a day.
+	reliefPerActivity  = 10
+	metersPerDegreeLat = 111320
+	// reliefGeohashLength is how precisely stores that index by geohash
+	// record a point, about 5 m.
+	reliefGeohashLength = 9
+)
+
+const geohashBase32 = "0123456789bcdefghjkmnpqrstuvwxyz"
+
+// geohashBits splits the bits of a geohash of the given length between
+// latitude and longitude; longitude gets the odd one.
+func geohashBits(length int) (latBits, lngBits int) {
+	bits := 5 * length
+	return bits / 2, bits - bits/2
+}
+
+// geohashIndex is the cell of v in a row of 2^bits cells spanning lo to hi.
+func geohashIndex(v, lo, hi float64, bits int) int {
+	n := 1 << bits
+	return min(max(int((v-lo)/(hi-lo)*float64(n)), 0), n-1)
+}
+
+// geohashCell encodes the cell in the given row and column of the grid of
+// geohashes of that length.
+func geohashCell(row, col, length int) string {
+	latBits, lngBits := geohashBits(length)
+	hash := make([]byte, length)
+	ch := 0
+	// Bits alternate between longitude and latitude, longitude first.
+	for i := range 5 * length {
+		if i%2 == 0 {
+			lngBits--
+			ch = ch<<1 | col>>lngBits&1
+		} else {
+			latBits--
+			ch = ch<<1 | row>>latBits&1
+		}
+		if i%5 == 4 {
+			hash[i/5], ch = geohashBase32[ch], 0
+		}
+	}
+	return string(hash)
+}
+
+// geohash encodes a point as a geohash of the given length.
+func geohash(lat, lng float64, length int) string {
+	latBits, lngBits := geohashBits(length)
+	return geohashCell(geohashIndex(lat, -90, 90, latBits), geohashIndex(lng, -180, 180, lngBits), length)
+}
+
+// geohashCover returns the geohash prefixes whose cells together cover b.
+// They are as long as possible while a cell is still at least as big as b,
+// so there are at most four.
+func (b BoundingBox) geohashCover() []string {
+	length := 1
+	for l := reliefGeohashLength; l > 1; l-- {
+		latBits, lngBits := geohashBits(l)
+		if 180/float64(int(1)<<latBits) >= b.MaxLat-b.MinLat && 360/float64(int(1)<<lngBits) >= b.MaxLng-b.MinLng {
+			length = l
+			break
+		}
+	}
+	latBits, lngBits := geohashBits(length)
+	var cells []string
+	for row := geohashIndex(b.MinLat, -90, 90, latBits); row <= geohashIndex(b.MaxLat, -90, 90, latBits); row++ {
+		for col := geohashIndex(b.MinLng, -180, 180, lngBits); col <= geohashIndex(b.MaxLng, -180, 180, lngBits); col++ {
+			cells = append(cells, geohashCell(row, col, length))
+		}
+	}
+	return cells
+}
+
+func (b BoundingBox) contains(lat, lng float64) bool {
+	return lat >= b.MinLat && lat <= b.MaxLat && lng >= b.MinLng && lng <= b.MaxLng
+}
+
+// boxAround is the smallest box holding the circle of radius meters around center.
+func boxAround(center LatLng, radius float64) BoundingBox {
+	dLat := radius / metersPerDegreeLat
+	dLng := radius / (metersPerDegreeLat * math.Max(math.Cos(center.Lat*math.Pi/180), 0.01))
+	return BoundingBox{
+		MinLat: math.Max(center.Lat-dLat, -90), MaxLat: math.Min(center.Lat+dLat, 90),
+		MinLng: math.Max(center.Lng-dLng, -180), MaxLng: math.Min(center.Lng+dLng, 180),
+	}
+}
+
+// matches reports whether p satisfies q, for stores that filter in memory.
+func (q ReliefPointQuery) matches(p *ReliefPoint) bool {
+	if q.Box != nil && !q.Box.contains(p.Lat, p.Lng) {
+		return false
+	}
+	if q.Status != "" && p.Status != q.Status {
+		return false
+	}
+	if len(q.Kinds) == 0 {
+		return true
+	}
+	for _, kind := range q.Kinds {
+		if p.Kind == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// sortReliefPoints puts points in store order: oldest first, then by ID.
+func sortReliefPoints(points []ReliefPoint) {
+	sort.Slice(points, func(i, j int) bool {
+		if !points[i].CreatedAt.Equal(points[j].CreatedAt) {
+			return points[i].CreatedAt.Before(points[j].CreatedAt)
+		}
+		return points[i].ID < points[j].ID
+	})
+}
+
+// validate checks the fields a submitter or an import controls.
+func (p *ReliefPoint) validate() error {
+	if !reliefKinds[p.Kind] {
+		return errors.New(`kind must be one of "accessibleRestroom", "quietRoom", "mobilityCharging" or "seating"`)
+	}
+	p.Name, p.Notes = strings.TrimSpace(p.Name), strings.TrimSpace(p.Notes)
+	if p.Name == "" {
+		return errors.New("name is required")
+	}
+	if len(p.Name) > maxReliefNameLength {
+		return fmt.Errorf("name must be at most %d characters", maxReliefNameLength)
+	}
+	if len(p.Notes) > maxReliefNotesLength {
+		return fmt.Errorf("notes must be at most %d characters", maxReliefNotesLength)
+	}
+	if p.Lat < -90 || p.Lat > 90 || p.Lng < -180 || p.Lng > 180 {
+		return errors.New("lat must be within ±90 and lng within ±180")
+	}
+	return nil
+}
+
+// NearbyReliefPoint is a relief point with its distance from where the traveller is.
+type NearbyReliefPoint struct {
+	ReliefPoint
+	DistanceMeters int `json:"distanceMeters"`
+}
+
+// nearest keeps the points within radius meters of center, closest first.
+func nearest(points []ReliefPoint, center LatLng, radius float64, limit int) []NearbyReliefPoint {
+	near := []NearbyReliefPoint{}
+	for _, p := range points {
+		if d := haversineMeters(center, LatLng{p.Lat, p.Lng}); d <= radius {
+			near = append(near, NearbyReliefPoint{ReliefPoint: p, DistanceMeters: int(math.Round(d))})
+		}
+	}
+	sort.SliceStable(near, func(i, j int) bool { return near[i].DistanceMeters < near[j].DistanceMeters })
+	if len(near) > limit {
+		near = near[:limit]
+	}
+	return near
+}
+
+// queryKinds reads the optional comma separated ?kinds= parameter.
+func queryKinds(r *http.Request) ([]string, error) {
+	v := r.URL.Query().Get("kinds")
+	if v == "" {
+		return nil, nil
+	}
+	var kinds []string
+	for _, kind := range strings.Split(v, ",") {
+		kind = strings.TrimSpace(kind)
+		if !reliefKinds[kind] {
+			return nil, fmt.Errorf("unknown kind %q", kind)
+		}
+		kinds = append(kinds, kind)
+	}
+	return kinds, nil
+}
+
+// queryRadius reads the optional ?radius= parameter in meters.
+func queryRadius(r *http.Request) (float64, error) {
+	radius, err := queryInt(r, "radius", defaultReliefRadius)
+	if err != nil || radius < 1 || radius > maxReliefRadius {
+		return 0, fmt.Errorf("radius must be between 1 and %d meters", maxReliefRadius)
+	}
+	return float64(radius), nil
+}
+
+// parseBoundingBox reads "minLng,minLat,maxLng,maxLat", the GeoJSON bbox order.
+func parseBoundingBox(v string) (*BoundingBox, error) {
+	parts := strings.Split(v, ",")
+	if len(parts) != 4 {
+		return nil, errors.New("bbox must be minLng,minLat,maxLng,maxLat")
+	}
+	var n [4]float64
+	for i, part := range parts {
+		f, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil {
+			return nil, errors.New("bbox must be minLng,minLat,maxLng,maxLat")
+		}
+		n[i] = f
+	}
+	b := &BoundingBox{MinLng: n[0], MinLat: n[1], MaxLng: n[2], MaxLat: n[3]}
+	if b.MinLat > b.MaxLat || b.MinLng > b.MaxLng {
+		return nil, errors.New("bbox minimums must not exceed its maximums")
+	}
+	if b.MaxLat-b.MinLat > maxReliefBoxDegrees || b.MaxLng-b.MinLng > maxReliefBoxDegrees {
+		return nil, fmt.Errorf("bbox must span at most %g degrees each way", maxReliefBoxDegrees)
+	}
+	return b, nil
+}
+
+// stripSubmitter hides who submitted the points from everyone but moderators.
+func stripSubmitter(points []ReliefPoint) {
+	for i := range points {
+		points[i].SubmittedBy = ""
+	}
+}
+
+// handleReliefPoints looks up approved relief points (GET) or lets a signed-in
+// traveller submit one for moderation (POST).
+// GET takes either bbox=minLng,minLat,maxLng,maxLat or lat, lng and radius
+// (meters), plus optional kinds (comma separated) and limit. Radius lookups
+// are sorted closest first and carry distanceMeters.
+// POST body: {"kind": "quietRoom", "name": "...", "lat": 0.0, "lng": 0.0, "notes": "..."}.
+func handleReliefPoints(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	switch r.Method {
+	case "GET":
+		query := r.URL.Query()
+		q := ReliefPointQuery{Status: moderationApproved, Limit: reliefScanLimit}
+		limit, err := queryInt(r, "limit", defaultReliefLimit)
+		if err == nil && (limit < 1 || limit > maxReliefLimit) {
+			err = fmt.Errorf("limit must be between 1 and %d", maxReliefLimit)
+		}
+		if err == nil {
+			q.Kinds, err = queryKinds(r)
+		}
+		var center *LatLng
+		var radius float64
+		switch {
+		case err != nil:
+		case query.Get("bbox") != "":
+			q.Box, err = parseBoundingBox(query.Get("bbox"))
+		case query.Get("lat") != "" && query.Get("lng") != "":
+			var c LatLng
+			c.Lat, err = strconv.ParseFloat(query.Get("lat"), 64)
+			if err == nil {
+				c.Lng, err = strconv.ParseFloat(query.Get("lng"), 64)
+			}
+			if err != nil || c.Lat < -90 || c.Lat > 90 || c.Lng < -180 || c.Lng > 180 {
+				err = errors.New("lat must be within ±90 and lng within ±180")
+			}
+			if err == nil {
+				radius, err = queryRadius(r)
+			}
+			if err == nil {
+				box := boxAround(c, radius)
+				q.Box, center = &box, &c
+			}
+		default:
+			err = errors.New("give either bbox or lat and lng")
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		points, err := reliefStore.FindReliefPoints(ctx, q)
+		if err != nil {
+			log.Printf("Failed to find relief points: %v", err)
+			http.Error(w, "Failed to load relief points", http.StatusInternalServerError)
+			return
+		}
+		stripSubmitter(points)
+		w.Header().Set("Content-Type", "application/json")
+		if center != nil {
+			json.NewEncoder(w).Encode(map[string]interface{}{"points": nearest(points, *center, radius, limit)})
+			return
+		}
+		if len(points) > limit {
+			points = points[:limit]
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"points": points})
+
+	case "POST":
+		userId := userIDFrom(ctx)
+		if userId == "" {
+			http.Error(w, "Missing or invalid Authorization header", http.StatusUnauthorized)
+			return
+		}
+		var req struct {
+			Kind  string  `json:"kind"`
+			Name  string  `json:"name"`
+			Lat   float64 `json:"lat"`
+			Lng   float64 `json:"lng"`
+			Notes string  `json:"notes"`
+		}
+		dec := json.NewDecoder(r.Body)
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&req); err != nil {
+			http.Error(w, "Invalid JSON: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		now := time.Now().UTC()
+		p := &ReliefPoint{
+			Kind: req.Kind, Name: req.Name, Lat: req.Lat, Lng: req.Lng, Notes: req.Notes,
+			Source: "user", Status: moderationPending, SubmittedBy: userId,
+			CreatedAt: now, UpdatedAt: now,
+		}
+		if err := p.validate(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		// Moderators vouch for their own points.
+		if isModerator(userId) {
+			p.Status = moderationApproved
+		}
+		if err := reliefStore.CreateReliefPoint(ctx, p); err != nil {
+			log.Printf("Failed to save relief point: %v", err)
+			http.Error(w, "Failed to save relief point", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(p)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handlePendingReliefPoints lists submissions waiting for a moderator, oldest first.
+func handlePendingReliefPoints(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !moderatorOnly(w, r) {
+		return
+	}
+	limit, err := queryInt(r, "limit", defaultReliefLimit)
+	if err != nil || limit < 1 || limit > maxReliefLimit {
+		http.Error(w, fmt.Sprintf("limit must be between 1 and %d", maxReliefLimit), http.StatusBadRequest)
+		return
+	}
+	points, err := reliefStore.FindReliefPoints(r.Context(), ReliefPointQuery{Status: moderationPending, Limit: limit})
+	if err != nil {
+		log.Printf("Failed to list pending relief points: %v", err)
+		http.Error(w, "Failed to load relief points", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"points": points})
+}
+
+// handleModerateReliefPoint lets a moderator approve or reject a relief point.
+// Body: {"status": "approved"|"rejected"|"pending", "note": "..."}.
+func handleModerateReliefPoint(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !moderatorOnly(w, r) {
+		return
+	}
+	var req struct {
+		Status string `json:"status"`
+		Note   string `json:"note"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	switch req.Status {
+	case moderationApproved, moderationRejected, moderationPending:
+	default:
+		http.Error(w, `status must be "approved", "rejected" or "pending"`, http.StatusBadRequest)
+		return
+	}
+	p, err := reliefStore.UpdateReliefPoint(r.Context(), r.PathValue("id"), func(p *ReliefPoint) error {
+		p.Status, p.ModerationNote = req.Status, strings.TrimSpace(req.Note)
+		p.UpdatedAt = time.Now().UTC()
+		return nil
+	})
+	if errors.Is(err, ErrNotFound) {
+		http.Error(w, "Relief point not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to moderate relief point: %v", err)
+		http.Error(w, "Failed to update relief point", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(p)
+}
+
+// handleImportReliefPoints loads an OSM XML extract (?format=osm) or a GeoJSON
+// FeatureCollection (?format=geojson) sent as the request body. Imported
+// points are approved straight away; importing a file again updates the
+// points it brought in before.
+func handleImportReliefPoints(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !moderatorOnly(w, r) {
+		return
+	}
+	body := http.MaxBytesReader(w, r.Body, maxReliefImportBytes)
+	var (
+		result *reliefImport
+		err    error
+	)
+	switch format := r.URL.Query().Get("format"); format {
+	case "osm":
+		result, err = parseOSMReliefPoints(body)
+	case "geojson":
+		result, err = parseGeoJSONReliefPoints(body)
+	default:
+		http.Error(w, `format must be "osm" or "geojson"`, http.StatusBadRequest)
+		return
+	}
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		http.Error(w, fmt.Sprintf("import files must be at most %d MB", maxReliefImportBytes>>20), http.StatusRequestEntityTooLarge)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	created, err := reliefStore.ImportReliefPoints(r.Context(), result.points)
+	if err != nil {
+		log.Printf("Relief point import failed: %v", err)
+		http.Error(w, "Failed to import relief points", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]int{
+		"imported": len(result.points),
+		"created":  created,
+		"updated":  len(result.points) - created,
+		"skipped":  result.skipped,
+	})
+}
+
+// handleTripReliefPoints lists approved relief points around each activity of
+// one day of the caller's trip. Query parameters: day (required), radius in
+// meters and kinds.
+func handleTripReliefPoints(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	ctx := r.Context()
+	trip, err := loadOwnedTrip(ctx, r.PathValue("id"), userIDFrom(ctx))
+	if err != nil {
+		writeTripError(w, err)
+		return
+	}
+	dayNum, err := queryInt(r, "day", 0)
+	if err != nil || dayNum < 1 || dayNum > len(trip.Itinerary.Itinerary) {
+		http.Error(w, fmt.Sprintf("day must be between 1 and %d", len(trip.Itinerary.Itinerary)), http.StatusBadRequest)
+		return
+	}
+	radius, err := queryRadius(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	kinds, err := queryKinds(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	type activityRelief struct {
+		ActivityIndex int                 `json:"activityIndex"`
+		Points        []NearbyReliefPoint `json:"points"`
+	}
+	day := trip.Itinerary.Itinerary[dayNum-1]
+	activities := []activityRelief{}
+	// One lookup covers the whole day: the box around every placed activity's circle.
+	var box *BoundingBox
+	for _, act := range day.Activities {
+		if act.Lat == 0 && act.Lng == 0 {
+			continue
+		}
+		b := boxAround(LatLng{act.Lat, act.Lng}, radius)
+		if box == nil {
+			box = &b
+			continue
+		}
+		box.MinLat, box.MinLng = math.Min(box.MinLat, b.MinLat), math.Min(box.MinLng, b.MinLng)
+		box.MaxLat, box.MaxLng = math.Max(box.MaxLat, b.MaxLat), math.Max(box.MaxLng, b.MaxLng)
+	}
+	if box != nil {
+		points, err := reliefStore.FindReliefPoints(ctx, ReliefPointQuery{Box: box, Kinds: kinds, Status: moderationApproved, Limit: reliefScanLimit})
+		if err != nil {
+			log.Printf("Failed to find relief points for %s: %v", trip.ID, err)
+			http.Error(w, "Failed to load relief points", http.StatusInternalServerError)
+			return
+		}
+		stripSubmitter(points)
+		for i, act := range day.Activities {
+			near := []NearbyReliefPoint{}
+			if act.Lat != 0 || act.Lng != 0 {
+				near = nearest(points, LatLng{act.Lat, act.Lng}, radius, reliefPerActivity)
+			}
+			activities = append(activities, activityRelief{ActivityIndex: i, Points: near})
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"day": dayNum, "activities": activities})
+}
@@ -0,0 +1,199 @@
+// backend/relief_import.go
+
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// reliefImport is what an import file yielded: the usable points and how many
+// features were passed over (not a relief point, no position, bad fields).
+type reliefImport struct {
+	points  []ReliefPoint
+	skipped int
+}
+
+// reliefKindFromTags maps OpenStreetMap tags to a relief point kind, or ""
+// when the feature isn't one. GeoJSON properties go through the same rules.
+func reliefKindFromTags(tags map[string]string) string {
+	amenity := tags["amenity"]
+	switch {
+	case amenity == "toilets" && (tags["wheelchair"] == "yes" || tags["toilets:wheelchair"] == "yes"),
+		tags["toilets:wheelchair"] == "yes":
+		return reliefRestroom
+	case amenity == "quiet_room", tags["room"] == "quiet", tags["quiet_room"] == "yes":
+		return reliefQuietRoom
+	case amenity == "charging_station" && (tags["mobility_scooter"] == "yes" || tags["wheelchair"] == "yes"),
+		tags["socket:mobility_scooter"] != "":
+		return reliefCharging
+	case amenity == "bench", tags["leisure"] == "picnic_table", tags["bench"] == "yes":
+		return reliefSeating
+	}
+	return ""
+}
+
+// reliefNames are used when a feature has no name of its own.
+var reliefNames = map[string]string{
+	reliefRestroom:  "Accessible restroom",
+	reliefQuietRoom: "Quiet room",
+	reliefCharging:  "Mobility device charging",
+	reliefSeating:   "Seating",
+}
+
+// add turns a tagged feature into a relief point, or counts it as skipped.
+func (imp *reliefImport) add(source, ref string, lat, lng float64, tags map[string]string, now time.Time) {
+	kind := tags["kind"]
+	if !reliefKinds[kind] {
+		kind = reliefKindFromTags(tags)
+	}
+	if kind == "" {
+		imp.skipped++
+		return
+	}
+	name := tags["name"]
+	if strings.TrimSpace(name) == "" {
+		name = reliefNames[kind]
+	}
+	notes := tags["description"]
+	if notes == "" {
+		notes = tags["note"]
+	}
+	if len(notes) > maxReliefNotesLength {
+		notes = notes[:maxReliefNotesLength]
+	}
+	p := ReliefPoint{
+		Kind: kind, Name: name, Lat: lat, Lng: lng, Notes: notes,
+		Source: source, SourceRef: ref, Status: moderationApproved,
+		CreatedAt: now, UpdatedAt: now,
+	}
+	if p.validate() != nil {
+		imp.skipped++
+		return
+	}
+	imp.points = append(imp.points, p)
+}
+
+// parseOSMReliefPoints streams an OSM XML extract and keeps the tagged nodes
+// that are relief points. Ways and relations are skipped: resolving their
+// positions would mean holding every node of the extract in memory.
+func parseOSMReliefPoints(r io.Reader) (*reliefImport, error) {
+	imp := &reliefImport{}
+	now := time.Now().UTC()
+	dec := xml.NewDecoder(r)
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid OSM XML: %w", err)
+		}
+		start, ok := tok.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		switch start.Name.Local {
+		case "node":
+			var node struct {
+				ID   string  `xml:"id,attr"`
+				Lat  float64 `xml:"lat,attr"`
+				Lon  float64 `xml:"lon,attr"`
+				Tags []struct {
+					K string `xml:"k,attr"`
+					V string `xml:"v,attr"`
+				} `xml:"tag"`
+			}
+			if err := dec.DecodeElement(&node, &start); err != nil {
+				return nil, fmt.Errorf("invalid OSM XML: %w", err)
+			}
+			if len(node.Tags) == 0 {
+				// Untagged nodes are just geometry for ways.
+				continue
+			}
+			tags := make(map[string]string, len(node.Tags))
+			for _, t := range node.Tags {
+				tags[t.K] = t.V
+			}
+			imp.add("osm", "osm:node/"+node.ID, node.Lat, node.Lon, tags, now)
+		case "way", "relation":
+			imp.skipped++
+			if err := dec.Skip(); err != nil {
+				return nil, fmt.Errorf("invalid OSM XML: %w", err)
+			}
+		}
+	}
+	return imp, nil
+}
+
+// parseGeoJSONReliefPoints reads a FeatureCollection of Point features. A
+// "kind" property naming one of our kinds wins; otherwise OSM-style tags in
+// the properties decide. Features without an id are keyed by kind and
+// position, so re-importing the same file still updates them.
+func parseGeoJSONReliefPoints(r io.Reader) (*reliefImport, error) {
+	var fc struct {
+		Type     string `json:"type"`
+		Features []struct {
+			ID       interface{} `json:"id"`
+			Geometry *struct {
+				Type string `json:"type"`
+				// Raw so lines and polygons in the same file don't fail the decode.
+				Coordinates json.RawMessage `json:"coordinates"`
+			} `json:"geometry"`
+			Properties map[string]interface{} `json:"properties"`
+		} `json:"features"`
+	}
+	if err := json.NewDecoder(r).Decode(&fc); err != nil {
+		return nil, fmt.Errorf("invalid GeoJSON: %w", err)
+	}
+	if fc.Type != "FeatureCollection" {
+		return nil, errors.New(`GeoJSON must be a "FeatureCollection"`)
+	}
+
+	imp := &reliefImport{}
+	now := time.Now().UTC()
+	for _, f := range fc.Features {
+		// GeoJSON positions are [lng, lat].
+		var pos []float64
+		if f.Geometry == nil || f.Geometry.Type != "Point" ||
+			json.Unmarshal(f.Geometry.Coordinates, &pos) != nil || len(pos) < 2 {
+			imp.skipped++
+			continue
+		}
+		lng, lat := pos[0], pos[1]
+		tags := make(map[string]string, len(f.Properties))
+		for k, v := range f.Properties {
+			switch v := v.(type) {
+			case string:
+				tags[k] = v
+			case bool:
+				// OSM spells booleans yes and no.
+				tags[k] = "no"
+				if v {
+					tags[k] = "yes"
+				}
+			case float64:
+				tags[k] = strconv.FormatFloat(v, 'f', -1, 64)
+			}
+		}
+		id := tags["@id"]
+		if id == "" && f.ID != nil {
+			id = fmt.Sprint(f.ID)
+		}
+		if id == "" {
+			kind := tags["kind"]
+			if !reliefKinds[kind] {
+				kind = reliefKindFromTags(tags)
+			}
+			id = fmt.Sprintf("%s@%.6f,%.6f", kind, lat, lng)
+		}
+		imp.add("geojson", "geojson:"+id, lat, lng, tags, now)
+	}
+	return imp, nil
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"math/rand/v2"
+	"strings"
+	"testing"
+)
+
+func TestGeohash(t *testing.T) {
+	for _, tt := range []struct {
+		lat, lng float64
+		length   int
+		want     string
+	}{
+		{57.64911, 10.40744, 11, "u4pruydqqvj"},
+		{42.6, -5.6, 5, "ezs42"},
+		{-90, -180, 3, "000"},
+		{90, 180, 3, "zzz"},
+	} {
+		if got := geohash(tt.lat, tt.lng, tt.length); got != tt.want {
+			t.Errorf("geohash(%v, %v, %d) = %q, want %q", tt.lat, tt.lng, tt.length, got, tt.want)
+		}
+	}
+}
+
+// Every point in a box falls in one of the few cells covering it.
+func TestGeohashCover(t *testing.T) {
+	boxes := []BoundingBox{
+		{MinLat: 35.0, MinLng: 135.7, MaxLat: 35.05, MaxLng: 135.8},
+		{MinLat: -0.25, MinLng: -0.25, MaxLat: 0.25, MaxLng: 0.25},
+		boxAround(LatLng{Lat: 51.5072, Lng: -0.1276}, maxReliefRadius),
+		{MinLat: 10, MinLng: 10, MaxLat: 12, MaxLng: 14},
+	}
+	rng := rand.New(rand.NewPCG(1, 2))
+	for _, box := range boxes {
+		cells := box.geohashCover()
+		if len(cells) == 0 || len(cells) > 4 {
+			t.Fatalf("%+v is covered by %d cells", box, len(cells))
+		}
+		for range 1000 {
+			lat := box.MinLat + rng.Float64()*(box.MaxLat-box.MinLat)
+			lng := box.MinLng + rng.Float64()*(box.MaxLng-box.MinLng)
+			hash := geohash(lat, lng, reliefGeohashLength)
+			covered := false
+			for _, cell := range cells {
+				covered = covered || strings.HasPrefix(hash, cell)
+			}
+			if !covered {
+				t.Fatalf("%v,%v (%s) is outside the cells %v covering %+v", lat, lng, hash, cells, box)
+			}
+		}
+	}
+}
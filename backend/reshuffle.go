@@ -0,0 +1,185 @@
+// backend/reshuffle.go
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+)
+
+// Reshuffle is the model's structured replacement for one activity of a day.
+type Reshuffle struct {
+	ActivityIndex int      `json:"activityIndex"`
+	Activity      Activity `json:"activity"`
+	Reason        string   `json:"reason"`
+}
+
+// ReshuffleValidationError is returned when the model never produced a usable replacement.
+type ReshuffleValidationError struct {
+	Problems []string
+	Attempts int
+}
+
+func (e *ReshuffleValidationError) Error() string {
+	return fmt.Sprintf("replacement still invalid after %d attempts: %s", e.Attempts, strings.Join(e.Problems, "; "))
+}
+
+func buildReshufflePrompt(day Day, index *int, constraint string) string {
+	dayJSON, _ := json.Marshal(day)
+	target := "Pick the single most demanding activity of the day and replace it."
+	if index != nil {
+		target = fmt.Sprintf("Replace the activity at index %d (0-based) of the activities list.", *index)
+	}
+	return fmt.Sprintf(`
+You are Auryvia, a compassionate travel AI. The user is feeling tired and needs a low-energy day.
+Here is the day as JSON: %s
+Constraint: %s
+
+%s Suggest one relaxing alternative close to the original, at about the same time of day.
+Output JSON: {"activityIndex": 0-based index of the replaced activity, "reason": "why it was swapped", "activity": {"time": "9:00 AM", "description": "...", "category": "...", "lat": 0.0, "lng": 0.0}}
+The time must look like "9:00 AM", the category must be one of: %s, and lat/lng must be real coordinates.
+`, dayJSON, constraint, target, categoryList())
+}
+
+// decodeReshuffle parses a model answer and checks it fits a day with n activities.
+// A requested index always wins over the one the model reports.
+func decodeReshuffle(raw string, n int, index *int) (*Reshuffle, []string) {
+	var rs Reshuffle
+	if err := json.Unmarshal([]byte(raw), &rs); err != nil {
+		return nil, []string{"response is not a valid replacement JSON object: " + err.Error()}
+	}
+	if index != nil {
+		rs.ActivityIndex = *index
+	}
+	problems := validateActivity("activity", rs.Activity)
+	if rs.ActivityIndex < 0 || rs.ActivityIndex >= n {
+		problems = append(problems, fmt.Sprintf("activityIndex %d is out of range, the day has %d activities", rs.ActivityIndex, n))
+	}
+	return &rs, problems
+}
+
+// generateReshuffle asks for a replacement and repairs it like generateItinerary does.
+func generateReshuffle(ctx context.Context, day Day, index *int, constraint string, retries int) (*Reshuffle, error) {
+	return generateReplacement(ctx, buildReshufflePrompt(day, index, constraint), day, index, retries)
+}
+
+// generateReplacement sends a prompt asking for one replacement activity of
+// day and repairs the answer until it fits or the retries run out.
+func generateReplacement(ctx context.Context, prompt string, day Day, index *int, retries int) (*Reshuffle, error) {
+	raw, err := llm.GenerateJSON(ctx, LLMRequest{Task: taskReshuffle, Prompt: prompt})
+	if err != nil {
+		return nil, err
+	}
+	rs, problems := decodeReshuffle(raw, len(day.Activities), index)
+	attempts := 1
+	for ; len(problems) > 0 && attempts <= retries; attempts++ {
+		repair := fmt.Sprintf("%s\nYour previous answer was:\n%s\n\nIt was rejected because of these problems:\n- %s\n\nReturn the corrected JSON object in exactly the same structure.\n",
+			prompt, raw, strings.Join(problems, "\n- "))
+		raw, err = llm.GenerateJSON(ctx, LLMRequest{Task: taskReshuffle, Prompt: repair})
+		if err != nil {
+			return nil, err
+		}
+		rs, problems = decodeReshuffle(raw, len(day.Activities), index)
+	}
+	if len(problems) > 0 {
+		return nil, &ReshuffleValidationError{Problems: problems, Attempts: attempts}
+	}
+	return rs, nil
+}
+
+// handleReshuffleDay swaps one activity of a stored trip's day for a calmer one
+// and saves the result as a new revision.
+// Body: {"tripId", "day" (1-based), "activityIndex" (optional, 0-based), "constraint"}.
+// Without activityIndex the model picks the most demanding activity.
+func handleReshuffleDay(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var req struct {
+		TripID        string `json:"tripId"`
+		Day           int    `json:"day"`
+		ActivityIndex *int   `json:"activityIndex"`
+		Constraint    string `json:"constraint"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if req.TripID == "" || req.Day < 1 {
+		http.Error(w, "tripId and a day number are required", http.StatusBadRequest)
+		return
+	}
+	if req.Constraint == "" {
+		req.Constraint = "low-energy"
+	}
+
+	ctx := r.Context()
+	trip, err := loadOwnedTrip(ctx, req.TripID, userIDFrom(ctx))
+	if err != nil {
+		writeTripError(w, err)
+		return
+	}
+	if req.Day > len(trip.Itinerary.Itinerary) {
+		http.Error(w, fmt.Sprintf("trip has no day %d", req.Day), http.StatusNotFound)
+		return
+	}
+	day := trip.Itinerary.Itinerary[req.Day-1]
+	if i := req.ActivityIndex; i != nil && (*i < 0 || *i >= len(day.Activities)) {
+		http.Error(w, fmt.Sprintf("day %d has no activity %d", req.Day, *i), http.StatusNotFound)
+		return
+	}
+
+	rs, err := generateReshuffle(ctx, day, req.ActivityIndex, req.Constraint, repairRetries())
+	var verr *ReshuffleValidationError
+	if errors.As(err, &verr) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"error":    "invalid_reshuffle",
+			"message":  "The AI could not suggest a usable replacement, please try again.",
+			"problems": verr.Problems,
+			"attempts": verr.Attempts,
+		})
+		return
+	}
+	if err != nil {
+		http.Error(w, "AI error", http.StatusInternalServerError)
+		return
+	}
+
+	// The model was asked about the day as loaded above; refuse to apply the
+	// answer if that activity has been edited in the meantime. Activities hold
+	// pointers, so they are compared by value.
+	replaced := day.Activities[rs.ActivityIndex]
+	updated, err := updateOwnedTrip(r, req.TripID, revisionReshuffle, func(t *Trip) error {
+		days := t.Itinerary.Itinerary
+		if req.Day > len(days) || rs.ActivityIndex >= len(days[req.Day-1].Activities) ||
+			!reflect.DeepEqual(days[req.Day-1].Activities[rs.ActivityIndex], replaced) {
+			return errVersionConflict
+		}
+		days[req.Day-1].Activities[rs.ActivityIndex] = rs.Activity
+		return nil
+	})
+	if err != nil {
+		writeTripError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", fmt.Sprintf(`"%d"`, updated.Version))
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"tripId":        updated.ID,
+		"version":       updated.Version,
+		"activityIndex": rs.ActivityIndex,
+		"replaced":      replaced,
+		"activity":      rs.Activity,
+		"reason":        rs.Reason,
+		"day":           updated.Itinerary.Itinerary[req.Day-1],
+	})
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// An activity annotated by the sensory pass holds a pointer; reshuffling it
+// must still see it as unchanged.
+func TestReshuffleAnnotatedActivity(t *testing.T) {
+	useMemoryStore(t)
+	setGlobal[LLMProvider](t, &llm, NewFakeProvider())
+	ctx := context.WithValue(context.Background(), userIDKey, "user-1")
+	trip := &Trip{
+		UserID: "user-1",
+		Itinerary: Itinerary{TripTitle: "Kyoto", Destination: "Kyoto, Japan", Itinerary: []Day{{
+			Day:   1,
+			Title: "Temples",
+			Activities: []Activity{{
+				Time: "9:00 AM", Description: "Nishiki Market.", Category: "Food",
+				Sensory: &ActivitySensory{SensoryScores: SensoryScores{Audio: 80, Visual: 70, Crowds: 90}, Source: sensorySourceProfile, Exceeds: []string{"audio"}},
+			}},
+		}}},
+	}
+	if err := tripStore.CreateTrip(ctx, trip); err != nil {
+		t.Fatal(err)
+	}
+
+	body := `{"tripId": "` + trip.ID + `", "day": 1, "activityIndex": 0}`
+	req := httptest.NewRequest("POST", "/api/reshuffle-day", strings.NewReader(body)).WithContext(ctx)
+	rec := httptest.NewRecorder()
+	handleReshuffleDay(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("reshuffle returned %d: %s", rec.Code, rec.Body.String())
+	}
+	got, err := tripStore.GetTrip(ctx, trip.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if act := got.Itinerary.Itinerary[0].Activities[0]; act.Description != "Relax at a nearby tea house." {
+		t.Errorf("activity not replaced: %+v", act)
+	}
+}
@@ -0,0 +1,247 @@
+// backend/reviews.go
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	maxReviewCommentLength = 1000
+	maxReportNoteLength    = 200
+	maxReviewReports       = 30
+	maxVerificationNotes   = 3
+)
+
+// Report verdicts.
+const (
+	verdictConfirmed = "confirmed"
+	verdictDisputed  = "disputed"
+)
+
+// reportAspects are the accessibility claims a reviewer can confirm or dispute.
+var reportAspects = map[string]bool{
+	"stepFree":  true, // the route and venue need no steps
+	"quiet":     true, // calm enough for noise-sensitive travellers
+	"restSpots": true, // seating and places to rest along the way
+	"dietary":   true, // the food needs were catered for
+}
+
+// validate checks a review against the itinerary it is about.
+func (rv *Review) validate(it *Itinerary) error {
+	if rv.Rating < 1 || rv.Rating > 5 {
+		return errors.New("rating must be between 1 and 5")
+	}
+	rv.Comment = strings.TrimSpace(rv.Comment)
+	if len(rv.Comment) > maxReviewCommentLength {
+		return fmt.Errorf("comment must be at most %d characters", maxReviewCommentLength)
+	}
+	if len(rv.Reports) > maxReviewReports {
+		return fmt.Errorf("a review can carry at most %d reports", maxReviewReports)
+	}
+	seen := make(map[string]bool)
+	for i := range rv.Reports {
+		rep := &rv.Reports[i]
+		where := fmt.Sprintf("reports[%d]", i)
+		if rep.Day < 1 || rep.Day > len(it.Itinerary) {
+			return fmt.Errorf("%s: trip has no day %d", where, rep.Day)
+		}
+		if n := len(it.Itinerary[rep.Day-1].Activities); rep.ActivityIndex < 0 || rep.ActivityIndex >= n {
+			return fmt.Errorf("%s: day %d has no activity %d", where, rep.Day, rep.ActivityIndex)
+		}
+		if !reportAspects[rep.Aspect] {
+			return fmt.Errorf(`%s: aspect must be one of "stepFree", "quiet", "restSpots" or "dietary"`, where)
+		}
+		if rep.Verdict != verdictConfirmed && rep.Verdict != verdictDisputed {
+			return fmt.Errorf(`%s: verdict must be "confirmed" or "disputed"`, where)
+		}
+		rep.Note = strings.TrimSpace(rep.Note)
+		if len(rep.Note) > maxReportNoteLength {
+			return fmt.Errorf("%s: note must be at most %d characters", where, maxReportNoteLength)
+		}
+		key := fmt.Sprintf("%d/%d/%s", rep.Day, rep.ActivityIndex, rep.Aspect)
+		if seen[key] {
+			return fmt.Errorf("%s: day %d activity %d already has a %s report", where, rep.Day, rep.ActivityIndex, rep.Aspect)
+		}
+		seen[key] = true
+	}
+	return nil
+}
+
+// summarizeReviews works out the aggregates stored on a public trip.
+// Reviews come newest first, so the notes kept are the most recent ones.
+func summarizeReviews(reviews []Review) TripRatings {
+	var ratings TripRatings
+	total := 0
+	byActivity := make(map[string]*ActivityVerification)
+	for _, rv := range reviews {
+		ratings.Count++
+		total += rv.Rating
+		for _, rep := range rv.Reports {
+			key := fmt.Sprintf("%d/%d/%s", rep.Day, rep.ActivityIndex, rep.Aspect)
+			v, ok := byActivity[key]
+			if !ok {
+				v = &ActivityVerification{Day: rep.Day, ActivityIndex: rep.ActivityIndex, Aspect: rep.Aspect}
+				byActivity[key] = v
+			}
+			if rep.Verdict == verdictConfirmed {
+				v.Confirmed++
+			} else {
+				v.Disputed++
+			}
+			if rep.Note != "" && len(v.Notes) < maxVerificationNotes {
+				v.Notes = append(v.Notes, rep.Note)
+			}
+		}
+	}
+	if ratings.Count > 0 {
+		ratings.Average = math.Round(float64(total)/float64(ratings.Count)*10) / 10
+	}
+	for _, v := range byActivity {
+		ratings.Verified = append(ratings.Verified, *v)
+	}
+	sort.Slice(ratings.Verified, func(i, j int) bool {
+		a, b := ratings.Verified[i], ratings.Verified[j]
+		if a.Day != b.Day {
+			return a.Day < b.Day
+		}
+		if a.ActivityIndex != b.ActivityIndex {
+			return a.ActivityIndex < b.ActivityIndex
+		}
+		return a.Aspect < b.Aspect
+	})
+	return ratings
+}
+
+// tripRatings summarizes every stored review of a public trip.
+func tripRatings(ctx context.Context, publicTripId string) (TripRatings, error) {
+	reviews, err := reviewStore.ListReviews(ctx, publicTripId)
+	if err != nil {
+		return TripRatings{}, err
+	}
+	return summarizeReviews(reviews), nil
+}
+
+// refreshRatings recomputes the aggregates on the projection from the stored
+// reviews. Two reviews landing at once can leave the counts one behind until
+// the next review or republish recomputes them.
+func refreshRatings(ctx context.Context, publicTripId string) (*PublicTrip, error) {
+	ratings, err := tripRatings(ctx, publicTripId)
+	if err != nil {
+		return nil, err
+	}
+	return publicTripStore.UpdatePublicTrip(ctx, publicTripId, func(p *PublicTrip) error {
+		p.Ratings = ratings
+		return nil
+	})
+}
+
+// handlePublicTripReviews lists the reviews of an approved public trip (GET),
+// or lets a signed-in traveller post (PUT) or withdraw (DELETE) their own.
+// PUT body: {"rating": 1-5, "comment": "...", "reports": [{"day": 1,
+// "activityIndex": 0, "aspect": "stepFree", "verdict": "confirmed", "note": "..."}]}.
+func handlePublicTripReviews(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	id := r.PathValue("id")
+	userId := userIDFrom(ctx)
+	if r.Method != "GET" && r.Method != "PUT" && r.Method != "DELETE" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if r.Method != "GET" && userId == "" {
+		http.Error(w, "Missing or invalid Authorization header", http.StatusUnauthorized)
+		return
+	}
+	public, err := publicTripStore.GetPublicTrip(ctx, id)
+	if err == nil && public.ModerationStatus != moderationApproved {
+		err = ErrNotFound
+	}
+	if err != nil {
+		writeTripError(w, err)
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+		reviews, err := reviewStore.ListReviews(ctx, id)
+		if err != nil {
+			log.Printf("Failed to list reviews of %s: %v", id, err)
+			http.Error(w, "Failed to load reviews", http.StatusInternalServerError)
+			return
+		}
+		for i := range reviews {
+			reviews[i].UserID = ""
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"reviews": reviews, "ratings": public.Ratings})
+
+	case "PUT":
+		if public.AuthorID == userId {
+			http.Error(w, "You can't review your own trip", http.StatusForbidden)
+			return
+		}
+		var review Review
+		dec := json.NewDecoder(r.Body)
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&review); err != nil {
+			http.Error(w, "Invalid JSON: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := review.validate(&public.Itinerary); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		existing, err := reviewStore.ListReviews(ctx, id)
+		if err != nil {
+			log.Printf("Failed to list reviews of %s: %v", id, err)
+			http.Error(w, "Failed to save review", http.StatusInternalServerError)
+			return
+		}
+		now := time.Now().UTC()
+		review.PublicTripID, review.UserID = id, userId
+		review.UserName = authorName(ctx, userId, "")
+		review.CreatedAt, review.UpdatedAt = now, now
+		for _, rv := range existing {
+			if rv.UserID == userId {
+				review.CreatedAt = rv.CreatedAt
+			}
+		}
+		if err := reviewStore.PutReview(ctx, &review); err != nil {
+			log.Printf("Failed to save review of %s: %v", id, err)
+			http.Error(w, "Failed to save review", http.StatusInternalServerError)
+			return
+		}
+		public, err = refreshRatings(ctx, id)
+		if err != nil {
+			writeTripError(w, err)
+			return
+		}
+		review.UserID = ""
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"review": review, "ratings": public.Ratings})
+
+	case "DELETE":
+		if err := reviewStore.DeleteReview(ctx, id, userId); errors.Is(err, ErrNotFound) {
+			http.Error(w, "You have not reviewed this trip", http.StatusNotFound)
+			return
+		} else if err != nil {
+			log.Printf("Failed to delete review of %s: %v", id, err)
+			http.Error(w, "Failed to delete review", http.StatusInternalServerError)
+			return
+		}
+		if _, err := refreshRatings(ctx, id); err != nil {
+			writeTripError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,431 @@
+// backend/routing.go
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// Travel modes between activities.
+const (
+	modeWalk       = "walk"
+	modeWheelchair = "wheelchair"
+	modeTransit    = "transit"
+	modeDrive      = "drive"
+)
+
+// modeSpeeds is the average door-to-door speed of each mode in km/h.
+var modeSpeeds = map[string]float64{
+	modeWalk:       4.5,
+	modeWheelchair: 3.5,
+	modeTransit:    15,
+	modeDrive:      25,
+}
+
+const (
+	earthRadiusMeters = 6371000
+	// detourFactor turns a straight line into a rough street distance.
+	detourFactor = 1.3
+
+	defaultDwellMinutes = 60
+	baseBufferMinutes   = 5
+)
+
+// categoryDwellMinutes is how long a traveller usually spends at an activity
+// before moving on. Other categories get defaultDwellMinutes.
+var categoryDwellMinutes = map[string]int{
+	"food":          75,
+	"sightseeing":   90,
+	"culture":       120,
+	"nature":        120,
+	"adventure":     150,
+	"shopping":      60,
+	"relaxation":    90,
+	"nightlife":     120,
+	"transport":     15,
+	"accommodation": 15,
+}
+
+// LatLng is a point on the map.
+type LatLng struct {
+	Lat float64 `json:"lat"`
+	Lng float64 `json:"lng"`
+}
+
+// Leg is a router's estimate of getting from one point to another.
+type Leg struct {
+	Mode           string `json:"mode"`
+	DistanceMeters int    `json:"distanceMeters"`
+	Minutes        int    `json:"minutes"`
+	Source         string `json:"source"`
+}
+
+// Router is the blueprint for every source of travel times.
+type Router interface {
+	Route(ctx context.Context, from, to LatLng, mode string) (*Leg, error)
+}
+
+var router Router
+
+// initRouting picks a router from ROUTER: "haversine" (default) or "osrm".
+func initRouting() {
+	switch name := strings.ToLower(os.Getenv("ROUTER")); name {
+	case "", "haversine":
+		router = HaversineRouter{}
+	case "osrm":
+		baseURL := os.Getenv("ROUTER_URL")
+		if baseURL == "" {
+			log.Fatalf("ROUTER_URL is required for the osrm router")
+		}
+		router = NewOSRMRouter(baseURL)
+	default:
+		log.Fatalf("unknown ROUTER %q", name)
+	}
+}
+
+// haversineMeters is the great-circle distance between two points.
+func haversineMeters(a, b LatLng) float64 {
+	lat1, lat2 := a.Lat*math.Pi/180, b.Lat*math.Pi/180
+	dLat, dLng := lat2-lat1, (b.Lng-a.Lng)*math.Pi/180
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1)*math.Cos(lat2)*math.Sin(dLng/2)*math.Sin(dLng/2)
+	return 2 * earthRadiusMeters * math.Asin(math.Min(1, math.Sqrt(h)))
+}
+
+// HaversineRouter estimates legs from the straight-line distance, stretched
+// by detourFactor, at the average speed of the mode. It needs no network.
+type HaversineRouter struct{}
+
+func (HaversineRouter) Route(ctx context.Context, from, to LatLng, mode string) (*Leg, error) {
+	speed, ok := modeSpeeds[mode]
+	if !ok {
+		return nil, fmt.Errorf("unknown travel mode %q", mode)
+	}
+	meters := haversineMeters(from, to) * detourFactor
+	return &Leg{
+		Mode:           mode,
+		DistanceMeters: int(math.Round(meters)),
+		Minutes:        int(math.Ceil(meters / 1000 / speed * 60)),
+		Source:         "haversine",
+	}, nil
+}
+
+// osrmProfiles maps our modes to OSRM profiles. OSRM has no wheelchair
+// profile, so wheelchair legs use the foot route at wheelchair speed.
+var osrmProfiles = map[string]string{
+	modeWalk:       "foot",
+	modeWheelchair: "foot",
+	modeDrive:      "driving",
+}
+
+// OSRMRouter asks an OSRM-compatible server for street routes:
+// GET {baseURL}/route/v1/{profile}/{lng},{lat};{lng},{lat}. A local OSRM
+// container or any stand-in speaking the same API will do. OSRM has no
+// timetables, so transit legs fall back to the haversine estimate.
+type OSRMRouter struct {
+	baseURL  string
+	http     *http.Client
+	fallback Router
+}
+
+func NewOSRMRouter(baseURL string) *OSRMRouter {
+	return &OSRMRouter{
+		baseURL:  strings.TrimRight(baseURL, "/"),
+		http:     &http.Client{Timeout: 10 * time.Second},
+		fallback: HaversineRouter{},
+	}
+}
+
+func (o *OSRMRouter) Route(ctx context.Context, from, to LatLng, mode string) (*Leg, error) {
+	profile, ok := osrmProfiles[mode]
+	if !ok {
+		return o.fallback.Route(ctx, from, to, mode)
+	}
+	url := fmt.Sprintf("%s/route/v1/%s/%f,%f;%f,%f?overview=false", o.baseURL, profile, from.Lng, from.Lat, to.Lng, to.Lat)
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := o.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("router returned %s", resp.Status)
+	}
+	var out struct {
+		Code   string `json:"code"`
+		Routes []struct {
+			Distance float64 `json:"distance"` // meters
+			Duration float64 `json:"duration"` // seconds
+		} `json:"routes"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return nil, fmt.Errorf("router returned invalid JSON: %w", err)
+	}
+	if out.Code != "Ok" || len(out.Routes) == 0 {
+		return nil, fmt.Errorf("router found no route (%s)", out.Code)
+	}
+	seconds := out.Routes[0].Duration
+	if mode == modeWheelchair {
+		seconds *= modeSpeeds[modeWalk] / modeSpeeds[modeWheelchair]
+	}
+	return &Leg{
+		Mode:           mode,
+		DistanceMeters: int(math.Round(out.Routes[0].Distance)),
+		Minutes:        int(math.Ceil(seconds / 60)),
+		Source:         "osrm",
+	}, nil
+}
+
+// pickMode chooses how to travel a straight-line distance given the traveller's
+// mobility. Longer hops go by transit, and the walking limit shrinks for
+// travellers who need frequent rests.
+func pickMode(meters float64, m *MobilityPrefs) string {
+	limit, mode := 1500.0, modeWalk
+	if m != nil && m.Wheelchair {
+		limit, mode = 2000, modeWheelchair
+	}
+	if m != nil && m.FrequentRests {
+		limit = math.Min(limit, 800)
+	}
+	if meters > limit {
+		return modeTransit
+	}
+	return mode
+}
+
+// transferBuffer is the slack added on top of the travel time: finding lifts
+// and step-free entrances, boarding, and rest stops on the way.
+func transferBuffer(leg *Leg, m *MobilityPrefs) int {
+	buffer := baseBufferMinutes
+	if leg.Mode == modeTransit {
+		buffer += 10
+	}
+	if m == nil {
+		return buffer
+	}
+	if m.Wheelchair {
+		buffer += 10
+	}
+	if m.AvoidStairs {
+		buffer += 5
+	}
+	if m.FrequentRests {
+		buffer += 5 * ((leg.Minutes + 19) / 20)
+	}
+	return buffer
+}
+
+func dwellMinutes(act Activity) int {
+	if d, ok := categoryDwellMinutes[strings.ToLower(act.Category)]; ok {
+		return d
+	}
+	return defaultDwellMinutes
+}
+
+// Transfer is the move from one activity of a day to the next one.
+type Transfer struct {
+	Day           int `json:"day"`
+	ActivityIndex int `json:"activityIndex"` // the activity left; the next one is reached
+	Leg           Leg `json:"leg"`
+	DwellMinutes  int `json:"dwellMinutes"`
+	BufferMinutes int `json:"bufferMinutes"`
+	// Minutes between the two activities' start times, and the minutes the
+	// dwell, travel and buffer need out of them
+	AvailableMinutes int  `json:"availableMinutes"`
+	NeededMinutes    int  `json:"neededMinutes"`
+	Feasible         bool `json:"feasible"`
+}
+
+// TimeShift records an activity moved later to make room for a transfer.
+type TimeShift struct {
+	Day           int    `json:"day"`
+	ActivityIndex int    `json:"activityIndex"`
+	From          string `json:"from"`
+	To            string `json:"to"`
+}
+
+// legKey identifies the hop from activity index i of day d to index i+1.
+type legKey struct{ day, index int }
+
+// routeLegs estimates every hop between consecutive activities. A mode other
+// than "" forces that mode for every hop. When the router fails the haversine
+// estimate is used instead, so a flaky routing server never blocks a check.
+func routeLegs(ctx context.Context, it *Itinerary, mode string, m *MobilityPrefs) (map[legKey]*Leg, error) {
+	legs := make(map[legKey]*Leg)
+	for _, day := range it.Itinerary {
+		for i := 0; i+1 < len(day.Activities); i++ {
+			from := LatLng{day.Activities[i].Lat, day.Activities[i].Lng}
+			to := LatLng{day.Activities[i+1].Lat, day.Activities[i+1].Lng}
+			hopMode := mode
+			if hopMode == "" {
+				hopMode = pickMode(haversineMeters(from, to)*detourFactor, m)
+			}
+			leg, err := router.Route(ctx, from, to, hopMode)
+			if err != nil {
+				if ctx.Err() != nil {
+					return nil, ctx.Err()
+				}
+				log.Printf("Router failed for day %d hop %d, using haversine: %v", day.Day, i, err)
+				if leg, err = (HaversineRouter{}).Route(ctx, from, to, hopMode); err != nil {
+					return nil, err
+				}
+			}
+			legs[legKey{day.Day, i}] = leg
+		}
+	}
+	return legs, nil
+}
+
+// checkTransfers compares each hop against the gap between start times.
+// Hops where either activity's time can't be read are left out.
+func checkTransfers(it *Itinerary, legs map[legKey]*Leg, m *MobilityPrefs) []Transfer {
+	transfers := []Transfer{}
+	for _, day := range it.Itinerary {
+		for i := 0; i+1 < len(day.Activities); i++ {
+			leg, ok := legs[legKey{day.Day, i}]
+			start, err1 := parseActivityTime(day.Activities[i].Time)
+			next, err2 := parseActivityTime(day.Activities[i+1].Time)
+			if !ok || err1 != nil || err2 != nil {
+				continue
+			}
+			t := Transfer{
+				Day:              day.Day,
+				ActivityIndex:    i,
+				Leg:              *leg,
+				DwellMinutes:     dwellMinutes(day.Activities[i]),
+				BufferMinutes:    transferBuffer(leg, m),
+				AvailableMinutes: int(next.Sub(start).Minutes()),
+			}
+			t.NeededMinutes = t.DwellMinutes + leg.Minutes + t.BufferMinutes
+			t.Feasible = t.NeededMinutes <= t.AvailableMinutes
+			transfers = append(transfers, t)
+		}
+	}
+	return transfers
+}
+
+// insertBuffers pushes activities later until every transfer fits, rounding
+// new times up to five minutes. Nothing is pushed past midnight; such hops
+// stay infeasible for the traveller to resolve.
+func insertBuffers(it *Itinerary, legs map[legKey]*Leg, m *MobilityPrefs) []TimeShift {
+	shifts := []TimeShift{}
+	for d := range it.Itinerary {
+		day := &it.Itinerary[d]
+		for i := 0; i+1 < len(day.Activities); i++ {
+			leg, ok := legs[legKey{day.Day, i}]
+			start, err1 := parseActivityTime(day.Activities[i].Time)
+			next, err2 := parseActivityTime(day.Activities[i+1].Time)
+			if !ok || err1 != nil || err2 != nil {
+				continue
+			}
+			needed := dwellMinutes(day.Activities[i]) + leg.Minutes + transferBuffer(leg, m)
+			earliest := start.Add(time.Duration(needed) * time.Minute)
+			if !next.Before(earliest) {
+				continue
+			}
+			earliest = earliest.Add(time.Duration((5-earliest.Minute()%5)%5) * time.Minute)
+			if earliest.Day() != start.Day() {
+				continue
+			}
+			to := earliest.Format("3:04 PM")
+			shifts = append(shifts, TimeShift{Day: day.Day, ActivityIndex: i + 1, From: day.Activities[i+1].Time, To: to})
+			day.Activities[i+1].Time = to
+		}
+	}
+	return shifts
+}
+
+func countInfeasible(transfers []Transfer) int {
+	n := 0
+	for _, t := range transfers {
+		if !t.Feasible {
+			n++
+		}
+	}
+	return n
+}
+
+// handleTripTransfers checks whether the traveller can get between the
+// activities of a trip in time (GET), or moves activities later so every
+// transfer fits and saves that as a new revision (POST, If-Match honoured).
+// ?mode= forces walk, wheelchair, transit or drive; by default each hop picks
+// a mode from its distance and the caller's mobility profile.
+func handleTripTransfers(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" && r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	mode := strings.ToLower(r.URL.Query().Get("mode"))
+	if _, ok := modeSpeeds[mode]; mode != "" && !ok {
+		http.Error(w, `mode must be "walk", "wheelchair", "transit" or "drive"`, http.StatusBadRequest)
+		return
+	}
+	ctx := r.Context()
+	userId := userIDFrom(ctx)
+	trip, err := loadOwnedTrip(ctx, r.PathValue("id"), userId)
+	if err != nil {
+		writeTripError(w, err)
+		return
+	}
+	profile, err := profileStore.GetProfile(ctx, userId)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		log.Printf("Failed to load profile for %s: %v", userId, err)
+		http.Error(w, "Failed to load profile", http.StatusInternalServerError)
+		return
+	}
+	var mobility *MobilityPrefs
+	if profile != nil {
+		mobility = profile.Mobility
+	}
+	// Legs are routed before the update so no router call runs inside the store transaction.
+	legs, err := routeLegs(ctx, &trip.Itinerary, mode, mobility)
+	if err != nil {
+		log.Printf("Failed to route trip %s: %v", trip.ID, err)
+		http.Error(w, "Failed to estimate transfers", http.StatusInternalServerError)
+		return
+	}
+
+	if r.Method == "GET" {
+		transfers := checkTransfers(&trip.Itinerary, legs, mobility)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"transfers":  transfers,
+			"infeasible": countInfeasible(transfers),
+		})
+		return
+	}
+
+	routed := trip.Version
+	var shifts []TimeShift
+	trip, err = updateOwnedTrip(r, trip.ID, revisionTransfers, func(t *Trip) error {
+		if t.Version != routed {
+			return errVersionConflict
+		}
+		shifts = insertBuffers(&t.Itinerary, legs, mobility)
+		return nil
+	})
+	if err != nil {
+		writeTripError(w, err)
+		return
+	}
+	transfers := checkTransfers(&trip.Itinerary, legs, mobility)
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", fmt.Sprintf(`"%d"`, trip.Version))
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"trip":       trip,
+		"shifted":    shifts,
+		"transfers":  transfers,
+		"infeasible": countInfeasible(transfers),
+	})
+}
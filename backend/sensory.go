@@ -0,0 +1,395 @@
+// backend/sensory.go
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	// sensoryBucketHours is the width of one bucket of a sensory profile.
+	sensoryBucketHours       = 2
+	sensoryBucketCount       = 24 / sensoryBucketHours
+	defaultSensoryCacheTTL   = 7 * 24 * time.Hour
+	maxSensoryLocationLength = 200
+	// sensoryAnyDay is the weekday of profiles asked for without a date.
+	sensoryAnyDay = "any"
+)
+
+// sensoryCacheTTL is how long a generated profile is served from the cache.
+var sensoryCacheTTL = defaultSensoryCacheTTL
+
+// initSensory reads SENSORY_CACHE_TTL, a duration like 72h.
+func initSensory() {
+	if v := os.Getenv("SENSORY_CACHE_TTL"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			log.Fatalf("SENSORY_CACHE_TTL must be a positive duration like 168h")
+		}
+		sensoryCacheTTL = d
+	}
+}
+
+// sensoryWeekday names the weekday of profiles, so Saturday markets and quiet
+// Sunday mornings get their own entry.
+func sensoryWeekday(d time.Weekday) string {
+	return strings.ToLower(d.String())
+}
+
+// sensoryKey is the cache key of a location on a weekday. Case and spacing
+// of the location don't matter.
+func sensoryKey(location, weekday string) string {
+	return strings.Join(strings.Fields(strings.ToLower(location)), " ") + "\x00" + weekday
+}
+
+// at returns the scores of the bucket holding hour (0-23).
+func (p *SensoryProfile) at(hour int) SensoryScores {
+	i := hour / sensoryBucketHours
+	if i < 0 || i >= len(p.Buckets) {
+		return p.peak()
+	}
+	return p.Buckets[i].SensoryScores
+}
+
+// peak is the highest score of each sense over the whole day.
+func (p *SensoryProfile) peak() SensoryScores {
+	var s SensoryScores
+	for _, b := range p.Buckets {
+		s.Audio, s.Visual, s.Crowds = max(s.Audio, b.Audio), max(s.Visual, b.Visual), max(s.Crowds, b.Crowds)
+	}
+	return s
+}
+
+// SensoryValidationError is returned when the model never produced a usable profile.
+type SensoryValidationError struct {
+	Problems []string
+	Attempts int
+}
+
+func (e *SensoryValidationError) Error() string {
+	return fmt.Sprintf("sensory profile still invalid after %d attempts: %s", e.Attempts, strings.Join(e.Problems, "; "))
+}
+
+func buildSensoryPrompt(location, weekday string) string {
+	when := "on a typical " + weekday
+	if weekday == sensoryAnyDay {
+		when = "on a typical day"
+	}
+	var hours []string
+	for h := 0; h < 24; h += sensoryBucketHours {
+		hours = append(hours, fmt.Sprint(h))
+	}
+	return fmt.Sprintf(`
+Act as a sensory data analyst. Analyze '%s' %s and generate a sensory profile for each %d-hour period of the day. Consider noise from traffic and people, visual clutter from shops, signs and lights, and crowd density, and how each changes with opening hours, rush hours and nightlife.
+Output JSON: {"summary": "Short descriptive paragraph mentioning the calmest and busiest times.", "buckets": [{"hour": 0, "audio": 1-100, "visual": 1-100, "crowds": 1-100}, ...]}
+Give exactly one bucket for each starting hour %s, in that order. Scores are whole numbers where 1 is calm and 100 is overwhelming.
+`, location, when, sensoryBucketHours, strings.Join(hours, ", "))
+}
+
+// decodeSensoryProfile parses a model answer and checks every bucket of the day is there once.
+func decodeSensoryProfile(raw string) (*SensoryProfile, []string) {
+	var p SensoryProfile
+	if err := json.Unmarshal([]byte(raw), &p); err != nil {
+		return nil, []string{"response is not a valid sensory profile JSON object: " + err.Error()}
+	}
+	var problems []string
+	if strings.TrimSpace(p.Summary) == "" {
+		problems = append(problems, "summary is empty")
+	}
+	seen := make(map[int]bool)
+	for i, b := range p.Buckets {
+		where := fmt.Sprintf("buckets[%d]", i)
+		if b.Hour < 0 || b.Hour > 23 || b.Hour%sensoryBucketHours != 0 {
+			problems = append(problems, fmt.Sprintf("%s: hour %d is not the start of a %d-hour bucket", where, b.Hour, sensoryBucketHours))
+			continue
+		}
+		if seen[b.Hour] {
+			problems = append(problems, fmt.Sprintf("%s: hour %d is listed twice", where, b.Hour))
+		}
+		seen[b.Hour] = true
+		for _, score := range []struct {
+			name  string
+			value int
+		}{{"audio", b.Audio}, {"visual", b.Visual}, {"crowds", b.Crowds}} {
+			if score.value < 1 || score.value > 100 {
+				problems = append(problems, fmt.Sprintf("%s: %s must be between 1 and 100, got %d", where, score.name, score.value))
+			}
+		}
+	}
+	for h := 0; h < 24; h += sensoryBucketHours {
+		if !seen[h] {
+			problems = append(problems, fmt.Sprintf("the bucket starting at hour %d is missing", h))
+		}
+	}
+	sort.Slice(p.Buckets, func(i, j int) bool { return p.Buckets[i].Hour < p.Buckets[j].Hour })
+	return &p, problems
+}
+
+// generateSensoryProfile asks for a profile and repairs it like generateReshuffle does.
+func generateSensoryProfile(ctx context.Context, location, weekday string, retries int) (*SensoryProfile, error) {
+	prompt := buildSensoryPrompt(location, weekday)
+	raw, err := llm.GenerateJSON(ctx, LLMRequest{Task: taskSensory, Prompt: prompt})
+	if err != nil {
+		return nil, err
+	}
+	p, problems := decodeSensoryProfile(raw)
+	attempts := 1
+	for ; len(problems) > 0 && attempts <= retries; attempts++ {
+		repair := fmt.Sprintf("%s\nYour previous answer was:\n%s\n\nIt was rejected because of these problems:\n- %s\n\nReturn the corrected JSON object in exactly the same structure.\n",
+			prompt, raw, strings.Join(problems, "\n- "))
+		raw, err = llm.GenerateJSON(ctx, LLMRequest{Task: taskSensory, Prompt: repair})
+		if err != nil {
+			return nil, err
+		}
+		p, problems = decodeSensoryProfile(raw)
+	}
+	if len(problems) > 0 {
+		return nil, &SensoryValidationError{Problems: problems, Attempts: attempts}
+	}
+	return p, nil
+}
+
+// sensoryCall is a profile being generated; concurrent requests for the same
+// key wait for it instead of asking the model again.
+type sensoryCall struct {
+	done    chan struct{}
+	profile *SensoryProfile
+	err     error
+}
+
+var sensoryInFlight = struct {
+	sync.Mutex
+	calls map[string]*sensoryCall
+}{calls: make(map[string]*sensoryCall)}
+
+// sensoryProfileFor returns the profile of location on weekday from the
+// cache, generating and caching it when it is missing or expired. cached
+// reports whether the model was spared.
+func sensoryProfileFor(ctx context.Context, location, weekday string) (profile *SensoryProfile, cached bool, err error) {
+	key := sensoryKey(location, weekday)
+	stored, err := sensoryStore.GetSensoryProfile(ctx, key)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return nil, false, err
+	}
+	if err == nil && time.Now().Before(stored.ExpiresAt) {
+		return stored, true, nil
+	}
+
+	sensoryInFlight.Lock()
+	call, waiting := sensoryInFlight.calls[key]
+	if !waiting {
+		call = &sensoryCall{done: make(chan struct{})}
+		sensoryInFlight.calls[key] = call
+	}
+	sensoryInFlight.Unlock()
+	if !waiting {
+		// Finish even if this caller goes away: others may be waiting and the
+		// result is worth caching either way.
+		go func() {
+			defer func() {
+				sensoryInFlight.Lock()
+				delete(sensoryInFlight.calls, key)
+				sensoryInFlight.Unlock()
+				close(call.done)
+			}()
+			call.profile, call.err = generateAndCacheSensoryProfile(context.WithoutCancel(ctx), key, location, weekday)
+		}()
+	}
+	select {
+	case <-call.done:
+		return call.profile, false, call.err
+	case <-ctx.Done():
+		return nil, false, ctx.Err()
+	}
+}
+
+func generateAndCacheSensoryProfile(ctx context.Context, key, location, weekday string) (*SensoryProfile, error) {
+	p, err := generateSensoryProfile(ctx, location, weekday, repairRetries())
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	p.Key, p.Location, p.Weekday = key, location, weekday
+	p.GeneratedAt, p.ExpiresAt = now, now.Add(sensoryCacheTTL)
+	if err := sensoryStore.PutSensoryProfile(ctx, p); err != nil {
+		// Serving the fresh profile matters more than caching it.
+		log.Printf("Failed to cache sensory profile for %q: %v", location, err)
+	}
+	return p, nil
+}
+
+// sensoryVisit is when and where a traveller will be.
+type sensoryVisit struct {
+	Location string
+	Weekday  string
+	Hour     *int
+}
+
+// tripVisit describes the visit planned for an activity of a trip. The
+// weekday is only known when the trip has a start date. Long descriptions
+// are cut so the location stays within maxSensoryLocationLength.
+func tripVisit(trip *Trip, day int, act Activity) sensoryVisit {
+	v := sensoryVisit{Location: strings.TrimSpace(act.Description), Weekday: sensoryAnyDay}
+	if dest := strings.TrimSpace(trip.Itinerary.Destination); dest != "" {
+		room := max(0, maxSensoryLocationLength-len(dest)-len(", "))
+		v.Location = truncateUTF8(v.Location, room) + ", " + dest
+	}
+	v.Location = truncateUTF8(v.Location, maxSensoryLocationLength)
+	if start, err := time.Parse(tripDateLayout, trip.StartDate); err == nil {
+		v.Weekday = sensoryWeekday(start.AddDate(0, 0, day-1).Weekday())
+	}
+	if t, err := parseActivityTime(act.Time); err == nil {
+		hour := t.Hour()
+		v.Hour = &hour
+	}
+	return v
+}
+
+// truncateUTF8 cuts s to at most n bytes without splitting a character.
+func truncateUTF8(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return strings.TrimSpace(s[:n])
+}
+
+// handleSensoryProfile returns the sensory profile of a place at the time of
+// a visit. Body: either {"location": "...", "date": "2006-01-02", "time":
+// "2:00 PM"} with date and time optional (a "weekday" like "saturday" may
+// stand in for the date), or {"tripId": "...", "day": 1, "activityIndex": 0}
+// for an activity of the caller's trip. The top-level scores are those of the
+// visit hour, or the day's peak when no time is known; buckets hold the whole
+// day. Profiles are cached per location and weekday for SENSORY_CACHE_TTL.
+func handleSensoryProfile(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var req struct {
+		Location      string `json:"location"`
+		Date          string `json:"date"`
+		Time          string `json:"time"`
+		Weekday       string `json:"weekday"`
+		TripID        string `json:"tripId"`
+		Day           int    `json:"day"`
+		ActivityIndex int    `json:"activityIndex"`
+	}
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx := r.Context()
+	var visit sensoryVisit
+	if req.TripID != "" {
+		if req.Location != "" || req.Date != "" || req.Time != "" || req.Weekday != "" {
+			http.Error(w, "give either tripId or location, not both", http.StatusBadRequest)
+			return
+		}
+		trip, err := loadOwnedTrip(ctx, req.TripID, userIDFrom(ctx))
+		if err != nil {
+			writeTripError(w, err)
+			return
+		}
+		if req.Day < 1 || req.Day > len(trip.Itinerary.Itinerary) {
+			http.Error(w, fmt.Sprintf("trip has no day %d", req.Day), http.StatusBadRequest)
+			return
+		}
+		acts := trip.Itinerary.Itinerary[req.Day-1].Activities
+		if req.ActivityIndex < 0 || req.ActivityIndex >= len(acts) {
+			http.Error(w, fmt.Sprintf("day %d has no activity %d", req.Day, req.ActivityIndex), http.StatusBadRequest)
+			return
+		}
+		visit = tripVisit(trip, req.Day, acts[req.ActivityIndex])
+	} else {
+		visit = sensoryVisit{Location: strings.TrimSpace(req.Location), Weekday: sensoryAnyDay}
+		if visit.Location == "" {
+			http.Error(w, "location or tripId is required", http.StatusBadRequest)
+			return
+		}
+		if len(visit.Location) > maxSensoryLocationLength {
+			http.Error(w, fmt.Sprintf("location must be at most %d characters", maxSensoryLocationLength), http.StatusBadRequest)
+			return
+		}
+		switch {
+		case req.Date != "" && req.Weekday != "":
+			http.Error(w, "give either date or weekday, not both", http.StatusBadRequest)
+			return
+		case req.Date != "":
+			d, err := time.Parse(tripDateLayout, req.Date)
+			if err != nil {
+				http.Error(w, fmt.Sprintf("date %q must look like 2006-01-02", req.Date), http.StatusBadRequest)
+				return
+			}
+			visit.Weekday = sensoryWeekday(d.Weekday())
+		case req.Weekday != "":
+			visit.Weekday = strings.ToLower(strings.TrimSpace(req.Weekday))
+			known := false
+			for d := time.Sunday; d <= time.Saturday; d++ {
+				known = known || visit.Weekday == sensoryWeekday(d)
+			}
+			if !known {
+				http.Error(w, fmt.Sprintf("weekday %q must be a day name like saturday", req.Weekday), http.StatusBadRequest)
+				return
+			}
+		}
+		if req.Time != "" {
+			t, err := parseActivityTime(req.Time)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			hour := t.Hour()
+			visit.Hour = &hour
+		}
+	}
+	profile, cached, err := sensoryProfileFor(ctx, visit.Location, visit.Weekday)
+	var verr *SensoryValidationError
+	if errors.As(err, &verr) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"error":    "invalid_sensory_profile",
+			"message":  "The AI could not produce a usable sensory profile, please try again.",
+			"problems": verr.Problems,
+		})
+		return
+	}
+	if err != nil {
+		log.Printf("Sensory profile for %q failed: %v", visit.Location, err)
+		http.Error(w, "AI error", http.StatusInternalServerError)
+		return
+	}
+
+	scores := profile.peak()
+	if visit.Hour != nil {
+		scores = profile.at(*visit.Hour)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		SensoryScores
+		Location  string          `json:"location"`
+		Weekday   string          `json:"weekday"`
+		Hour      *int            `json:"hour,omitempty"`
+		Summary   string          `json:"summary"`
+		Buckets   []SensoryBucket `json:"buckets"`
+		Cached    bool            `json:"cached"`
+		ExpiresAt time.Time       `json:"expiresAt"`
+	}{scores, visit.Location, visit.Weekday, visit.Hour, profile.Summary, profile.Buckets, cached, profile.ExpiresAt})
+}
@@ -0,0 +1,248 @@
+// backend/sensory_limits.go
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// sensoryLimitFloor is the highest score a traveller with no tolerance at
+	// all still accepts; hardly anywhere out of the house scores lower.
+	sensoryLimitFloor = 25
+	// sensoryAlternatives is how many replacements are asked for an activity
+	// before it is left in place with its violation flagged.
+	sensoryAlternatives = 2
+	// sensoryMaxSwaps bounds how many activities of one itinerary get
+	// alternatives searched for; any further ones over a limit are flagged.
+	sensoryMaxSwaps = 6
+	// sensoryScoringWorkers bounds the profile lookups and alternative
+	// searches running at once.
+	sensoryScoringWorkers = 4
+	// sensoryPassTimeout bounds the whole pass, which runs while the
+	// traveller waits for their itinerary.
+	sensoryPassTimeout = 45 * time.Second
+)
+
+// Where the scores of an ActivitySensory came from.
+const (
+	sensorySourceProfile  = "profile"
+	sensorySourceCategory = "category" // no profile could be had; estimated from the category
+)
+
+// ActivitySensory is the expected sensory load of an activity the sensory
+// pass had to act on: either it replaced a more intense activity, or it is
+// still over the traveller's limits in the senses listed in Exceeds.
+type ActivitySensory struct {
+	SensoryScores
+	Source   string   `json:"source" firestore:"source"`
+	Exceeds  []string `json:"exceeds,omitempty" firestore:"exceeds,omitempty"`
+	Replaces string   `json:"replaces,omitempty" firestore:"replaces,omitempty"`
+}
+
+// sensoryLimits turns a traveller's tolerances (0 needs calm, 100 handles
+// anything) into the highest score they accept per sense. Crowds are both
+// loud and busy to look at, so they get the stricter of the two limits.
+func sensoryLimits(p *SensoryPrefs) SensoryScores {
+	scale := func(tolerance int) int {
+		return sensoryLimitFloor + tolerance*(100-sensoryLimitFloor)/100
+	}
+	audio, visual := scale(p.Noise), scale(p.Visual)
+	return SensoryScores{Audio: audio, Visual: visual, Crowds: min(audio, visual)}
+}
+
+// exceeds lists the senses in which s goes over limit.
+func (s SensoryScores) exceeds(limit SensoryScores) []string {
+	var over []string
+	if s.Audio > limit.Audio {
+		over = append(over, "audio")
+	}
+	if s.Visual > limit.Visual {
+		over = append(over, "visual")
+	}
+	if s.Crowds > limit.Crowds {
+		over = append(over, "crowds")
+	}
+	return over
+}
+
+// sensoryLimitsFor loads the limits of a signed-in traveller who opted in to
+// sensory limits, or returns nil when there is nothing to enforce. The
+// tolerances default to 0, so without the opt-in nearly every activity would
+// be over.
+func sensoryLimitsFor(ctx context.Context, userId string) *SensoryScores {
+	if userId == "" {
+		return nil
+	}
+	profile, err := profileStore.GetProfile(ctx, userId)
+	if err != nil {
+		if !errors.Is(err, ErrNotFound) {
+			log.Printf("Failed to load profile for %s: %v", userId, err)
+		}
+		return nil
+	}
+	if profile.Sensory == nil || !profile.Sensory.Limits {
+		return nil
+	}
+	limits := sensoryLimits(profile.Sensory)
+	if limits == (SensoryScores{Audio: 100, Visual: 100, Crowds: 100}) {
+		return nil // handles anything; nothing could go over
+	}
+	return &limits
+}
+
+// scoreActivity looks up the expected load of act at its planned time on the
+// given day of trip. When no profile can be had it falls back to the
+// category estimate for every sense, so an activity is never waved through
+// unscored.
+func scoreActivity(ctx context.Context, trip *Trip, day int, act Activity) (SensoryScores, string) {
+	visit := tripVisit(trip, day, act)
+	profile, _, err := sensoryProfileFor(ctx, visit.Location, visit.Weekday)
+	if err != nil {
+		log.Printf("No sensory profile for %q, estimating from its category: %v", visit.Location, err)
+		load := categoryLoad(act.Category)
+		return SensoryScores{Audio: load, Visual: load, Crowds: load}, sensorySourceCategory
+	}
+	if visit.Hour == nil {
+		return profile.peak(), sensorySourceProfile
+	}
+	return profile.at(*visit.Hour), sensorySourceProfile
+}
+
+func buildSensoryAlternativePrompt(day Day, index int, scores, limits SensoryScores, rejected []string) string {
+	dayJSON, _ := json.Marshal(day)
+	act := day.Activities[index]
+	tried := ""
+	if len(rejected) > 0 {
+		tried = fmt.Sprintf("These alternatives were suggested already and are too intense as well: %s.\n", strings.Join(rejected, "; "))
+	}
+	return fmt.Sprintf(`
+You are Auryvia, a compassionate travel AI. The traveller is autistic or otherwise sensitive to noise, visual clutter and crowds.
+Here is the day as JSON: %s
+
+The activity at index %d (0-based), %q at %s, is expected to score audio %d, visual %d and crowds %d out of 100 at that time, but the traveller is only comfortable up to audio %d, visual %d and crowds %d.
+%sSuggest one calmer alternative close to the original that keeps the spirit of the day and fits the same time slot: a quieter venue, a less busy place, or somewhere calm nearby.
+Output JSON: {"activityIndex": %d, "reason": "why it is calmer", "activity": {"time": %q, "description": "...", "category": "...", "lat": 0.0, "lng": 0.0}}
+The time must look like "9:00 AM", the category must be one of: %s, and lat/lng must be real coordinates.
+`, dayJSON, index, act.Description, act.Time, scores.Audio, scores.Visual, scores.Crowds,
+		limits.Audio, limits.Visual, limits.Crowds, tried, index, act.Time, categoryList())
+}
+
+// enforceSensoryLimits scores every activity of it against limits. Up to
+// sensoryMaxSwaps of those over a limit are swapped for a calmer alternative
+// when the model can find one that fits in time; the rest stay, flagged
+// through Sensory and Conflict, so nothing over the traveller's limits ever
+// goes out unmarked. It returns how many activities are still over.
+func enforceSensoryLimits(ctx context.Context, it *Itinerary, limits SensoryScores) int {
+	ctx, cancel := context.WithTimeout(ctx, sensoryPassTimeout)
+	defer cancel()
+	trip := &Trip{Itinerary: *it}
+	type scored struct {
+		scores SensoryScores
+		source string
+	}
+	results := make([][]scored, len(it.Itinerary))
+	sem := make(chan struct{}, sensoryScoringWorkers)
+	var wg sync.WaitGroup
+	for d, day := range it.Itinerary {
+		results[d] = make([]scored, len(day.Activities))
+		for i, act := range day.Activities {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				sem <- struct{}{}
+				defer func() { <-sem }()
+				s, source := scoreActivity(ctx, trip, day.Day, act)
+				results[d][i] = scored{s, source}
+			}()
+		}
+	}
+	wg.Wait()
+
+	// Alternatives are searched for concurrently, each against the day as
+	// generated, and only swapped in once all searches are done.
+	type swap struct {
+		day, index int
+		alt        *Activity
+	}
+	var swaps []*swap
+	for d, day := range it.Itinerary {
+		for i := range day.Activities {
+			if len(swaps) == sensoryMaxSwaps {
+				break
+			}
+			res := results[d][i]
+			if len(res.scores.exceeds(limits)) == 0 {
+				continue
+			}
+			s := &swap{day: d, index: i}
+			swaps = append(swaps, s)
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				sem <- struct{}{}
+				defer func() { <-sem }()
+				s.alt = findCalmerActivity(ctx, trip, day, i, res.scores, limits)
+			}()
+		}
+	}
+	wg.Wait()
+	swapped := make(map[[2]int]bool)
+	for _, s := range swaps {
+		if s.alt != nil {
+			it.Itinerary[s.day].Activities[s.index] = *s.alt
+			swapped[[2]int{s.day, s.index}] = true
+		}
+	}
+
+	over := 0
+	for d := range it.Itinerary {
+		day := &it.Itinerary[d]
+		for i := range day.Activities {
+			res := results[d][i]
+			exceeds := res.scores.exceeds(limits)
+			if len(exceeds) == 0 || swapped[[2]int{d, i}] {
+				continue
+			}
+			act := &day.Activities[i]
+			act.Sensory = &ActivitySensory{SensoryScores: res.scores, Source: res.source, Exceeds: exceeds}
+			act.Conflict = fmt.Sprintf("Expected to be above your comfort limits for %s around %s, and no calmer alternative was found.",
+				strings.Join(exceeds, ", "), act.Time)
+			over++
+		}
+	}
+	return over
+}
+
+// findCalmerActivity asks for up to sensoryAlternatives replacements of
+// activity index of day and returns the first that stays within limits, or
+// nil when none does.
+func findCalmerActivity(ctx context.Context, trip *Trip, day Day, index int, scores, limits SensoryScores) *Activity {
+	original := day.Activities[index]
+	var rejected []string
+	for attempt := 0; attempt < sensoryAlternatives; attempt++ {
+		i := index
+		prompt := buildSensoryAlternativePrompt(day, index, scores, limits, rejected)
+		rs, err := generateReplacement(ctx, prompt, day, &i, repairRetries())
+		if err != nil {
+			log.Printf("No calmer alternative for day %d activity %d: %v", day.Day, index, err)
+			return nil
+		}
+		alt := rs.Activity
+		alt.Time, alt.Locked = original.Time, original.Locked
+		altScores, altSource := scoreActivity(ctx, trip, day.Day, alt)
+		if len(altScores.exceeds(limits)) == 0 {
+			alt.Sensory = &ActivitySensory{SensoryScores: altScores, Source: altSource, Replaces: original.Description}
+			return &alt
+		}
+		rejected = append(rejected, fmt.Sprintf("%q", alt.Description))
+	}
+	return nil
+}
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+// A trip activity's location is derived, so a long description is cut to
+// fit rather than rejected.
+func TestTripVisitLongDescription(t *testing.T) {
+	trip := &Trip{Itinerary: Itinerary{Destination: "Kyoto, Japan"}}
+	act := Activity{Time: "2:00 PM", Description: strings.Repeat("静かな庭園を散歩します。", 30)}
+	visit := tripVisit(trip, 1, act)
+	if len(visit.Location) > maxSensoryLocationLength || !utf8.ValidString(visit.Location) {
+		t.Fatalf("location is %d bytes, valid UTF-8 %v", len(visit.Location), utf8.ValidString(visit.Location))
+	}
+	if !strings.HasSuffix(visit.Location, ", Kyoto, Japan") {
+		t.Errorf("location %q lost its destination", visit.Location)
+	}
+	if visit.Hour == nil || *visit.Hour != 14 {
+		t.Errorf("hour = %v, want 14", visit.Hour)
+	}
+}
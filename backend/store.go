@@ -0,0 +1,528 @@
+// backend/store.go
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"os"
+	"strings"
+	"time"
+)
+
+// ErrNotFound is returned by stores when a document does not exist.
+var ErrNotFound = errors.New("not found")
+
+// Revision reasons recorded with every trip version.
+const (
+	revisionCreate    = "create"
+	revisionUpdate    = "update"
+	revisionPatch     = "patch"
+	revisionRestore   = "restore"
+	revisionReshuffle = "reshuffle"
+	revisionPublish   = "publish"
+	revisionUnpublish = "unpublish"
+	revisionTransfers = "transfers"
+	revisionOptimize  = "optimize"
+)
+
+// This is the blueprint for a saved trip. Dates are calendar days ("2006-01-02").
+type Trip struct {
+	ID            string            `json:"id" firestore:"-"`
+	UserID        string            `json:"userId" firestore:"userId"`
+	Itinerary     Itinerary         `json:"itinerary" firestore:"itinerary"`
+	StartDate     string            `json:"startDate,omitempty" firestore:"startDate,omitempty"`
+	EndDate       string            `json:"endDate,omitempty" firestore:"endDate,omitempty"`
+	Accessibility TripAccessibility `json:"accessibility" firestore:"accessibility"`
+	Budget        Money             `json:"budget,omitzero" firestore:"budget,omitempty"`
+	IsPublic      bool              `json:"isPublic" firestore:"isPublic"`
+	ForkedFrom    *TripAttribution  `json:"forkedFrom,omitempty" firestore:"forkedFrom,omitempty"`
+	Version       int               `json:"version" firestore:"version"`
+	CreatedAt     time.Time         `json:"createdAt" firestore:"createdAt"`
+	UpdatedAt     time.Time         `json:"updatedAt" firestore:"updatedAt"`
+}
+
+// This is the blueprint for the credit a forked trip keeps to the public trip it was copied from.
+type TripAttribution struct {
+	PublicTripID string    `json:"publicTripId" firestore:"publicTripId"`
+	TripTitle    string    `json:"tripTitle" firestore:"tripTitle"`
+	AuthorName   string    `json:"authorName" firestore:"authorName"`
+	ForkedAt     time.Time `json:"forkedAt" firestore:"forkedAt"`
+}
+
+// This is the blueprint for one numbered snapshot of a trip.
+type TripRevision struct {
+	Version   int       `json:"version" firestore:"version"`
+	Reason    string    `json:"reason" firestore:"reason"`
+	CreatedAt time.Time `json:"createdAt" firestore:"createdAt"`
+	Trip      Trip      `json:"trip" firestore:"trip"`
+}
+
+// This is the blueprint for the accessibility flags shown on trip cards.
+type TripAccessibility struct {
+	Mobility  bool `json:"mobility" firestore:"mobility"`
+	Sensory   bool `json:"sensory" firestore:"sensory"`
+	Dietary   bool `json:"dietary" firestore:"dietary"`
+	LowEnergy bool `json:"lowEnergy" firestore:"lowEnergy"`
+}
+
+// This is the blueprint for a user's mobility needs.
+type MobilityPrefs struct {
+	Wheelchair    bool `json:"wheelchair" firestore:"wheelchair"`
+	AvoidStairs   bool `json:"avoidStairs" firestore:"avoidStairs"`
+	FrequentRests bool `json:"frequentRests" firestore:"frequentRests"`
+}
+
+// This is the blueprint for a user's sensory tolerances, 0 (prefers calm) to 100.
+type SensoryPrefs struct {
+	Noise  int `json:"noise" firestore:"noise"`
+	Visual int `json:"visual" firestore:"visual"`
+	// Limits opts in to having generated activities above these tolerances
+	// swapped for calmer ones or flagged. Without it they only guide the prompt.
+	Limits bool `json:"limits" firestore:"limits"`
+}
+
+// This is the blueprint for how much a user can do in a day, in effort
+// points. 100 is a typical traveller's full day.
+type EnergyPrefs struct {
+	DailyCapacity int `json:"dailyCapacity" firestore:"dailyCapacity"`
+}
+
+// This is the blueprint for a user's accessibility profile.
+type Profile struct {
+	Mobility     *MobilityPrefs `json:"mobility,omitempty" firestore:"mobility,omitempty"`
+	Sensory      *SensoryPrefs  `json:"sensory,omitempty" firestore:"sensory,omitempty"`
+	Energy       *EnergyPrefs   `json:"energy,omitempty" firestore:"energy,omitempty"`
+	Dietary      []string       `json:"dietary,omitempty" firestore:"dietary,omitempty"`
+	HomeCurrency string         `json:"homeCurrency,omitempty" firestore:"homeCurrency,omitempty"`
+	DisplayName  string         `json:"displayName,omitempty" firestore:"displayName,omitempty"`
+	OnboardedAt  *time.Time     `json:"onboardedAt,omitempty" firestore:"onboardedAt,omitempty"`
+}
+
+// Moderation statuses of a public trip. Only approved trips are listed.
+const (
+	moderationPending  = "pending"
+	moderationApproved = "approved"
+	moderationRejected = "rejected"
+)
+
+// This is the blueprint for the public copy of a published trip. It carries
+// no profile details; ListedAt is set only while the trip is approved.
+type PublicTrip struct {
+	ID               string            `json:"id" firestore:"-"`
+	AuthorID         string            `json:"authorId,omitempty" firestore:"authorId"`
+	UserName         string            `json:"userName" firestore:"userName"`
+	TripTitle        string            `json:"tripTitle" firestore:"tripTitle"`
+	Destination      string            `json:"destination" firestore:"destination"`
+	KeyInsight       string            `json:"keyInsight,omitempty" firestore:"keyInsight,omitempty"`
+	Days             int               `json:"days" firestore:"days"`
+	Itinerary        Itinerary         `json:"itinerary" firestore:"itinerary"`
+	Accessibility    TripAccessibility `json:"accessibility" firestore:"accessibility"`
+	Ratings          TripRatings       `json:"ratings" firestore:"ratings"`
+	ModerationStatus string            `json:"moderationStatus" firestore:"moderationStatus"`
+	ModerationNote   string            `json:"moderationNote,omitempty" firestore:"moderationNote,omitempty"`
+	ListedAt         *time.Time        `json:"listedAt,omitempty" firestore:"listedAt,omitempty"`
+	CreatedAt        time.Time         `json:"createdAt" firestore:"createdAt"`
+	UpdatedAt        time.Time         `json:"updatedAt" firestore:"updatedAt"`
+}
+
+// This is the blueprint for a place that makes a day out easier: an
+// accessible restroom, a quiet room, a charging point for mobility devices
+// or somewhere to sit. Imported points carry the SourceRef they were read
+// under, so importing the same file again updates them instead of adding copies.
+type ReliefPoint struct {
+	ID             string    `json:"id" firestore:"-"`
+	Kind           string    `json:"kind" firestore:"kind"`
+	Name           string    `json:"name" firestore:"name"`
+	Lat            float64   `json:"lat" firestore:"lat"`
+	Lng            float64   `json:"lng" firestore:"lng"`
+	Notes          string    `json:"notes,omitempty" firestore:"notes,omitempty"`
+	Source         string    `json:"source" firestore:"source"` // "osm", "geojson" or "user"
+	SourceRef      string    `json:"sourceRef,omitempty" firestore:"sourceRef,omitempty"`
+	Status         string    `json:"status" firestore:"status"` // a moderation status
+	ModerationNote string    `json:"moderationNote,omitempty" firestore:"moderationNote,omitempty"`
+	SubmittedBy    string    `json:"submittedBy,omitempty" firestore:"submittedBy,omitempty"`
+	CreatedAt      time.Time `json:"createdAt" firestore:"createdAt"`
+	UpdatedAt      time.Time `json:"updatedAt" firestore:"updatedAt"`
+	// Geohash of Lat/Lng, kept by the Firestore store for box lookups
+	Geohash string `json:"-" firestore:"geohash,omitempty"`
+}
+
+// BoundingBox is an area of the map, edges included.
+type BoundingBox struct {
+	MinLat, MinLng, MaxLat, MaxLng float64
+}
+
+// ReliefPointQuery selects relief points. A nil Box means anywhere, and no
+// Kinds means every kind. Stores return at most Limit points.
+type ReliefPointQuery struct {
+	Box    *BoundingBox
+	Kinds  []string
+	Status string
+	Limit  int
+}
+
+// SensoryScores rate how hard a place is on each sense, from 1 (calm) to 100 (overwhelming).
+type SensoryScores struct {
+	Audio  int `json:"audio" firestore:"audio"`
+	Visual int `json:"visual" firestore:"visual"`
+	Crowds int `json:"crowds" firestore:"crowds"`
+}
+
+// SensoryBucket is the expected load from Hour until the next bucket starts.
+type SensoryBucket struct {
+	Hour int `json:"hour" firestore:"hour"`
+	SensoryScores
+}
+
+// This is the blueprint for a generated sensory profile of one place on one
+// weekday, cached under Key until ExpiresAt. Buckets cover the whole day in
+// order, one every sensoryBucketHours.
+type SensoryProfile struct {
+	Key         string          `json:"key" firestore:"key"`
+	Location    string          `json:"location" firestore:"location"`
+	Weekday     string          `json:"weekday" firestore:"weekday"` // "monday" to "sunday", or "any"
+	Buckets     []SensoryBucket `json:"buckets" firestore:"buckets"`
+	Summary     string          `json:"summary" firestore:"summary"`
+	GeneratedAt time.Time       `json:"generatedAt" firestore:"generatedAt"`
+	ExpiresAt   time.Time       `json:"expiresAt" firestore:"expiresAt"`
+}
+
+// This is the blueprint for a live energy reading the traveller reports
+// during a trip. Time is the time of day on that trip day, like "2:30 PM".
+type EnergyCheckIn struct {
+	ID        string    `json:"id" firestore:"-"`
+	TripID    string    `json:"tripId" firestore:"tripId"`
+	Day       int       `json:"day" firestore:"day"`
+	Time      string    `json:"time" firestore:"time"`
+	Level     int       `json:"level" firestore:"level"` // 0 (exhausted) to 100 (fresh)
+	Note      string    `json:"note,omitempty" firestore:"note,omitempty"`
+	CreatedAt time.Time `json:"createdAt" firestore:"createdAt"`
+}
+
+// This is the blueprint for one traveller's review of a public trip. Each
+// traveller has at most one review per trip; posting again replaces it.
+type Review struct {
+	PublicTripID string           `json:"publicTripId" firestore:"publicTripId"`
+	UserID       string           `json:"userId,omitempty" firestore:"userId"`
+	UserName     string           `json:"userName" firestore:"userName"`
+	Rating       int              `json:"rating" firestore:"rating"` // 1 to 5 stars
+	Comment      string           `json:"comment,omitempty" firestore:"comment,omitempty"`
+	Reports      []ActivityReport `json:"reports,omitempty" firestore:"reports,omitempty"`
+	CreatedAt    time.Time        `json:"createdAt" firestore:"createdAt"`
+	UpdatedAt    time.Time        `json:"updatedAt" firestore:"updatedAt"`
+}
+
+// This is the blueprint for a first-hand accessibility report on one activity,
+// e.g. stepFree/confirmed or quiet/disputed with the note "too loud at noon".
+type ActivityReport struct {
+	Day           int    `json:"day" firestore:"day"`
+	ActivityIndex int    `json:"activityIndex" firestore:"activityIndex"`
+	Aspect        string `json:"aspect" firestore:"aspect"`
+	Verdict       string `json:"verdict" firestore:"verdict"`
+	Note          string `json:"note,omitempty" firestore:"note,omitempty"`
+}
+
+// This is the blueprint for the review aggregates kept on a public trip.
+type TripRatings struct {
+	Count    int                    `json:"count" firestore:"count"`
+	Average  float64                `json:"average" firestore:"average"`
+	Verified []ActivityVerification `json:"verified,omitempty" firestore:"verified,omitempty"`
+}
+
+// This is the blueprint for how many reviewers confirmed or disputed one
+// aspect of one activity.
+type ActivityVerification struct {
+	Day           int      `json:"day" firestore:"day"`
+	ActivityIndex int      `json:"activityIndex" firestore:"activityIndex"`
+	Aspect        string   `json:"aspect" firestore:"aspect"`
+	Confirmed     int      `json:"confirmed" firestore:"confirmed"`
+	Disputed      int      `json:"disputed" firestore:"disputed"`
+	Notes         []string `json:"notes,omitempty" firestore:"notes,omitempty"`
+}
+
+// PublicTripQuery selects listed public trips. Text matches the title or
+// destination, ignoring case; every true flag in Accessibility is required.
+// After continues the listing from a cursor returned by an earlier page.
+type PublicTripQuery struct {
+	Text          string
+	Accessibility TripAccessibility
+	After         *PublicTripCursor
+	Limit         int
+}
+
+// PublicTripCursor is a position in the listing order: ListedAt, then ID, both descending.
+type PublicTripCursor struct {
+	ListedAt time.Time
+	ID       string
+}
+
+// AccessibilityFacets counts the trips matching a query, in total and per flag.
+type AccessibilityFacets struct {
+	Total     int `json:"total"`
+	Mobility  int `json:"mobility"`
+	Sensory   int `json:"sensory"`
+	Dietary   int `json:"dietary"`
+	LowEnergy int `json:"lowEnergy"`
+}
+
+// PublicTripPage is one page of listed trips. Next is nil on the last page.
+type PublicTripPage struct {
+	Trips  []PublicTrip
+	Next   *PublicTripCursor
+	Facets AccessibilityFacets
+}
+
+// This is the blueprint for a curated group of public trips shown in the
+// Discover carousel. Members are picked by hand (TripIDs), by Rule, or both.
+type Collection struct {
+	ID          string          `json:"id" firestore:"-"`
+	Title       string          `json:"title" firestore:"title"`
+	Description string          `json:"description,omitempty" firestore:"description,omitempty"`
+	CoverImage  string          `json:"coverImage" firestore:"coverImage"` // image path or URL
+	Position    int             `json:"position" firestore:"position"`     // carousel order, lowest first
+	TripIDs     []string        `json:"tripIds,omitempty" firestore:"tripIds,omitempty"`
+	Rule        *CollectionRule `json:"rule,omitempty" firestore:"rule,omitempty"`
+	CreatedAt   time.Time       `json:"createdAt" firestore:"createdAt"`
+	UpdatedAt   time.Time       `json:"updatedAt" firestore:"updatedAt"`
+}
+
+// This is the blueprint for the membership rule of a collection. A public trip
+// belongs when it passes every part that is set.
+type CollectionRule struct {
+	Text            string            `json:"text,omitempty" firestore:"text,omitempty"`
+	Accessibility   TripAccessibility `json:"accessibility" firestore:"accessibility"`
+	MaxSensoryScore *int              `json:"maxSensoryScore,omitempty" firestore:"maxSensoryScore,omitempty"`
+	MaxDays         *int              `json:"maxDays,omitempty" firestore:"maxDays,omitempty"`
+}
+
+// This is the blueprint for a booking of one flight or hotel offer, linked to a trip.
+// ExpiresAt is when the current quote or hold lapses.
+type Booking struct {
+	ID              string         `json:"id" firestore:"-"`
+	UserID          string         `json:"userId" firestore:"userId"`
+	TripID          string         `json:"tripId" firestore:"tripId"`
+	Status          string         `json:"status" firestore:"status"`
+	Kind            string         `json:"kind" firestore:"kind"`
+	OfferID         string         `json:"offerId" firestore:"offerId"`
+	Description     string         `json:"description" firestore:"description"`
+	Query           PriceQuery     `json:"query" firestore:"query"`
+	Price           float64        `json:"price" firestore:"price"`
+	Currency        string         `json:"currency" firestore:"currency"`
+	Supplier        string         `json:"supplier" firestore:"supplier"`
+	HoldRef         string         `json:"holdRef,omitempty" firestore:"holdRef,omitempty"`
+	ConfirmationRef string         `json:"confirmationRef,omitempty" firestore:"confirmationRef,omitempty"`
+	ExpiresAt       *time.Time     `json:"expiresAt,omitempty" firestore:"expiresAt,omitempty"`
+	History         []BookingEvent `json:"history" firestore:"history"`
+	CreatedAt       time.Time      `json:"createdAt" firestore:"createdAt"`
+	UpdatedAt       time.Time      `json:"updatedAt" firestore:"updatedAt"`
+}
+
+// This is the blueprint for one status change in a booking's history.
+type BookingEvent struct {
+	Status string    `json:"status" firestore:"status"`
+	At     time.Time `json:"at" firestore:"at"`
+}
+
+// IdempotencyRecord remembers the response sent for an Idempotency-Key.
+// StatusCode is 0 while the first request is still running.
+type IdempotencyRecord struct {
+	Fingerprint string    `json:"fingerprint" firestore:"fingerprint"`
+	StatusCode  int       `json:"statusCode" firestore:"statusCode"`
+	ContentType string    `json:"contentType" firestore:"contentType"`
+	Body        []byte    `json:"body" firestore:"body"`
+	CreatedAt   time.Time `json:"createdAt" firestore:"createdAt"`
+}
+
+// TripStore persists trips. Every write keeps a numbered revision:
+// CreateTrip records version 1 and UpdateTrip applies fn atomically and
+// records the next version with the given reason.
+type TripStore interface {
+	CreateTrip(ctx context.Context, trip *Trip) error
+	GetTrip(ctx context.Context, id string) (*Trip, error)
+	UpdateTrip(ctx context.Context, id, reason string, fn func(*Trip) error) (*Trip, error)
+	DeleteTrip(ctx context.Context, id string) error
+	ListUserTrips(ctx context.Context, userId string) ([]Trip, error)
+	ListRevisions(ctx context.Context, tripId string) ([]TripRevision, error)
+	GetRevision(ctx context.Context, tripId string, version int) (*TripRevision, error)
+}
+
+// ProfileStore persists accessibility profiles keyed by user ID.
+// UpdateProfile applies fn atomically, starting from an empty profile if none exists.
+type ProfileStore interface {
+	GetProfile(ctx context.Context, userId string) (*Profile, error)
+	SaveProfile(ctx context.Context, userId string, profile *Profile) error
+	UpdateProfile(ctx context.Context, userId string, fn func(*Profile) error) (*Profile, error)
+}
+
+// PublicTripStore persists public projections, keyed by the trip ID.
+// ListPublicTrips returns one page of approved trips matching q, newest listing
+// first, with facet counts over every match.
+type PublicTripStore interface {
+	SavePublicTrip(ctx context.Context, trip *PublicTrip) error
+	GetPublicTrip(ctx context.Context, id string) (*PublicTrip, error)
+	UpdatePublicTrip(ctx context.Context, id string, fn func(*PublicTrip) error) (*PublicTrip, error)
+	DeletePublicTrip(ctx context.Context, id string) error
+	ListPublicTrips(ctx context.Context, q PublicTripQuery) (*PublicTripPage, error)
+}
+
+// CollectionStore persists Discover collections. ListCollections returns
+// them in carousel order. UpdateCollection applies fn atomically.
+type CollectionStore interface {
+	CreateCollection(ctx context.Context, c *Collection) error
+	GetCollection(ctx context.Context, id string) (*Collection, error)
+	UpdateCollection(ctx context.Context, id string, fn func(*Collection) error) (*Collection, error)
+	DeleteCollection(ctx context.Context, id string) error
+	ListCollections(ctx context.Context) ([]Collection, error)
+}
+
+// ReviewStore persists reviews, keyed by public trip and reviewer.
+// PutReview creates or replaces the reviewer's review. ListReviews returns
+// the newest first.
+type ReviewStore interface {
+	PutReview(ctx context.Context, review *Review) error
+	DeleteReview(ctx context.Context, publicTripId, userId string) error
+	ListReviews(ctx context.Context, publicTripId string) ([]Review, error)
+}
+
+// ReliefPointStore persists relief points. UpdateReliefPoint applies fn
+// atomically. ImportReliefPoints upserts on SourceRef, keeping the ID, status
+// and creation time of points already stored, and returns how many were new.
+// FindReliefPoints returns the oldest first.
+type ReliefPointStore interface {
+	CreateReliefPoint(ctx context.Context, p *ReliefPoint) error
+	GetReliefPoint(ctx context.Context, id string) (*ReliefPoint, error)
+	UpdateReliefPoint(ctx context.Context, id string, fn func(*ReliefPoint) error) (*ReliefPoint, error)
+	ImportReliefPoints(ctx context.Context, points []ReliefPoint) (int, error)
+	FindReliefPoints(ctx context.Context, q ReliefPointQuery) ([]ReliefPoint, error)
+}
+
+// SensoryProfileStore caches sensory profiles by key. GetSensoryProfile
+// returns ErrNotFound for keys never stored; expired profiles come back as
+// they are, and PutSensoryProfile replaces them.
+type SensoryProfileStore interface {
+	GetSensoryProfile(ctx context.Context, key string) (*SensoryProfile, error)
+	PutSensoryProfile(ctx context.Context, p *SensoryProfile) error
+}
+
+// CommCardStore persists generated communication cards, so they can be
+// printed and opened from the QR code on the printout.
+type CommCardStore interface {
+	CreateCommCard(ctx context.Context, card *CommCard) error
+	GetCommCard(ctx context.Context, id string) (*CommCard, error)
+}
+
+// EnergyStore persists energy check-ins. ListCheckIns returns the oldest first.
+type EnergyStore interface {
+	AddCheckIn(ctx context.Context, checkIn *EnergyCheckIn) error
+	ListCheckIns(ctx context.Context, tripId string) ([]EnergyCheckIn, error)
+}
+
+// BookingStore persists bookings. UpdateBooking applies fn atomically.
+type BookingStore interface {
+	CreateBooking(ctx context.Context, booking *Booking) error
+	GetBooking(ctx context.Context, id string) (*Booking, error)
+	UpdateBooking(ctx context.Context, id string, fn func(*Booking) error) (*Booking, error)
+	ListTripBookings(ctx context.Context, tripId string) ([]Booking, error)
+}
+
+// IdempotencyStore tracks Idempotency-Keys per scope (the caller's UID).
+// ClaimIdempotencyKey atomically reserves a key and returns nil, or returns
+// the record already stored for it. Records older than idempotencyKeyTTL
+// count as unused.
+type IdempotencyStore interface {
+	ClaimIdempotencyKey(ctx context.Context, scope, key, fingerprint string) (*IdempotencyRecord, error)
+	CompleteIdempotencyKey(ctx context.Context, scope, key string, statusCode int, contentType string, body []byte) error
+	ReleaseIdempotencyKey(ctx context.Context, scope, key string) error
+}
+
+const idempotencyKeyTTL = 24 * time.Hour
+
+var (
+	tripStore        TripStore
+	profileStore     ProfileStore
+	publicTripStore  PublicTripStore
+	collectionStore  CollectionStore
+	reviewStore      ReviewStore
+	energyStore      EnergyStore
+	reliefStore      ReliefPointStore
+	sensoryStore     SensoryProfileStore
+	commCardStore    CommCardStore
+	bookingStore     BookingStore
+	idempotencyStore IdempotencyStore
+)
+
+// initStorage picks a backend from STORAGE_BACKEND: "firestore" (default), "memory" or "sqlite".
+func initStorage() {
+	switch backend := strings.ToLower(os.Getenv("STORAGE_BACKEND")); backend {
+	case "", "firestore":
+		initFirebase()
+		store := NewFirestoreStore(firestoreClient)
+		tripStore, profileStore, publicTripStore, collectionStore, reviewStore = store, store, store, store, store
+		energyStore, reliefStore, sensoryStore, bookingStore, idempotencyStore = store, store, store, store, store
+		commCardStore = store
+	case "memory":
+		store := NewMemoryStore()
+		tripStore, profileStore, publicTripStore, collectionStore, reviewStore = store, store, store, store, store
+		energyStore, reliefStore, sensoryStore, bookingStore, idempotencyStore = store, store, store, store, store
+		commCardStore = store
+	case "sqlite":
+		store, err := NewSQLiteStore(envOr("SQLITE_PATH", "auryvia.db"))
+		if err != nil {
+			log.Fatalf("error opening sqlite store: %v", err)
+		}
+		tripStore, profileStore, publicTripStore, collectionStore, reviewStore = store, store, store, store, store
+		energyStore, reliefStore, sensoryStore, bookingStore, idempotencyStore = store, store, store, store, store
+		commCardStore = store
+	default:
+		log.Fatalf("unknown STORAGE_BACKEND %q", backend)
+	}
+}
+
+// stampNewTrip fills in the bookkeeping fields of a trip about to be created.
+func stampNewTrip(trip *Trip) TripRevision {
+	if trip.CreatedAt.IsZero() {
+		trip.CreatedAt = time.Now().UTC()
+	}
+	trip.UpdatedAt = trip.CreatedAt
+	trip.Version = 1
+	return newRevision(trip, revisionCreate)
+}
+
+// applyTripUpdate runs fn on a copy of stored, keeps the fields fn may not
+// change, and bumps the version.
+func applyTripUpdate(stored *Trip, reason string, fn func(*Trip) error) (*Trip, TripRevision, error) {
+	trip := new(Trip)
+	cloneJSON(trip, stored)
+	if err := fn(trip); err != nil {
+		return nil, TripRevision{}, err
+	}
+	trip.ID, trip.UserID, trip.CreatedAt = stored.ID, stored.UserID, stored.CreatedAt
+	trip.Version = stored.Version + 1
+	trip.UpdatedAt = time.Now().UTC()
+	return trip, newRevision(trip, reason), nil
+}
+
+func newRevision(trip *Trip, reason string) TripRevision {
+	rev := TripRevision{Version: trip.Version, Reason: reason, CreatedAt: trip.UpdatedAt}
+	cloneJSON(&rev.Trip, trip)
+	return rev
+}
+
+// claimable reports whether an existing idempotency record may be replaced by a new claim.
+func claimable(rec *IdempotencyRecord, now time.Time) bool {
+	return rec == nil || now.Sub(rec.CreatedAt) > idempotencyKeyTTL
+}
+
+// cloneJSON deep-copies src into dst through JSON so stores never share slices with callers.
+func cloneJSON(dst, src interface{}) {
+	b, err := json.Marshal(src)
+	if err != nil {
+		panic(err)
+	}
+	if err := json.Unmarshal(b, dst); err != nil {
+		panic(err)
+	}
+}
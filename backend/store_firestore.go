@@ -0,0 +1,959 @@
+// backend/store_firestore.go
+
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"cloud.google.com/go/firestore/apiv1/firestorepb"
+	"google.golang.org/api/iterator"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// FirestoreStore keeps trips in the "trips" collection with their energy
+// check-ins in "trips/{id}/checkIns", profiles in "users/{uid}",
+// public projections in "publicTrips" with their reviews in
+// "publicTrips/{id}/reviews/{uid}", Discover collections in "collections",
+// relief points in "reliefPoints", cached sensory profiles in
+// "sensoryProfiles", communication cards in "commCards" and bookings in
+// "bookings".
+type FirestoreStore struct {
+	client *firestore.Client
+}
+
+func NewFirestoreStore(client *firestore.Client) *FirestoreStore {
+	return &FirestoreStore{client: client}
+}
+
+func (f *FirestoreStore) CreateTrip(ctx context.Context, trip *Trip) error {
+	ref := f.client.Collection("trips").NewDoc()
+	trip.ID = ref.ID
+	rev := stampNewTrip(trip)
+	return f.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		if err := tx.Create(ref, trip); err != nil {
+			return err
+		}
+		return tx.Create(revisionRef(ref, rev.Version), rev)
+	})
+}
+
+// Revisions live in the trips/{id}/revisions subcollection, keyed by version.
+func revisionRef(trip *firestore.DocumentRef, version int) *firestore.DocumentRef {
+	return trip.Collection("revisions").Doc(strconv.Itoa(version))
+}
+
+func (f *FirestoreStore) UpdateTrip(ctx context.Context, id, reason string, fn func(*Trip) error) (*Trip, error) {
+	ref := f.client.Collection("trips").Doc(id)
+	var updated *Trip
+	err := f.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		doc, err := tx.Get(ref)
+		if status.Code(err) == codes.NotFound {
+			return ErrNotFound
+		}
+		if err != nil {
+			return err
+		}
+		stored, err := decodeFirestoreTrip(doc)
+		if err != nil {
+			return err
+		}
+		trip, rev, err := applyTripUpdate(stored, reason, fn)
+		if err != nil {
+			return err
+		}
+		if err := tx.Set(ref, trip); err != nil {
+			return err
+		}
+		updated = trip
+		return tx.Create(revisionRef(ref, rev.Version), rev)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return updated, nil
+}
+
+// DeleteTrip removes the trip and every stored revision.
+func (f *FirestoreStore) DeleteTrip(ctx context.Context, id string) error {
+	ref := f.client.Collection("trips").Doc(id)
+	if _, err := ref.Get(ctx); status.Code(err) == codes.NotFound {
+		return ErrNotFound
+	} else if err != nil {
+		return err
+	}
+	// The trip goes last, so a failed delete leaves it in place to retry.
+	bw := f.client.BulkWriter(ctx)
+	var jobs []*firestore.BulkWriterJob
+	for _, sub := range []string{"revisions", "checkIns"} {
+		docs, err := ref.Collection(sub).DocumentRefs(ctx).GetAll()
+		if err != nil {
+			bw.End()
+			return err
+		}
+		for _, doc := range docs {
+			job, err := bw.Delete(doc)
+			if err != nil {
+				bw.End()
+				return err
+			}
+			jobs = append(jobs, job)
+		}
+	}
+	if err := endBulkWriter(bw, jobs); err != nil {
+		return fmt.Errorf("deleting trip %s: %w", id, err)
+	}
+	_, err := ref.Delete(ctx)
+	return err
+}
+
+func (f *FirestoreStore) ListRevisions(ctx context.Context, tripId string) ([]TripRevision, error) {
+	ref := f.client.Collection("trips").Doc(tripId)
+	if _, err := ref.Get(ctx); status.Code(err) == codes.NotFound {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	iter := ref.Collection("revisions").OrderBy("version", firestore.Asc).Documents(ctx)
+	defer iter.Stop()
+	var revs []TripRevision
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			return revs, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		var rev TripRevision
+		if err := doc.DataTo(&rev); err != nil {
+			return nil, err
+		}
+		rev.Trip.ID = tripId
+		revs = append(revs, rev)
+	}
+}
+
+func (f *FirestoreStore) GetRevision(ctx context.Context, tripId string, version int) (*TripRevision, error) {
+	doc, err := revisionRef(f.client.Collection("trips").Doc(tripId), version).Get(ctx)
+	if status.Code(err) == codes.NotFound {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	var rev TripRevision
+	if err := doc.DataTo(&rev); err != nil {
+		return nil, err
+	}
+	rev.Trip.ID = tripId
+	return &rev, nil
+}
+
+func (f *FirestoreStore) GetTrip(ctx context.Context, id string) (*Trip, error) {
+	doc, err := f.client.Collection("trips").Doc(id).Get(ctx)
+	if status.Code(err) == codes.NotFound {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return decodeFirestoreTrip(doc)
+}
+
+// ListUserTrips filters on userId only, so no composite index is needed; callers sort.
+func (f *FirestoreStore) ListUserTrips(ctx context.Context, userId string) ([]Trip, error) {
+	return collectTrips(f.client.Collection("trips").Where("userId", "==", userId).Documents(ctx))
+}
+
+// collectTrips drains a trips query, stopping at the first real error.
+func collectTrips(iter *firestore.DocumentIterator) ([]Trip, error) {
+	defer iter.Stop()
+	var trips []Trip
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			return trips, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		trip, err := decodeFirestoreTrip(doc)
+		if err != nil {
+			return nil, err
+		}
+		trips = append(trips, *trip)
+	}
+}
+
+// decodeFirestoreTrip also understands older documents where the itinerary
+// was stored as a raw JSON string.
+func decodeFirestoreTrip(doc *firestore.DocumentSnapshot) (*Trip, error) {
+	var trip Trip
+	if raw, ok := doc.Data()["itinerary"].(string); ok {
+		var legacy struct {
+			UserID    string    `firestore:"userId"`
+			IsPublic  bool      `firestore:"isPublic"`
+			CreatedAt time.Time `firestore:"createdAt"`
+		}
+		if err := doc.DataTo(&legacy); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(raw), &trip.Itinerary); err != nil {
+			return nil, err
+		}
+		trip.UserID, trip.IsPublic, trip.CreatedAt = legacy.UserID, legacy.IsPublic, legacy.CreatedAt
+	} else if err := doc.DataTo(&trip); err != nil {
+		return nil, err
+	}
+	trip.ID = doc.Ref.ID
+	return &trip, nil
+}
+
+func (f *FirestoreStore) GetProfile(ctx context.Context, userId string) (*Profile, error) {
+	doc, err := f.client.Collection("users").Doc(userId).Get(ctx)
+	if status.Code(err) == codes.NotFound {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	var profile Profile
+	if err := doc.DataTo(&profile); err != nil {
+		return nil, err
+	}
+	return &profile, nil
+}
+
+// profileFields lists the profile fields we own on the user document, so
+// merges leave any other fields alone.
+func profileFields(profile *Profile) map[string]interface{} {
+	return map[string]interface{}{
+		"mobility":     profile.Mobility,
+		"sensory":      profile.Sensory,
+		"energy":       profile.Energy,
+		"dietary":      profile.Dietary,
+		"homeCurrency": profile.HomeCurrency,
+		"displayName":  profile.DisplayName,
+		"onboardedAt":  profile.OnboardedAt,
+	}
+}
+
+func (f *FirestoreStore) SaveProfile(ctx context.Context, userId string, profile *Profile) error {
+	_, err := f.client.Collection("users").Doc(userId).Set(ctx, profileFields(profile), firestore.MergeAll)
+	return err
+}
+
+func (f *FirestoreStore) UpdateProfile(ctx context.Context, userId string, fn func(*Profile) error) (*Profile, error) {
+	ref := f.client.Collection("users").Doc(userId)
+	var profile Profile
+	err := f.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		profile = Profile{}
+		doc, err := tx.Get(ref)
+		if err != nil && status.Code(err) != codes.NotFound {
+			return err
+		}
+		if err == nil {
+			if err := doc.DataTo(&profile); err != nil {
+				return err
+			}
+		}
+		if err := fn(&profile); err != nil {
+			return err
+		}
+		return tx.Set(ref, profileFields(&profile), firestore.MergeAll)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &profile, nil
+}
+
+func (f *FirestoreStore) CreateCollection(ctx context.Context, c *Collection) error {
+	ref := f.client.Collection("collections").NewDoc()
+	c.ID = ref.ID
+	_, err := ref.Create(ctx, c)
+	return err
+}
+
+func (f *FirestoreStore) GetCollection(ctx context.Context, id string) (*Collection, error) {
+	doc, err := f.client.Collection("collections").Doc(id).Get(ctx)
+	if status.Code(err) == codes.NotFound {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return decodeFirestoreCollection(doc)
+}
+
+func decodeFirestoreCollection(doc *firestore.DocumentSnapshot) (*Collection, error) {
+	var c Collection
+	if err := doc.DataTo(&c); err != nil {
+		return nil, err
+	}
+	c.ID = doc.Ref.ID
+	return &c, nil
+}
+
+func (f *FirestoreStore) UpdateCollection(ctx context.Context, id string, fn func(*Collection) error) (*Collection, error) {
+	ref := f.client.Collection("collections").Doc(id)
+	var updated *Collection
+	err := f.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		doc, err := tx.Get(ref)
+		if status.Code(err) == codes.NotFound {
+			return ErrNotFound
+		}
+		if err != nil {
+			return err
+		}
+		c, err := decodeFirestoreCollection(doc)
+		if err != nil {
+			return err
+		}
+		if err := fn(c); err != nil {
+			return err
+		}
+		c.ID = id
+		updated = c
+		return tx.Set(ref, c)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return updated, nil
+}
+
+func (f *FirestoreStore) DeleteCollection(ctx context.Context, id string) error {
+	ref := f.client.Collection("collections").Doc(id)
+	if _, err := ref.Get(ctx); status.Code(err) == codes.NotFound {
+		return ErrNotFound
+	} else if err != nil {
+		return err
+	}
+	_, err := ref.Delete(ctx)
+	return err
+}
+
+// ListCollections reads every collection; there are only a handful, so they
+// are put in carousel order in memory.
+func (f *FirestoreStore) ListCollections(ctx context.Context) ([]Collection, error) {
+	iter := f.client.Collection("collections").Documents(ctx)
+	defer iter.Stop()
+	colls := []Collection{}
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		c, err := decodeFirestoreCollection(doc)
+		if err != nil {
+			return nil, err
+		}
+		colls = append(colls, *c)
+	}
+	sortCollections(colls)
+	return colls, nil
+}
+
+func (f *FirestoreStore) reviewsOf(publicTripId string) *firestore.CollectionRef {
+	return f.client.Collection("publicTrips").Doc(publicTripId).Collection("reviews")
+}
+
+func (f *FirestoreStore) PutReview(ctx context.Context, review *Review) error {
+	_, err := f.reviewsOf(review.PublicTripID).Doc(review.UserID).Set(ctx, review)
+	return err
+}
+
+func (f *FirestoreStore) DeleteReview(ctx context.Context, publicTripId, userId string) error {
+	ref := f.reviewsOf(publicTripId).Doc(userId)
+	if _, err := ref.Get(ctx); status.Code(err) == codes.NotFound {
+		return ErrNotFound
+	} else if err != nil {
+		return err
+	}
+	_, err := ref.Delete(ctx)
+	return err
+}
+
+func (f *FirestoreStore) ListReviews(ctx context.Context, publicTripId string) ([]Review, error) {
+	iter := f.reviewsOf(publicTripId).OrderBy("updatedAt", firestore.Desc).Documents(ctx)
+	defer iter.Stop()
+	reviews := []Review{}
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			return reviews, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		var review Review
+		if err := doc.DataTo(&review); err != nil {
+			return nil, err
+		}
+		reviews = append(reviews, review)
+	}
+}
+
+func decodeFirestoreReliefPoint(doc *firestore.DocumentSnapshot) (*ReliefPoint, error) {
+	var p ReliefPoint
+	if err := doc.DataTo(&p); err != nil {
+		return nil, err
+	}
+	p.ID = doc.Ref.ID
+	return &p, nil
+}
+
+func (f *FirestoreStore) CreateReliefPoint(ctx context.Context, p *ReliefPoint) error {
+	ref := f.client.Collection("reliefPoints").NewDoc()
+	p.ID = ref.ID
+	p.Geohash = geohash(p.Lat, p.Lng, reliefGeohashLength)
+	_, err := ref.Create(ctx, p)
+	return err
+}
+
+func (f *FirestoreStore) GetReliefPoint(ctx context.Context, id string) (*ReliefPoint, error) {
+	doc, err := f.client.Collection("reliefPoints").Doc(id).Get(ctx)
+	if status.Code(err) == codes.NotFound {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return decodeFirestoreReliefPoint(doc)
+}
+
+func (f *FirestoreStore) UpdateReliefPoint(ctx context.Context, id string, fn func(*ReliefPoint) error) (*ReliefPoint, error) {
+	ref := f.client.Collection("reliefPoints").Doc(id)
+	var updated *ReliefPoint
+	err := f.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		doc, err := tx.Get(ref)
+		if status.Code(err) == codes.NotFound {
+			return ErrNotFound
+		}
+		if err != nil {
+			return err
+		}
+		p, err := decodeFirestoreReliefPoint(doc)
+		if err != nil {
+			return err
+		}
+		if err := fn(p); err != nil {
+			return err
+		}
+		p.ID = id
+		p.Geohash = geohash(p.Lat, p.Lng, reliefGeohashLength)
+		updated = p
+		return tx.Set(ref, p)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return updated, nil
+}
+
+// reliefImportBatch is how many imported points are looked up at once.
+const reliefImportBatch = 300
+
+// ImportReliefPoints keys imported points by a hash of their SourceRef, so
+// a re-import lands on the same documents.
+func (f *FirestoreStore) ImportReliefPoints(ctx context.Context, points []ReliefPoint) (int, error) {
+	created := 0
+	for start := 0; start < len(points); start += reliefImportBatch {
+		batch := points[start:min(start+reliefImportBatch, len(points))]
+		refs := make([]*firestore.DocumentRef, len(batch))
+		for i, p := range batch {
+			sum := sha256.Sum256([]byte(p.SourceRef))
+			refs[i] = f.client.Collection("reliefPoints").Doc(hex.EncodeToString(sum[:]))
+		}
+		docs, err := f.client.GetAll(ctx, refs)
+		if err != nil {
+			return 0, err
+		}
+		bw := f.client.BulkWriter(ctx)
+		jobs := make([]*firestore.BulkWriterJob, 0, len(batch))
+		for i, p := range batch {
+			if docs[i].Exists() {
+				existing, err := decodeFirestoreReliefPoint(docs[i])
+				if err != nil {
+					bw.End()
+					return 0, err
+				}
+				p.Status, p.ModerationNote, p.CreatedAt = existing.Status, existing.ModerationNote, existing.CreatedAt
+			} else {
+				created++
+			}
+			p.ID = refs[i].ID
+			p.Geohash = geohash(p.Lat, p.Lng, reliefGeohashLength)
+			job, err := bw.Set(refs[i], p)
+			if err != nil {
+				bw.End()
+				return 0, err
+			}
+			jobs = append(jobs, job)
+		}
+		if err := endBulkWriter(bw, jobs); err != nil {
+			return 0, fmt.Errorf("importing relief points: %w", err)
+		}
+	}
+	return created, nil
+}
+
+// endBulkWriter flushes bw and waits for jobs, returning the first failed
+// write along with how many failed.
+func endBulkWriter(bw *firestore.BulkWriter, jobs []*firestore.BulkWriterJob) error {
+	bw.End()
+	failed := 0
+	var first error
+	for _, job := range jobs {
+		if _, err := job.Results(); err != nil {
+			if first == nil {
+				first = err
+			}
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d writes failed: %w", failed, len(jobs), first)
+	}
+	return nil
+}
+
+// FindReliefPoints narrows a box to the geohash cells covering it, at most
+// four ranges on the geohash field, so it reads the points near the box
+// rather than a whole band of latitude. Without a box it narrows on status.
+// The rest of the query is checked in memory to avoid composite indexes.
+func (f *FirestoreStore) FindReliefPoints(ctx context.Context, q ReliefPointQuery) ([]ReliefPoint, error) {
+	coll := f.client.Collection("reliefPoints")
+	queries := []firestore.Query{coll.Query}
+	switch {
+	case q.Box != nil:
+		queries = nil
+		for _, cell := range q.Box.geohashCover() {
+			queries = append(queries, coll.Where("geohash", ">=", cell).Where("geohash", "<", cell+"~"))
+		}
+	case q.Status != "":
+		queries = []firestore.Query{coll.Where("status", "==", q.Status)}
+	}
+	points := []ReliefPoint{}
+	for _, query := range queries {
+		docs, err := query.Documents(ctx).GetAll()
+		if err != nil {
+			return nil, err
+		}
+		for _, doc := range docs {
+			p, err := decodeFirestoreReliefPoint(doc)
+			if err != nil {
+				return nil, err
+			}
+			if q.matches(p) {
+				points = append(points, *p)
+			}
+		}
+	}
+	sortReliefPoints(points)
+	if len(points) > q.Limit {
+		points = points[:q.Limit]
+	}
+	return points, nil
+}
+
+func (f *FirestoreStore) AddCheckIn(ctx context.Context, checkIn *EnergyCheckIn) error {
+	ref := f.client.Collection("trips").Doc(checkIn.TripID).Collection("checkIns").NewDoc()
+	checkIn.ID = ref.ID
+	_, err := ref.Create(ctx, checkIn)
+	return err
+}
+
+func (f *FirestoreStore) ListCheckIns(ctx context.Context, tripId string) ([]EnergyCheckIn, error) {
+	iter := f.client.Collection("trips").Doc(tripId).Collection("checkIns").OrderBy("createdAt", firestore.Asc).Documents(ctx)
+	defer iter.Stop()
+	checkIns := []EnergyCheckIn{}
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			return checkIns, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		var c EnergyCheckIn
+		if err := doc.DataTo(&c); err != nil {
+			return nil, err
+		}
+		c.ID = doc.Ref.ID
+		checkIns = append(checkIns, c)
+	}
+}
+
+func (f *FirestoreStore) CreateBooking(ctx context.Context, booking *Booking) error {
+	ref := f.client.Collection("bookings").NewDoc()
+	booking.ID = ref.ID
+	_, err := ref.Create(ctx, booking)
+	return err
+}
+
+func (f *FirestoreStore) GetBooking(ctx context.Context, id string) (*Booking, error) {
+	doc, err := f.client.Collection("bookings").Doc(id).Get(ctx)
+	if status.Code(err) == codes.NotFound {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return decodeFirestoreBooking(doc)
+}
+
+func decodeFirestoreBooking(doc *firestore.DocumentSnapshot) (*Booking, error) {
+	var booking Booking
+	if err := doc.DataTo(&booking); err != nil {
+		return nil, err
+	}
+	booking.ID = doc.Ref.ID
+	return &booking, nil
+}
+
+func (f *FirestoreStore) UpdateBooking(ctx context.Context, id string, fn func(*Booking) error) (*Booking, error) {
+	ref := f.client.Collection("bookings").Doc(id)
+	var updated *Booking
+	err := f.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		doc, err := tx.Get(ref)
+		if status.Code(err) == codes.NotFound {
+			return ErrNotFound
+		}
+		if err != nil {
+			return err
+		}
+		booking, err := decodeFirestoreBooking(doc)
+		if err != nil {
+			return err
+		}
+		if err := fn(booking); err != nil {
+			return err
+		}
+		booking.ID = id
+		updated = booking
+		return tx.Set(ref, booking)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return updated, nil
+}
+
+// ListTripBookings filters on tripId only and sorts in memory to avoid a composite index.
+func (f *FirestoreStore) ListTripBookings(ctx context.Context, tripId string) ([]Booking, error) {
+	iter := f.client.Collection("bookings").Where("tripId", "==", tripId).Documents(ctx)
+	defer iter.Stop()
+	var bookings []Booking
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		booking, err := decodeFirestoreBooking(doc)
+		if err != nil {
+			return nil, err
+		}
+		bookings = append(bookings, *booking)
+	}
+	sort.Slice(bookings, func(i, j int) bool { return bookings[i].CreatedAt.Before(bookings[j].CreatedAt) })
+	return bookings, nil
+}
+
+// sensoryProfileRef hashes the key, which holds free text, into a valid document ID.
+func (f *FirestoreStore) sensoryProfileRef(key string) *firestore.DocumentRef {
+	sum := sha256.Sum256([]byte(key))
+	return f.client.Collection("sensoryProfiles").Doc(hex.EncodeToString(sum[:]))
+}
+
+func (f *FirestoreStore) GetSensoryProfile(ctx context.Context, key string) (*SensoryProfile, error) {
+	doc, err := f.sensoryProfileRef(key).Get(ctx)
+	if status.Code(err) == codes.NotFound {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	var p SensoryProfile
+	if err := doc.DataTo(&p); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+func (f *FirestoreStore) PutSensoryProfile(ctx context.Context, p *SensoryProfile) error {
+	_, err := f.sensoryProfileRef(p.Key).Set(ctx, p)
+	return err
+}
+
+func (f *FirestoreStore) CreateCommCard(ctx context.Context, card *CommCard) error {
+	ref := f.client.Collection("commCards").NewDoc()
+	card.ID = ref.ID
+	_, err := ref.Create(ctx, card)
+	return err
+}
+
+func (f *FirestoreStore) GetCommCard(ctx context.Context, id string) (*CommCard, error) {
+	doc, err := f.client.Collection("commCards").Doc(id).Get(ctx)
+	if status.Code(err) == codes.NotFound {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	var card CommCard
+	if err := doc.DataTo(&card); err != nil {
+		return nil, err
+	}
+	card.ID = doc.Ref.ID
+	return &card, nil
+}
+
+// idempotencyRef hashes scope and key so any client-chosen key is a valid document ID.
+func (f *FirestoreStore) idempotencyRef(scope, key string) *firestore.DocumentRef {
+	sum := sha256.Sum256([]byte(scope + "\x00" + key))
+	return f.client.Collection("idempotencyKeys").Doc(hex.EncodeToString(sum[:]))
+}
+
+func (f *FirestoreStore) ClaimIdempotencyKey(ctx context.Context, scope, key, fingerprint string) (*IdempotencyRecord, error) {
+	ref := f.idempotencyRef(scope, key)
+	var existing *IdempotencyRecord
+	err := f.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		existing = nil
+		now := time.Now().UTC()
+		doc, err := tx.Get(ref)
+		if err != nil && status.Code(err) != codes.NotFound {
+			return err
+		}
+		if err == nil {
+			var rec IdempotencyRecord
+			if err := doc.DataTo(&rec); err != nil {
+				return err
+			}
+			if !claimable(&rec, now) {
+				existing = &rec
+				return nil
+			}
+		}
+		return tx.Set(ref, IdempotencyRecord{Fingerprint: fingerprint, CreatedAt: now})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return existing, nil
+}
+
+func (f *FirestoreStore) CompleteIdempotencyKey(ctx context.Context, scope, key string, statusCode int, contentType string, body []byte) error {
+	_, err := f.idempotencyRef(scope, key).Update(ctx, []firestore.Update{
+		{Path: "statusCode", Value: statusCode},
+		{Path: "contentType", Value: contentType},
+		{Path: "body", Value: body},
+	})
+	if status.Code(err) == codes.NotFound {
+		return ErrNotFound
+	}
+	return err
+}
+
+func (f *FirestoreStore) ReleaseIdempotencyKey(ctx context.Context, scope, key string) error {
+	_, err := f.idempotencyRef(scope, key).Delete(ctx)
+	return err
+}
+
+func (f *FirestoreStore) SavePublicTrip(ctx context.Context, trip *PublicTrip) error {
+	_, err := f.client.Collection("publicTrips").Doc(trip.ID).Set(ctx, trip)
+	return err
+}
+
+func (f *FirestoreStore) GetPublicTrip(ctx context.Context, id string) (*PublicTrip, error) {
+	doc, err := f.client.Collection("publicTrips").Doc(id).Get(ctx)
+	if status.Code(err) == codes.NotFound {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return decodeFirestorePublicTrip(doc)
+}
+
+func decodeFirestorePublicTrip(doc *firestore.DocumentSnapshot) (*PublicTrip, error) {
+	var trip PublicTrip
+	if err := doc.DataTo(&trip); err != nil {
+		return nil, err
+	}
+	trip.ID = doc.Ref.ID
+	return &trip, nil
+}
+
+func (f *FirestoreStore) UpdatePublicTrip(ctx context.Context, id string, fn func(*PublicTrip) error) (*PublicTrip, error) {
+	ref := f.client.Collection("publicTrips").Doc(id)
+	var updated *PublicTrip
+	err := f.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		doc, err := tx.Get(ref)
+		if status.Code(err) == codes.NotFound {
+			return ErrNotFound
+		}
+		if err != nil {
+			return err
+		}
+		trip, err := decodeFirestorePublicTrip(doc)
+		if err != nil {
+			return err
+		}
+		if err := fn(trip); err != nil {
+			return err
+		}
+		trip.ID = id
+		updated = trip
+		return tx.Set(ref, trip)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return updated, nil
+}
+
+func (f *FirestoreStore) DeletePublicTrip(ctx context.Context, id string) error {
+	ref := f.client.Collection("publicTrips").Doc(id)
+	if _, err := ref.Get(ctx); status.Code(err) == codes.NotFound {
+		return ErrNotFound
+	} else if err != nil {
+		return err
+	}
+	_, err := ref.Delete(ctx)
+	return err
+}
+
+// listedPublicTrips queries the listed trips with every flag of want. Firestore
+// leaves documents without listedAt out of an ordering on it, so unapproved
+// trips drop out without a status filter. Each combination of flags with
+// listedAt and the document ID, both descending, needs a composite index.
+func (f *FirestoreStore) listedPublicTrips(want TripAccessibility) firestore.Query {
+	query := f.client.Collection("publicTrips").Query
+	for field, on := range map[string]bool{
+		"mobility": want.Mobility, "sensory": want.Sensory, "dietary": want.Dietary, "lowEnergy": want.LowEnergy,
+	} {
+		if on {
+			query = query.Where("accessibility."+field, "==", true)
+		}
+	}
+	return query.OrderBy("listedAt", firestore.Desc).OrderBy(firestore.DocumentID, firestore.Desc)
+}
+
+// ListPublicTrips reads one page past the cursor and works the facets out
+// with count queries, so a page costs about Limit reads. Firestore cannot
+// search text, so a query with Text falls back to scanning and decoding
+// every listed trip: its cost grows with the whole collection.
+func (f *FirestoreStore) ListPublicTrips(ctx context.Context, q PublicTripQuery) (*PublicTripPage, error) {
+	if q.Text != "" {
+		return f.scanPublicTrips(ctx, q)
+	}
+	query := f.listedPublicTrips(q.Accessibility)
+	if q.After != nil {
+		query = query.StartAfter(q.After.ListedAt, q.After.ID)
+	}
+	docs, err := query.Limit(q.Limit + 1).Documents(ctx).GetAll()
+	if err != nil {
+		return nil, err
+	}
+	page := &PublicTripPage{Trips: []PublicTrip{}}
+	for _, doc := range docs {
+		trip, err := decodeFirestorePublicTrip(doc)
+		if err != nil {
+			return nil, err
+		}
+		page.Trips = append(page.Trips, *trip)
+	}
+	if len(page.Trips) > q.Limit {
+		page.Trips = page.Trips[:q.Limit]
+		page.Next = cursorOf(&page.Trips[q.Limit-1])
+	}
+	if page.Facets, err = f.publicTripFacets(ctx, q.Accessibility); err != nil {
+		return nil, err
+	}
+	return page, nil
+}
+
+// publicTripFacets counts the listed trips with every flag of want, in total
+// and per flag. Count queries are billed per batch of index entries, not per
+// document.
+func (f *FirestoreStore) publicTripFacets(ctx context.Context, want TripAccessibility) (AccessibilityFacets, error) {
+	var facets AccessibilityFacets
+	counts := map[*int]TripAccessibility{&facets.Total: want}
+	for count, flag := range map[*int]TripAccessibility{
+		&facets.Mobility:  {Mobility: true},
+		&facets.Sensory:   {Sensory: true},
+		&facets.Dietary:   {Dietary: true},
+		&facets.LowEnergy: {LowEnergy: true},
+	} {
+		counts[count] = TripAccessibility{
+			Mobility:  want.Mobility || flag.Mobility,
+			Sensory:   want.Sensory || flag.Sensory,
+			Dietary:   want.Dietary || flag.Dietary,
+			LowEnergy: want.LowEnergy || flag.LowEnergy,
+		}
+	}
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var firstErr error
+	for count, with := range counts {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			query := f.listedPublicTrips(with)
+			result, err := query.NewAggregationQuery().WithCount("n").Get(ctx)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				if firstErr == nil {
+					firstErr = err
+				}
+				return
+			}
+			n, _ := result["n"].(*firestorepb.Value)
+			*count = int(n.GetIntegerValue())
+		}()
+	}
+	wg.Wait()
+	return facets, firstErr
+}
+
+// scanPublicTrips pages through every listed trip in order, for the filters
+// Firestore cannot run itself.
+func (f *FirestoreStore) scanPublicTrips(ctx context.Context, q PublicTripQuery) (*PublicTripPage, error) {
+	iter := f.client.Collection("publicTrips").OrderBy("listedAt", firestore.Desc).Documents(ctx)
+	defer iter.Stop()
+	pager := newPublicTripPager(q)
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			return &pager.page, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		trip, err := decodeFirestorePublicTrip(doc)
+		if err != nil {
+			return nil, err
+		}
+		pager.add(*trip)
+	}
+}
@@ -0,0 +1,580 @@
+// backend/store_memory.go
+
+package main
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// MemoryStore keeps everything in process memory. It is meant for tests and local development.
+type MemoryStore struct {
+	mu        sync.RWMutex
+	trips     map[string]*Trip
+	revisions map[string][]TripRevision
+	profiles  map[string]*Profile
+	public    map[string]*PublicTrip
+	colls     map[string]*Collection
+	reviews   map[string]map[string]*Review
+	checkIns  map[string][]*EnergyCheckIn
+	relief    map[string]*ReliefPoint
+	sensory   map[string]*SensoryProfile
+	commCards map[string]*CommCard
+	bookings  map[string]*Booking
+	idemKeys  map[string]*IdempotencyRecord
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		trips:     make(map[string]*Trip),
+		revisions: make(map[string][]TripRevision),
+		profiles:  make(map[string]*Profile),
+		public:    make(map[string]*PublicTrip),
+		colls:     make(map[string]*Collection),
+		reviews:   make(map[string]map[string]*Review),
+		checkIns:  make(map[string][]*EnergyCheckIn),
+		relief:    make(map[string]*ReliefPoint),
+		sensory:   make(map[string]*SensoryProfile),
+		commCards: make(map[string]*CommCard),
+		bookings:  make(map[string]*Booking),
+		idemKeys:  make(map[string]*IdempotencyRecord),
+	}
+}
+
+func (m *MemoryStore) CreateTrip(ctx context.Context, trip *Trip) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	trip.ID = uuid.NewString()
+	rev := stampNewTrip(trip)
+	stored := new(Trip)
+	cloneJSON(stored, trip)
+	m.trips[trip.ID] = stored
+	m.revisions[trip.ID] = []TripRevision{rev}
+	return nil
+}
+
+func (m *MemoryStore) GetTrip(ctx context.Context, id string) (*Trip, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	stored, ok := m.trips[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	trip := new(Trip)
+	cloneJSON(trip, stored)
+	return trip, nil
+}
+
+func (m *MemoryStore) UpdateTrip(ctx context.Context, id, reason string, fn func(*Trip) error) (*Trip, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	stored, ok := m.trips[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	trip, rev, err := applyTripUpdate(stored, reason, fn)
+	if err != nil {
+		return nil, err
+	}
+	updated := new(Trip)
+	cloneJSON(updated, trip)
+	m.trips[id] = updated
+	m.revisions[id] = append(m.revisions[id], rev)
+	return trip, nil
+}
+
+func (m *MemoryStore) DeleteTrip(ctx context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.trips[id]; !ok {
+		return ErrNotFound
+	}
+	delete(m.trips, id)
+	delete(m.revisions, id)
+	delete(m.checkIns, id)
+	return nil
+}
+
+func (m *MemoryStore) ListRevisions(ctx context.Context, tripId string) ([]TripRevision, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if _, ok := m.trips[tripId]; !ok {
+		return nil, ErrNotFound
+	}
+	var revs []TripRevision
+	cloneJSON(&revs, m.revisions[tripId])
+	return revs, nil
+}
+
+func (m *MemoryStore) GetRevision(ctx context.Context, tripId string, version int) (*TripRevision, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for _, stored := range m.revisions[tripId] {
+		if stored.Version == version {
+			rev := new(TripRevision)
+			cloneJSON(rev, stored)
+			return rev, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (m *MemoryStore) ListUserTrips(ctx context.Context, userId string) ([]Trip, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var trips []Trip
+	for _, stored := range m.trips {
+		if stored.UserID == userId {
+			var trip Trip
+			cloneJSON(&trip, stored)
+			trips = append(trips, trip)
+		}
+	}
+	return trips, nil
+}
+
+func (m *MemoryStore) GetProfile(ctx context.Context, userId string) (*Profile, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	stored, ok := m.profiles[userId]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	profile := new(Profile)
+	cloneJSON(profile, stored)
+	return profile, nil
+}
+
+func (m *MemoryStore) UpdateProfile(ctx context.Context, userId string, fn func(*Profile) error) (*Profile, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	profile := new(Profile)
+	if stored, ok := m.profiles[userId]; ok {
+		cloneJSON(profile, stored)
+	}
+	if err := fn(profile); err != nil {
+		return nil, err
+	}
+	stored := new(Profile)
+	cloneJSON(stored, profile)
+	m.profiles[userId] = stored
+	return profile, nil
+}
+
+func (m *MemoryStore) SaveProfile(ctx context.Context, userId string, profile *Profile) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	stored := new(Profile)
+	cloneJSON(stored, profile)
+	m.profiles[userId] = stored
+	return nil
+}
+
+func (m *MemoryStore) CreateCollection(ctx context.Context, c *Collection) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	c.ID = uuid.NewString()
+	stored := new(Collection)
+	cloneJSON(stored, c)
+	m.colls[c.ID] = stored
+	return nil
+}
+
+func (m *MemoryStore) GetCollection(ctx context.Context, id string) (*Collection, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	stored, ok := m.colls[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	c := new(Collection)
+	cloneJSON(c, stored)
+	return c, nil
+}
+
+func (m *MemoryStore) UpdateCollection(ctx context.Context, id string, fn func(*Collection) error) (*Collection, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	stored, ok := m.colls[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	c := new(Collection)
+	cloneJSON(c, stored)
+	if err := fn(c); err != nil {
+		return nil, err
+	}
+	c.ID = id
+	updated := new(Collection)
+	cloneJSON(updated, c)
+	m.colls[id] = updated
+	return c, nil
+}
+
+func (m *MemoryStore) DeleteCollection(ctx context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.colls[id]; !ok {
+		return ErrNotFound
+	}
+	delete(m.colls, id)
+	return nil
+}
+
+func (m *MemoryStore) ListCollections(ctx context.Context) ([]Collection, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	colls := make([]Collection, 0, len(m.colls))
+	for _, stored := range m.colls {
+		var c Collection
+		cloneJSON(&c, stored)
+		colls = append(colls, c)
+	}
+	sortCollections(colls)
+	return colls, nil
+}
+
+func (m *MemoryStore) PutReview(ctx context.Context, review *Review) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	byUser, ok := m.reviews[review.PublicTripID]
+	if !ok {
+		byUser = make(map[string]*Review)
+		m.reviews[review.PublicTripID] = byUser
+	}
+	stored := new(Review)
+	cloneJSON(stored, review)
+	byUser[review.UserID] = stored
+	return nil
+}
+
+func (m *MemoryStore) DeleteReview(ctx context.Context, publicTripId, userId string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.reviews[publicTripId][userId]; !ok {
+		return ErrNotFound
+	}
+	delete(m.reviews[publicTripId], userId)
+	return nil
+}
+
+func (m *MemoryStore) ListReviews(ctx context.Context, publicTripId string) ([]Review, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	reviews := []Review{}
+	for _, stored := range m.reviews[publicTripId] {
+		var review Review
+		cloneJSON(&review, stored)
+		reviews = append(reviews, review)
+	}
+	sort.Slice(reviews, func(i, j int) bool { return reviews[i].UpdatedAt.After(reviews[j].UpdatedAt) })
+	return reviews, nil
+}
+
+func (m *MemoryStore) CreateReliefPoint(ctx context.Context, p *ReliefPoint) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	p.ID = uuid.NewString()
+	stored := new(ReliefPoint)
+	cloneJSON(stored, p)
+	m.relief[p.ID] = stored
+	return nil
+}
+
+func (m *MemoryStore) GetReliefPoint(ctx context.Context, id string) (*ReliefPoint, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	stored, ok := m.relief[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	p := new(ReliefPoint)
+	cloneJSON(p, stored)
+	return p, nil
+}
+
+func (m *MemoryStore) UpdateReliefPoint(ctx context.Context, id string, fn func(*ReliefPoint) error) (*ReliefPoint, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	stored, ok := m.relief[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	p := new(ReliefPoint)
+	cloneJSON(p, stored)
+	if err := fn(p); err != nil {
+		return nil, err
+	}
+	p.ID = id
+	updated := new(ReliefPoint)
+	cloneJSON(updated, p)
+	m.relief[id] = updated
+	return p, nil
+}
+
+func (m *MemoryStore) ImportReliefPoints(ctx context.Context, points []ReliefPoint) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	byRef := make(map[string]*ReliefPoint)
+	for _, stored := range m.relief {
+		if stored.SourceRef != "" {
+			byRef[stored.SourceRef] = stored
+		}
+	}
+	created := 0
+	for _, p := range points {
+		if existing, ok := byRef[p.SourceRef]; ok {
+			p.ID, p.Status, p.ModerationNote, p.CreatedAt = existing.ID, existing.Status, existing.ModerationNote, existing.CreatedAt
+		} else {
+			p.ID = uuid.NewString()
+			created++
+		}
+		stored := new(ReliefPoint)
+		cloneJSON(stored, p)
+		m.relief[p.ID] = stored
+		byRef[p.SourceRef] = stored
+	}
+	return created, nil
+}
+
+func (m *MemoryStore) FindReliefPoints(ctx context.Context, q ReliefPointQuery) ([]ReliefPoint, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	points := []ReliefPoint{}
+	for _, stored := range m.relief {
+		if q.matches(stored) {
+			var p ReliefPoint
+			cloneJSON(&p, stored)
+			points = append(points, p)
+		}
+	}
+	sortReliefPoints(points)
+	if len(points) > q.Limit {
+		points = points[:q.Limit]
+	}
+	return points, nil
+}
+
+func (m *MemoryStore) AddCheckIn(ctx context.Context, checkIn *EnergyCheckIn) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	checkIn.ID = uuid.NewString()
+	stored := new(EnergyCheckIn)
+	cloneJSON(stored, checkIn)
+	m.checkIns[checkIn.TripID] = append(m.checkIns[checkIn.TripID], stored)
+	return nil
+}
+
+func (m *MemoryStore) ListCheckIns(ctx context.Context, tripId string) ([]EnergyCheckIn, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	checkIns := []EnergyCheckIn{}
+	for _, stored := range m.checkIns[tripId] {
+		var c EnergyCheckIn
+		cloneJSON(&c, stored)
+		checkIns = append(checkIns, c)
+	}
+	return checkIns, nil
+}
+
+func (m *MemoryStore) CreateBooking(ctx context.Context, booking *Booking) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	booking.ID = uuid.NewString()
+	stored := new(Booking)
+	cloneJSON(stored, booking)
+	m.bookings[booking.ID] = stored
+	return nil
+}
+
+func (m *MemoryStore) GetBooking(ctx context.Context, id string) (*Booking, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	stored, ok := m.bookings[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	booking := new(Booking)
+	cloneJSON(booking, stored)
+	return booking, nil
+}
+
+func (m *MemoryStore) UpdateBooking(ctx context.Context, id string, fn func(*Booking) error) (*Booking, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	stored, ok := m.bookings[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	booking := new(Booking)
+	cloneJSON(booking, stored)
+	if err := fn(booking); err != nil {
+		return nil, err
+	}
+	booking.ID = id
+	updated := new(Booking)
+	cloneJSON(updated, booking)
+	m.bookings[id] = updated
+	return booking, nil
+}
+
+func (m *MemoryStore) ListTripBookings(ctx context.Context, tripId string) ([]Booking, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var bookings []Booking
+	for _, stored := range m.bookings {
+		if stored.TripID == tripId {
+			var booking Booking
+			cloneJSON(&booking, stored)
+			bookings = append(bookings, booking)
+		}
+	}
+	sort.Slice(bookings, func(i, j int) bool { return bookings[i].CreatedAt.Before(bookings[j].CreatedAt) })
+	return bookings, nil
+}
+
+func (m *MemoryStore) GetSensoryProfile(ctx context.Context, key string) (*SensoryProfile, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	stored, ok := m.sensory[key]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	p := new(SensoryProfile)
+	cloneJSON(p, stored)
+	return p, nil
+}
+
+func (m *MemoryStore) PutSensoryProfile(ctx context.Context, p *SensoryProfile) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	stored := new(SensoryProfile)
+	cloneJSON(stored, p)
+	m.sensory[p.Key] = stored
+	return nil
+}
+
+func (m *MemoryStore) CreateCommCard(ctx context.Context, card *CommCard) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	card.ID = uuid.NewString()
+	stored := new(CommCard)
+	cloneJSON(stored, card)
+	m.commCards[card.ID] = stored
+	return nil
+}
+
+func (m *MemoryStore) GetCommCard(ctx context.Context, id string) (*CommCard, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	stored, ok := m.commCards[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	card := new(CommCard)
+	cloneJSON(card, stored)
+	return card, nil
+}
+
+func (m *MemoryStore) ClaimIdempotencyKey(ctx context.Context, scope, key, fingerprint string) (*IdempotencyRecord, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now().UTC()
+	if stored := m.idemKeys[scope+"\x00"+key]; !claimable(stored, now) {
+		rec := *stored
+		return &rec, nil
+	}
+	m.idemKeys[scope+"\x00"+key] = &IdempotencyRecord{Fingerprint: fingerprint, CreatedAt: now}
+	return nil, nil
+}
+
+func (m *MemoryStore) CompleteIdempotencyKey(ctx context.Context, scope, key string, statusCode int, contentType string, body []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	rec, ok := m.idemKeys[scope+"\x00"+key]
+	if !ok {
+		return ErrNotFound
+	}
+	rec.StatusCode, rec.ContentType, rec.Body = statusCode, contentType, append([]byte(nil), body...)
+	return nil
+}
+
+func (m *MemoryStore) ReleaseIdempotencyKey(ctx context.Context, scope, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.idemKeys, scope+"\x00"+key)
+	return nil
+}
+
+func (m *MemoryStore) SavePublicTrip(ctx context.Context, trip *PublicTrip) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	stored := new(PublicTrip)
+	cloneJSON(stored, trip)
+	m.public[trip.ID] = stored
+	return nil
+}
+
+func (m *MemoryStore) GetPublicTrip(ctx context.Context, id string) (*PublicTrip, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	stored, ok := m.public[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	trip := new(PublicTrip)
+	cloneJSON(trip, stored)
+	return trip, nil
+}
+
+func (m *MemoryStore) UpdatePublicTrip(ctx context.Context, id string, fn func(*PublicTrip) error) (*PublicTrip, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	stored, ok := m.public[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	trip := new(PublicTrip)
+	cloneJSON(trip, stored)
+	if err := fn(trip); err != nil {
+		return nil, err
+	}
+	trip.ID = id
+	updated := new(PublicTrip)
+	cloneJSON(updated, trip)
+	m.public[id] = updated
+	return trip, nil
+}
+
+func (m *MemoryStore) DeletePublicTrip(ctx context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.public[id]; !ok {
+		return ErrNotFound
+	}
+	delete(m.public, id)
+	return nil
+}
+
+func (m *MemoryStore) ListPublicTrips(ctx context.Context, q PublicTripQuery) (*PublicTripPage, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var listed []*PublicTrip
+	for _, stored := range m.public {
+		if stored.ListedAt != nil {
+			listed = append(listed, stored)
+		}
+	}
+	sort.Slice(listed, func(i, j int) bool { return cursorOf(listed[i]).follows(listed[j]) })
+	pager := newPublicTripPager(q)
+	for _, stored := range listed {
+		var trip PublicTrip
+		cloneJSON(&trip, stored)
+		pager.add(trip)
+	}
+	return &pager.page, nil
+}
@@ -0,0 +1,1015 @@
+// backend/store_sqlite.go
+
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"modernc.org/sqlite"
+)
+
+// SQLiteStore keeps trips, profiles and bookings in an embedded SQLite file for self-hosting.
+// Each row stores the full document as JSON next to the columns we query on.
+type SQLiteStore struct {
+	db *sql.DB
+}
+
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS trips (
+	id      TEXT PRIMARY KEY,
+	user_id TEXT NOT NULL,
+	data    TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS trips_user ON trips(user_id);
+CREATE TABLE IF NOT EXISTS trip_revisions (
+	trip_id    TEXT NOT NULL REFERENCES trips(id) ON DELETE CASCADE,
+	version    INTEGER NOT NULL,
+	data       TEXT NOT NULL,
+	PRIMARY KEY (trip_id, version)
+);
+CREATE TABLE IF NOT EXISTS profiles (
+	user_id TEXT PRIMARY KEY,
+	data    TEXT NOT NULL
+);
+CREATE TABLE IF NOT EXISTS public_trips (
+	id        TEXT PRIMARY KEY,
+	listed_at INTEGER,
+	data      TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS public_trips_listed ON public_trips(listed_at);
+CREATE TABLE IF NOT EXISTS collections (
+	id       TEXT PRIMARY KEY,
+	position INTEGER NOT NULL,
+	data     TEXT NOT NULL
+);
+CREATE TABLE IF NOT EXISTS reviews (
+	public_trip_id TEXT NOT NULL,
+	user_id        TEXT NOT NULL,
+	updated_at     INTEGER NOT NULL,
+	data           TEXT NOT NULL,
+	PRIMARY KEY (public_trip_id, user_id)
+);
+CREATE TABLE IF NOT EXISTS relief_points (
+	id         TEXT PRIMARY KEY,
+	source_ref TEXT UNIQUE,
+	kind       TEXT NOT NULL,
+	status     TEXT NOT NULL,
+	lat        REAL NOT NULL,
+	lng        REAL NOT NULL,
+	created_at INTEGER NOT NULL,
+	data       TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS relief_points_geo ON relief_points(lat, lng);
+CREATE INDEX IF NOT EXISTS relief_points_status ON relief_points(status, created_at);
+CREATE TABLE IF NOT EXISTS sensory_profiles (
+	key        TEXT PRIMARY KEY,
+	expires_at INTEGER NOT NULL,
+	data       TEXT NOT NULL
+);
+CREATE TABLE IF NOT EXISTS comm_cards (
+	id         TEXT PRIMARY KEY,
+	user_id    TEXT NOT NULL,
+	created_at INTEGER NOT NULL,
+	data       TEXT NOT NULL
+);
+CREATE TABLE IF NOT EXISTS energy_check_ins (
+	id         TEXT PRIMARY KEY,
+	trip_id    TEXT NOT NULL REFERENCES trips(id) ON DELETE CASCADE,
+	created_at INTEGER NOT NULL,
+	data       TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS energy_check_ins_trip ON energy_check_ins(trip_id, created_at);
+CREATE TABLE IF NOT EXISTS bookings (
+	id         TEXT PRIMARY KEY,
+	trip_id    TEXT NOT NULL,
+	created_at INTEGER NOT NULL,
+	data       TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS bookings_trip ON bookings(trip_id, created_at);
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+	scope TEXT NOT NULL,
+	key   TEXT NOT NULL,
+	data  TEXT NOT NULL,
+	PRIMARY KEY (scope, key)
+);
+`
+
+// registerSQLiteFunctions adds go_lower, which folds case the way
+// strings.ToLower does; SQLite's own lower() and LIKE only fold ASCII.
+var registerSQLiteFunctions = sync.OnceFunc(func() {
+	sqlite.MustRegisterDeterministicScalarFunction("go_lower", 1, func(ctx *sqlite.FunctionContext, args []driver.Value) (driver.Value, error) {
+		s, ok := args[0].(string)
+		if !ok {
+			return args[0], nil
+		}
+		return strings.ToLower(s), nil
+	})
+})
+
+func NewSQLiteStore(path string) (*SQLiteStore, error) {
+	registerSQLiteFunctions()
+	db, err := sql.Open("sqlite", path+"?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)&_pragma=foreign_keys(1)")
+	if err != nil {
+		return nil, err
+	}
+	// SQLite allows a single writer; one connection avoids "database is locked" errors.
+	db.SetMaxOpenConns(1)
+	if _, err := db.Exec(sqliteSchema); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &SQLiteStore{db: db}, nil
+}
+
+func (s *SQLiteStore) Close() error {
+	return s.db.Close()
+}
+
+func (s *SQLiteStore) CreateTrip(ctx context.Context, trip *Trip) error {
+	trip.ID = uuid.NewString()
+	rev := stampNewTrip(trip)
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	data, err := json.Marshal(trip)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx,
+		`INSERT INTO trips (id, user_id, data) VALUES (?, ?, ?)`,
+		trip.ID, trip.UserID, string(data))
+	if err != nil {
+		return err
+	}
+	if err := insertSQLiteRevision(ctx, tx, trip.ID, rev); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *SQLiteStore) GetTrip(ctx context.Context, id string) (*Trip, error) {
+	return getSQLiteTrip(ctx, s.db, id)
+}
+
+// sqlQueryer is satisfied by both *sql.DB and *sql.Tx.
+type sqlQueryer interface {
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+func getSQLiteTrip(ctx context.Context, db sqlQueryer, id string) (*Trip, error) {
+	var data string
+	err := db.QueryRowContext(ctx, `SELECT data FROM trips WHERE id = ?`, id).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	var trip Trip
+	if err := json.Unmarshal([]byte(data), &trip); err != nil {
+		return nil, err
+	}
+	return &trip, nil
+}
+
+func (s *SQLiteStore) UpdateTrip(ctx context.Context, id, reason string, fn func(*Trip) error) (*Trip, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	stored, err := getSQLiteTrip(ctx, tx, id)
+	if err != nil {
+		return nil, err
+	}
+	trip, rev, err := applyTripUpdate(stored, reason, fn)
+	if err != nil {
+		return nil, err
+	}
+	data, err := json.Marshal(trip)
+	if err != nil {
+		return nil, err
+	}
+	_, err = tx.ExecContext(ctx,
+		`UPDATE trips SET data = ? WHERE id = ?`,
+		string(data), id)
+	if err != nil {
+		return nil, err
+	}
+	if err := insertSQLiteRevision(ctx, tx, id, rev); err != nil {
+		return nil, err
+	}
+	return trip, tx.Commit()
+}
+
+func insertSQLiteRevision(ctx context.Context, db sqlExecer, tripId string, rev TripRevision) error {
+	data, err := json.Marshal(rev)
+	if err != nil {
+		return err
+	}
+	_, err = db.ExecContext(ctx,
+		`INSERT INTO trip_revisions (trip_id, version, data) VALUES (?, ?, ?)`,
+		tripId, rev.Version, string(data))
+	return err
+}
+
+func (s *SQLiteStore) DeleteTrip(ctx context.Context, id string) error {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM trips WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *SQLiteStore) ListRevisions(ctx context.Context, tripId string) ([]TripRevision, error) {
+	if _, err := s.GetTrip(ctx, tripId); err != nil {
+		return nil, err
+	}
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT data FROM trip_revisions WHERE trip_id = ? ORDER BY version`, tripId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var revs []TripRevision
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return nil, err
+		}
+		var rev TripRevision
+		if err := json.Unmarshal([]byte(data), &rev); err != nil {
+			return nil, err
+		}
+		revs = append(revs, rev)
+	}
+	return revs, rows.Err()
+}
+
+func (s *SQLiteStore) GetRevision(ctx context.Context, tripId string, version int) (*TripRevision, error) {
+	var data string
+	err := s.db.QueryRowContext(ctx,
+		`SELECT data FROM trip_revisions WHERE trip_id = ? AND version = ?`, tripId, version).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	var rev TripRevision
+	if err := json.Unmarshal([]byte(data), &rev); err != nil {
+		return nil, err
+	}
+	return &rev, nil
+}
+
+func (s *SQLiteStore) ListUserTrips(ctx context.Context, userId string) ([]Trip, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT data FROM trips WHERE user_id = ?`, userId)
+	if err != nil {
+		return nil, err
+	}
+	return scanTrips(rows)
+}
+
+// scanTrips decodes every "data" row of a trips query.
+func scanTrips(rows *sql.Rows) ([]Trip, error) {
+	defer rows.Close()
+	var trips []Trip
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return nil, err
+		}
+		var trip Trip
+		if err := json.Unmarshal([]byte(data), &trip); err != nil {
+			return nil, err
+		}
+		trips = append(trips, trip)
+	}
+	return trips, rows.Err()
+}
+
+func (s *SQLiteStore) GetProfile(ctx context.Context, userId string) (*Profile, error) {
+	var data string
+	err := s.db.QueryRowContext(ctx, `SELECT data FROM profiles WHERE user_id = ?`, userId).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	var profile Profile
+	if err := json.Unmarshal([]byte(data), &profile); err != nil {
+		return nil, err
+	}
+	return &profile, nil
+}
+
+func (s *SQLiteStore) SaveProfile(ctx context.Context, userId string, profile *Profile) error {
+	return saveSQLiteProfile(ctx, s.db, userId, profile)
+}
+
+func (s *SQLiteStore) UpdateProfile(ctx context.Context, userId string, fn func(*Profile) error) (*Profile, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	var profile Profile
+	var data string
+	err = tx.QueryRowContext(ctx, `SELECT data FROM profiles WHERE user_id = ?`, userId).Scan(&data)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+	case err != nil:
+		return nil, err
+	default:
+		if err := json.Unmarshal([]byte(data), &profile); err != nil {
+			return nil, err
+		}
+	}
+	if err := fn(&profile); err != nil {
+		return nil, err
+	}
+	if err := saveSQLiteProfile(ctx, tx, userId, &profile); err != nil {
+		return nil, err
+	}
+	return &profile, tx.Commit()
+}
+
+// sqlExecer is satisfied by both *sql.DB and *sql.Tx.
+type sqlExecer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+func saveSQLiteProfile(ctx context.Context, db sqlExecer, userId string, profile *Profile) error {
+	data, err := json.Marshal(profile)
+	if err != nil {
+		return err
+	}
+	_, err = db.ExecContext(ctx,
+		`INSERT INTO profiles (user_id, data) VALUES (?, ?)
+		 ON CONFLICT(user_id) DO UPDATE SET data = excluded.data`,
+		userId, string(data))
+	return err
+}
+
+func (s *SQLiteStore) CreateCollection(ctx context.Context, c *Collection) error {
+	c.ID = uuid.NewString()
+	data, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.ExecContext(ctx,
+		`INSERT INTO collections (id, position, data) VALUES (?, ?, ?)`, c.ID, c.Position, string(data))
+	return err
+}
+
+func (s *SQLiteStore) GetCollection(ctx context.Context, id string) (*Collection, error) {
+	return getSQLiteCollection(ctx, s.db, id)
+}
+
+func getSQLiteCollection(ctx context.Context, db sqlQueryer, id string) (*Collection, error) {
+	var data string
+	err := db.QueryRowContext(ctx, `SELECT data FROM collections WHERE id = ?`, id).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	var c Collection
+	if err := json.Unmarshal([]byte(data), &c); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+func (s *SQLiteStore) UpdateCollection(ctx context.Context, id string, fn func(*Collection) error) (*Collection, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	c, err := getSQLiteCollection(ctx, tx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := fn(c); err != nil {
+		return nil, err
+	}
+	c.ID = id
+	data, err := json.Marshal(c)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE collections SET position = ?, data = ? WHERE id = ?`, c.Position, string(data), id); err != nil {
+		return nil, err
+	}
+	return c, tx.Commit()
+}
+
+func (s *SQLiteStore) DeleteCollection(ctx context.Context, id string) error {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM collections WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *SQLiteStore) ListCollections(ctx context.Context) ([]Collection, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT data FROM collections ORDER BY position`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	colls := []Collection{}
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return nil, err
+		}
+		var c Collection
+		if err := json.Unmarshal([]byte(data), &c); err != nil {
+			return nil, err
+		}
+		colls = append(colls, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	sortCollections(colls)
+	return colls, nil
+}
+
+func (s *SQLiteStore) PutReview(ctx context.Context, review *Review) error {
+	data, err := json.Marshal(review)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.ExecContext(ctx,
+		`INSERT INTO reviews (public_trip_id, user_id, updated_at, data) VALUES (?, ?, ?, ?)
+		 ON CONFLICT(public_trip_id, user_id) DO UPDATE SET updated_at = excluded.updated_at, data = excluded.data`,
+		review.PublicTripID, review.UserID, review.UpdatedAt.UnixNano(), string(data))
+	return err
+}
+
+func (s *SQLiteStore) DeleteReview(ctx context.Context, publicTripId, userId string) error {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM reviews WHERE public_trip_id = ? AND user_id = ?`, publicTripId, userId)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *SQLiteStore) ListReviews(ctx context.Context, publicTripId string) ([]Review, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT data FROM reviews WHERE public_trip_id = ? ORDER BY updated_at DESC`, publicTripId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	reviews := []Review{}
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return nil, err
+		}
+		var review Review
+		if err := json.Unmarshal([]byte(data), &review); err != nil {
+			return nil, err
+		}
+		reviews = append(reviews, review)
+	}
+	return reviews, rows.Err()
+}
+
+// saveSQLiteReliefPoint inserts p, or replaces the row with the same ID.
+func saveSQLiteReliefPoint(ctx context.Context, db sqlExecer, p *ReliefPoint) error {
+	data, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	var sourceRef interface{}
+	if p.SourceRef != "" {
+		sourceRef = p.SourceRef
+	}
+	_, err = db.ExecContext(ctx,
+		`INSERT INTO relief_points (id, source_ref, kind, status, lat, lng, created_at, data) VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		 ON CONFLICT(id) DO UPDATE SET source_ref = excluded.source_ref, kind = excluded.kind, status = excluded.status,
+		 lat = excluded.lat, lng = excluded.lng, data = excluded.data`,
+		p.ID, sourceRef, p.Kind, p.Status, p.Lat, p.Lng, p.CreatedAt.UnixNano(), string(data))
+	return err
+}
+
+func getSQLiteReliefPoint(ctx context.Context, db sqlQueryer, where string, arg interface{}) (*ReliefPoint, error) {
+	var data string
+	err := db.QueryRowContext(ctx, `SELECT data FROM relief_points WHERE `+where+` = ?`, arg).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	var p ReliefPoint
+	if err := json.Unmarshal([]byte(data), &p); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+func (s *SQLiteStore) CreateReliefPoint(ctx context.Context, p *ReliefPoint) error {
+	p.ID = uuid.NewString()
+	return saveSQLiteReliefPoint(ctx, s.db, p)
+}
+
+func (s *SQLiteStore) GetReliefPoint(ctx context.Context, id string) (*ReliefPoint, error) {
+	return getSQLiteReliefPoint(ctx, s.db, "id", id)
+}
+
+func (s *SQLiteStore) UpdateReliefPoint(ctx context.Context, id string, fn func(*ReliefPoint) error) (*ReliefPoint, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	p, err := getSQLiteReliefPoint(ctx, tx, "id", id)
+	if err != nil {
+		return nil, err
+	}
+	if err := fn(p); err != nil {
+		return nil, err
+	}
+	p.ID = id
+	if err := saveSQLiteReliefPoint(ctx, tx, p); err != nil {
+		return nil, err
+	}
+	return p, tx.Commit()
+}
+
+func (s *SQLiteStore) ImportReliefPoints(ctx context.Context, points []ReliefPoint) (int, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	created := 0
+	for _, p := range points {
+		existing, err := getSQLiteReliefPoint(ctx, tx, "source_ref", p.SourceRef)
+		switch {
+		case err == nil:
+			p.ID, p.Status, p.ModerationNote, p.CreatedAt = existing.ID, existing.Status, existing.ModerationNote, existing.CreatedAt
+		case errors.Is(err, ErrNotFound):
+			p.ID = uuid.NewString()
+			created++
+		default:
+			return 0, err
+		}
+		if err := saveSQLiteReliefPoint(ctx, tx, &p); err != nil {
+			return 0, err
+		}
+	}
+	return created, tx.Commit()
+}
+
+func (s *SQLiteStore) FindReliefPoints(ctx context.Context, q ReliefPointQuery) ([]ReliefPoint, error) {
+	where := []string{"1 = 1"}
+	var args []interface{}
+	if b := q.Box; b != nil {
+		where = append(where, "lat BETWEEN ? AND ? AND lng BETWEEN ? AND ?")
+		args = append(args, b.MinLat, b.MaxLat, b.MinLng, b.MaxLng)
+	}
+	if q.Status != "" {
+		where = append(where, "status = ?")
+		args = append(args, q.Status)
+	}
+	if len(q.Kinds) > 0 {
+		where = append(where, "kind IN (?"+strings.Repeat(", ?", len(q.Kinds)-1)+")")
+		for _, kind := range q.Kinds {
+			args = append(args, kind)
+		}
+	}
+	args = append(args, q.Limit)
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT data FROM relief_points WHERE `+strings.Join(where, " AND ")+` ORDER BY created_at, id LIMIT ?`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	points := []ReliefPoint{}
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return nil, err
+		}
+		var p ReliefPoint
+		if err := json.Unmarshal([]byte(data), &p); err != nil {
+			return nil, err
+		}
+		points = append(points, p)
+	}
+	return points, rows.Err()
+}
+
+func (s *SQLiteStore) AddCheckIn(ctx context.Context, checkIn *EnergyCheckIn) error {
+	checkIn.ID = uuid.NewString()
+	data, err := json.Marshal(checkIn)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.ExecContext(ctx,
+		`INSERT INTO energy_check_ins (id, trip_id, created_at, data) VALUES (?, ?, ?, ?)`,
+		checkIn.ID, checkIn.TripID, checkIn.CreatedAt.UnixNano(), string(data))
+	return err
+}
+
+func (s *SQLiteStore) ListCheckIns(ctx context.Context, tripId string) ([]EnergyCheckIn, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT data FROM energy_check_ins WHERE trip_id = ? ORDER BY created_at, id`, tripId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	checkIns := []EnergyCheckIn{}
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return nil, err
+		}
+		var c EnergyCheckIn
+		if err := json.Unmarshal([]byte(data), &c); err != nil {
+			return nil, err
+		}
+		checkIns = append(checkIns, c)
+	}
+	return checkIns, rows.Err()
+}
+
+func (s *SQLiteStore) CreateBooking(ctx context.Context, booking *Booking) error {
+	booking.ID = uuid.NewString()
+	data, err := json.Marshal(booking)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.ExecContext(ctx,
+		`INSERT INTO bookings (id, trip_id, created_at, data) VALUES (?, ?, ?, ?)`,
+		booking.ID, booking.TripID, booking.CreatedAt.UnixNano(), string(data))
+	return err
+}
+
+func (s *SQLiteStore) GetBooking(ctx context.Context, id string) (*Booking, error) {
+	return getSQLiteBooking(ctx, s.db, id)
+}
+
+func getSQLiteBooking(ctx context.Context, db sqlQueryer, id string) (*Booking, error) {
+	var data string
+	err := db.QueryRowContext(ctx, `SELECT data FROM bookings WHERE id = ?`, id).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	var booking Booking
+	if err := json.Unmarshal([]byte(data), &booking); err != nil {
+		return nil, err
+	}
+	return &booking, nil
+}
+
+func (s *SQLiteStore) UpdateBooking(ctx context.Context, id string, fn func(*Booking) error) (*Booking, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	booking, err := getSQLiteBooking(ctx, tx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := fn(booking); err != nil {
+		return nil, err
+	}
+	booking.ID = id
+	data, err := json.Marshal(booking)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE bookings SET data = ? WHERE id = ?`, string(data), id); err != nil {
+		return nil, err
+	}
+	return booking, tx.Commit()
+}
+
+func (s *SQLiteStore) ListTripBookings(ctx context.Context, tripId string) ([]Booking, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT data FROM bookings WHERE trip_id = ? ORDER BY created_at`, tripId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var bookings []Booking
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return nil, err
+		}
+		var booking Booking
+		if err := json.Unmarshal([]byte(data), &booking); err != nil {
+			return nil, err
+		}
+		bookings = append(bookings, booking)
+	}
+	return bookings, rows.Err()
+}
+
+func (s *SQLiteStore) GetSensoryProfile(ctx context.Context, key string) (*SensoryProfile, error) {
+	var data string
+	err := s.db.QueryRowContext(ctx, `SELECT data FROM sensory_profiles WHERE key = ?`, key).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	var p SensoryProfile
+	if err := json.Unmarshal([]byte(data), &p); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+func (s *SQLiteStore) PutSensoryProfile(ctx context.Context, p *SensoryProfile) error {
+	data, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.ExecContext(ctx,
+		`INSERT INTO sensory_profiles (key, expires_at, data) VALUES (?, ?, ?)
+		 ON CONFLICT(key) DO UPDATE SET expires_at = excluded.expires_at, data = excluded.data`,
+		p.Key, p.ExpiresAt.UnixNano(), string(data))
+	return err
+}
+
+func (s *SQLiteStore) CreateCommCard(ctx context.Context, card *CommCard) error {
+	card.ID = uuid.NewString()
+	data, err := json.Marshal(card)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.ExecContext(ctx,
+		`INSERT INTO comm_cards (id, user_id, created_at, data) VALUES (?, ?, ?, ?)`,
+		card.ID, card.UserID, card.CreatedAt.UnixNano(), string(data))
+	return err
+}
+
+func (s *SQLiteStore) GetCommCard(ctx context.Context, id string) (*CommCard, error) {
+	var data string
+	err := s.db.QueryRowContext(ctx, `SELECT data FROM comm_cards WHERE id = ?`, id).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	var card CommCard
+	if err := json.Unmarshal([]byte(data), &card); err != nil {
+		return nil, err
+	}
+	return &card, nil
+}
+
+func (s *SQLiteStore) ClaimIdempotencyKey(ctx context.Context, scope, key, fingerprint string) (*IdempotencyRecord, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	now := time.Now().UTC()
+	var data string
+	err = tx.QueryRowContext(ctx,
+		`SELECT data FROM idempotency_keys WHERE scope = ? AND key = ?`, scope, key).Scan(&data)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+	if err == nil {
+		var rec IdempotencyRecord
+		if err := json.Unmarshal([]byte(data), &rec); err != nil {
+			return nil, err
+		}
+		if !claimable(&rec, now) {
+			return &rec, nil
+		}
+	}
+	if err := saveSQLiteIdempotency(ctx, tx, scope, key, &IdempotencyRecord{Fingerprint: fingerprint, CreatedAt: now}); err != nil {
+		return nil, err
+	}
+	return nil, tx.Commit()
+}
+
+func (s *SQLiteStore) CompleteIdempotencyKey(ctx context.Context, scope, key string, statusCode int, contentType string, body []byte) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	var data string
+	err = tx.QueryRowContext(ctx,
+		`SELECT data FROM idempotency_keys WHERE scope = ? AND key = ?`, scope, key).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+	var rec IdempotencyRecord
+	if err := json.Unmarshal([]byte(data), &rec); err != nil {
+		return err
+	}
+	rec.StatusCode, rec.ContentType, rec.Body = statusCode, contentType, body
+	if err := saveSQLiteIdempotency(ctx, tx, scope, key, &rec); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *SQLiteStore) ReleaseIdempotencyKey(ctx context.Context, scope, key string) error {
+	_, err := s.db.ExecContext(ctx, `DELETE FROM idempotency_keys WHERE scope = ? AND key = ?`, scope, key)
+	return err
+}
+
+func saveSQLiteIdempotency(ctx context.Context, db sqlExecer, scope, key string, rec *IdempotencyRecord) error {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	_, err = db.ExecContext(ctx,
+		`INSERT INTO idempotency_keys (scope, key, data) VALUES (?, ?, ?)
+		 ON CONFLICT(scope, key) DO UPDATE SET data = excluded.data`,
+		scope, key, string(data))
+	return err
+}
+
+func (s *SQLiteStore) SavePublicTrip(ctx context.Context, trip *PublicTrip) error {
+	return saveSQLitePublicTrip(ctx, s.db, trip)
+}
+
+func saveSQLitePublicTrip(ctx context.Context, db sqlExecer, trip *PublicTrip) error {
+	data, err := json.Marshal(trip)
+	if err != nil {
+		return err
+	}
+	var listedAt interface{}
+	if trip.ListedAt != nil {
+		listedAt = trip.ListedAt.UnixNano()
+	}
+	_, err = db.ExecContext(ctx,
+		`INSERT INTO public_trips (id, listed_at, data) VALUES (?, ?, ?)
+		 ON CONFLICT(id) DO UPDATE SET listed_at = excluded.listed_at, data = excluded.data`,
+		trip.ID, listedAt, string(data))
+	return err
+}
+
+func (s *SQLiteStore) GetPublicTrip(ctx context.Context, id string) (*PublicTrip, error) {
+	return getSQLitePublicTrip(ctx, s.db, id)
+}
+
+func getSQLitePublicTrip(ctx context.Context, db sqlQueryer, id string) (*PublicTrip, error) {
+	var data string
+	err := db.QueryRowContext(ctx, `SELECT data FROM public_trips WHERE id = ?`, id).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	var trip PublicTrip
+	if err := json.Unmarshal([]byte(data), &trip); err != nil {
+		return nil, err
+	}
+	return &trip, nil
+}
+
+func (s *SQLiteStore) UpdatePublicTrip(ctx context.Context, id string, fn func(*PublicTrip) error) (*PublicTrip, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	trip, err := getSQLitePublicTrip(ctx, tx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := fn(trip); err != nil {
+		return nil, err
+	}
+	trip.ID = id
+	if err := saveSQLitePublicTrip(ctx, tx, trip); err != nil {
+		return nil, err
+	}
+	return trip, tx.Commit()
+}
+
+func (s *SQLiteStore) DeletePublicTrip(ctx context.Context, id string) error {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM public_trips WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// publicTripFilter turns the text and flag filters of q into a WHERE clause
+// over public_trips. Flags are read out of the JSON document.
+func publicTripFilter(q PublicTripQuery) (string, []interface{}) {
+	where := []string{"listed_at IS NOT NULL"}
+	var args []interface{}
+	if text := strings.ToLower(q.Text); text != "" {
+		// Matches PublicTripQuery.matches, case-insensitively in any script.
+		where = append(where, `(instr(go_lower(json_extract(data, '$.tripTitle')), ?) > 0 OR instr(go_lower(json_extract(data, '$.destination')), ?) > 0)`)
+		args = append(args, text, text)
+	}
+	for _, flag := range []struct {
+		want bool
+		path string
+	}{
+		{q.Accessibility.Mobility, "$.accessibility.mobility"},
+		{q.Accessibility.Sensory, "$.accessibility.sensory"},
+		{q.Accessibility.Dietary, "$.accessibility.dietary"},
+		{q.Accessibility.LowEnergy, "$.accessibility.lowEnergy"},
+	} {
+		if flag.want {
+			where = append(where, "json_extract(data, ?) = 1")
+			args = append(args, flag.path)
+		}
+	}
+	return strings.Join(where, " AND "), args
+}
+
+func (s *SQLiteStore) ListPublicTrips(ctx context.Context, q PublicTripQuery) (*PublicTripPage, error) {
+	where, args := publicTripFilter(q)
+	page := &PublicTripPage{Trips: []PublicTrip{}}
+	err := s.db.QueryRowContext(ctx, `SELECT COUNT(*),
+		COALESCE(SUM(json_extract(data, '$.accessibility.mobility')), 0),
+		COALESCE(SUM(json_extract(data, '$.accessibility.sensory')), 0),
+		COALESCE(SUM(json_extract(data, '$.accessibility.dietary')), 0),
+		COALESCE(SUM(json_extract(data, '$.accessibility.lowEnergy')), 0)
+		FROM public_trips WHERE `+where, args...).Scan(
+		&page.Facets.Total, &page.Facets.Mobility, &page.Facets.Sensory, &page.Facets.Dietary, &page.Facets.LowEnergy)
+	if err != nil {
+		return nil, err
+	}
+
+	if q.After != nil {
+		where += " AND (listed_at < ? OR (listed_at = ? AND id < ?))"
+		after := q.After.ListedAt.UnixNano()
+		args = append(args, after, after, q.After.ID)
+	}
+	// One extra row tells us whether another page follows.
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT data FROM public_trips WHERE `+where+` ORDER BY listed_at DESC, id DESC LIMIT ?`,
+		append(args, q.Limit+1)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return nil, err
+		}
+		if len(page.Trips) == q.Limit {
+			page.Next = cursorOf(&page.Trips[len(page.Trips)-1])
+			break
+		}
+		var trip PublicTrip
+		if err := json.Unmarshal([]byte(data), &trip); err != nil {
+			return nil, err
+		}
+		page.Trips = append(page.Trips, trip)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return page, nil
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Every TripStore keeps the same revision contract; it runs against the
+// backends that work offline.
+func TestTripStoreRevisions(t *testing.T) {
+	t.Run("memory", func(t *testing.T) { testTripStoreRevisions(t, NewMemoryStore()) })
+	t.Run("sqlite", func(t *testing.T) {
+		store, err := NewSQLiteStore(filepath.Join(t.TempDir(), "auryvia.db"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { store.Close() })
+		testTripStoreRevisions(t, store)
+	})
+}
+
+func testTripStoreRevisions(t *testing.T, store TripStore) {
+	ctx := context.Background()
+	trip := &Trip{UserID: "user-1", Itinerary: Itinerary{TripTitle: "Kyoto", Destination: "Kyoto, Japan"}}
+	if err := store.CreateTrip(ctx, trip); err != nil {
+		t.Fatal(err)
+	}
+	if trip.ID == "" || trip.Version != 1 {
+		t.Fatalf("created trip has id %q, version %d", trip.ID, trip.Version)
+	}
+
+	t.Run("update records the next version", func(t *testing.T) {
+		updated, err := store.UpdateTrip(ctx, trip.ID, revisionUpdate, func(tr *Trip) error {
+			tr.Itinerary.TripTitle = "Kyoto in spring"
+			tr.UserID = "someone-else" // not the caller's to change
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if updated.Version != 2 || updated.UserID != "user-1" {
+			t.Errorf("updated trip has version %d, owner %q", updated.Version, updated.UserID)
+		}
+		revs, err := store.ListRevisions(ctx, trip.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(revs) != 2 || revs[0].Reason != revisionCreate || revs[1].Reason != revisionUpdate {
+			t.Fatalf("revisions %+v", revs)
+		}
+		first, err := store.GetRevision(ctx, trip.ID, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if first.Trip.Itinerary.TripTitle != "Kyoto" {
+			t.Errorf("revision 1 has title %q", first.Trip.Itinerary.TripTitle)
+		}
+	})
+
+	t.Run("failed update changes nothing", func(t *testing.T) {
+		boom := errors.New("boom")
+		if _, err := store.UpdateTrip(ctx, trip.ID, revisionUpdate, func(tr *Trip) error {
+			tr.Itinerary.TripTitle = "lost"
+			return boom
+		}); !errors.Is(err, boom) {
+			t.Fatalf("got %v, want boom", err)
+		}
+		stored, err := store.GetTrip(ctx, trip.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if stored.Version != 2 || stored.Itinerary.TripTitle != "Kyoto in spring" {
+			t.Errorf("stored trip changed to version %d, title %q", stored.Version, stored.Itinerary.TripTitle)
+		}
+		if _, err := store.GetRevision(ctx, trip.ID, 3); !errors.Is(err, ErrNotFound) {
+			t.Errorf("revision 3: got %v, want ErrNotFound", err)
+		}
+	})
+
+	t.Run("stale If-Match is a version conflict", func(t *testing.T) {
+		setGlobal(t, &tripStore, store)
+		req := httptest.NewRequest("PUT", "/api/trips/"+trip.ID, nil)
+		req = req.WithContext(context.WithValue(req.Context(), userIDKey, "user-1"))
+		req.Header.Set("If-Match", `"1"`)
+		if _, err := updateOwnedTrip(req, trip.ID, revisionUpdate, func(*Trip) error { return nil }); !errors.Is(err, errVersionConflict) {
+			t.Fatalf("got %v, want errVersionConflict", err)
+		}
+		req.Header.Set("If-Match", `"2"`)
+		updated, err := updateOwnedTrip(req, trip.ID, revisionPatch, func(*Trip) error { return nil })
+		if err != nil {
+			t.Fatal(err)
+		}
+		if updated.Version != 3 {
+			t.Errorf("version %d, want 3", updated.Version)
+		}
+	})
+
+	t.Run("concurrent updates each get a version", func(t *testing.T) {
+		const writers = 8
+		var wg sync.WaitGroup
+		for range writers {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if _, err := store.UpdateTrip(ctx, trip.ID, revisionUpdate, func(*Trip) error { return nil }); err != nil {
+					t.Error(err)
+				}
+			}()
+		}
+		wg.Wait()
+		revs, err := store.ListRevisions(ctx, trip.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i, rev := range revs {
+			if rev.Version != i+1 {
+				t.Fatalf("revision %d has version %d", i, rev.Version)
+			}
+		}
+		if len(revs) != 3+writers {
+			t.Errorf("%d revisions, want %d", len(revs), 3+writers)
+		}
+	})
+
+	t.Run("missing trips", func(t *testing.T) {
+		if _, err := store.UpdateTrip(ctx, "missing", revisionUpdate, func(*Trip) error { return nil }); !errors.Is(err, ErrNotFound) {
+			t.Errorf("update: got %v, want ErrNotFound", err)
+		}
+		if err := store.DeleteTrip(ctx, trip.ID); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := store.ListRevisions(ctx, trip.ID); !errors.Is(err, ErrNotFound) {
+			t.Errorf("revisions of a deleted trip: got %v, want ErrNotFound", err)
+		}
+	})
+}
+
+// Public trip text search folds case beyond ASCII in every backend.
+func TestPublicTripTextSearch(t *testing.T) {
+	sqliteStore, err := NewSQLiteStore(filepath.Join(t.TempDir(), "auryvia.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sqliteStore.Close()
+	stores := map[string]PublicTripStore{"memory": NewMemoryStore(), "sqlite": sqliteStore}
+	for name, store := range stores {
+		ctx := context.Background()
+		listed := time.Now().UTC()
+		for i, title := range []string{"Ōsaka street food", "A calm week in Zürich", "ÉTÉ À PARIS"} {
+			trip := &PublicTrip{ID: string(rune('a' + i)), TripTitle: title, Destination: "Somewhere", ListedAt: &listed}
+			if err := store.SavePublicTrip(ctx, trip); err != nil {
+				t.Fatal(err)
+			}
+		}
+		for text, want := range map[string]string{"ōsaka": "Ōsaka street food", "ZÜRICH": "A calm week in Zürich", "été": "ÉTÉ À PARIS", "50%": ""} {
+			page, err := store.ListPublicTrips(ctx, PublicTripQuery{Text: text, Limit: 10})
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, trip := range page.Trips {
+				got = append(got, trip.TripTitle)
+			}
+			if want == "" && len(got) != 0 || want != "" && (len(got) != 1 || got[0] != want) {
+				t.Errorf("%s: search %q found %q, want %q", name, text, got, want)
+			}
+		}
+	}
+}
@@ -0,0 +1,221 @@
+// backend/stream.go
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// dayStreamParser watches a partially received itinerary JSON document and
+// hands back each object in the "itinerary" array as soon as it is complete.
+type dayStreamParser struct {
+	buf         strings.Builder
+	depth       int
+	inString    bool
+	escaped     bool
+	strStart    int
+	wantKey     bool
+	lastKey     string
+	inItinerary bool
+	dayStart    int
+}
+
+// Feed appends chunk and returns the raw JSON of every day completed by it.
+func (p *dayStreamParser) Feed(chunk string) []string {
+	var days []string
+	start := p.buf.Len()
+	p.buf.WriteString(chunk)
+	text := p.buf.String()
+	for i := start; i < len(text); i++ {
+		c := text[i]
+		if p.inString {
+			switch {
+			case p.escaped:
+				p.escaped = false
+			case c == '\\':
+				p.escaped = true
+			case c == '"':
+				p.inString = false
+				if p.depth == 1 && p.wantKey {
+					p.lastKey = text[p.strStart+1 : i]
+					p.wantKey = false
+				}
+			}
+			continue
+		}
+		switch c {
+		case '"':
+			p.inString = true
+			p.strStart = i
+		case ',':
+			p.wantKey = p.depth == 1
+		case '{', '[':
+			if c == '{' && p.depth == 0 {
+				p.wantKey = true
+			}
+			if c == '[' && p.depth == 1 && p.lastKey == "itinerary" {
+				p.inItinerary = true
+			}
+			if c == '{' && p.depth == 2 && p.inItinerary {
+				p.dayStart = i
+			}
+			p.depth++
+		case '}', ']':
+			p.depth--
+			if c == '}' && p.depth == 2 && p.inItinerary {
+				days = append(days, text[p.dayStart:i+1])
+			}
+			if c == ']' && p.depth == 1 {
+				p.inItinerary = false
+			}
+		}
+	}
+	return days
+}
+
+// String returns everything received so far.
+func (p *dayStreamParser) String() string {
+	return p.buf.String()
+}
+
+// sseWriter writes named Server-Sent Events and flushes after each one.
+type sseWriter struct {
+	w       http.ResponseWriter
+	flusher http.Flusher
+}
+
+func newSSEWriter(w http.ResponseWriter) (*sseWriter, error) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		return nil, errors.New("streaming unsupported")
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+	return &sseWriter{w: w, flusher: flusher}, nil
+}
+
+func (s *sseWriter) Send(event string, data interface{}) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(s.w, "event: %s\ndata: %s\n\n", event, payload); err != nil {
+		return err
+	}
+	s.flusher.Flush()
+	return nil
+}
+
+// handleGenerateStream is the streaming twin of handleGenerate. It emits a
+// "day" event for every valid day as the model writes it, then one
+// "itinerary" event with the validated result, or an "error" event. A day
+// that fails validation gets an "invalid_day" error event instead of its
+// "day" event and the stream goes on; the final pass repairs it. With
+// ?optimize=true the days are reordered before that final event, and for a
+// traveller with sensory tolerances activities over their limits are swapped
+// or flagged, so the final days may differ from the "day" events sent earlier.
+func handleGenerateStream(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "Can't read your request", http.StatusBadRequest)
+		return
+	}
+	tripIdea := string(body)
+	ceiling, err := budgetCeiling(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	optimize, err := queryFlag(r, "optimize")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Signed-in users get their profile applied and the trip saved
+	userId := userIDFrom(r.Context())
+
+	ctx := r.Context()
+	prompt := buildItineraryPrompt(ctx, userId, tripIdea)
+	var checks []itineraryCheck
+	if ceiling != nil {
+		prompt += budgetPrompt(*ceiling)
+		checks = append(checks, budgetCheck(ctx, *ceiling))
+	}
+
+	events, err := newSSEWriter(w)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	var parser dayStreamParser
+	seen := 0
+	err = llm.StreamJSON(ctx, LLMRequest{Task: taskItinerary, Prompt: prompt}, func(chunk string) error {
+		for _, raw := range parser.Feed(chunk) {
+			var day Day
+			var problems []string
+			if err := json.Unmarshal([]byte(raw), &day); err != nil {
+				problems = []string{fmt.Sprintf("itinerary[%d]: %v", seen, err)}
+			} else {
+				problems = validateDay(seen, day)
+			}
+			seen++
+			if len(problems) > 0 {
+				// Don't show a broken day; later ones still stream.
+				if err := events.Send("error", map[string]interface{}{"error": "invalid_day", "day": seen, "problems": problems}); err != nil {
+					return err
+				}
+				continue
+			}
+			if err := events.Send("day", day); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("Itinerary stream failed: %v", err)
+		events.Send("error", map[string]string{"error": "generation_failed", "message": "The AI Brain is thinking too hard, try again!"})
+		return
+	}
+
+	itinerary, err := repairItinerary(ctx, prompt, parser.String(), repairRetries(), checks...)
+	var verr *ItineraryValidationError
+	if errors.As(err, &verr) {
+		log.Printf("Itinerary rejected: %v", verr)
+		events.Send("error", verr.body())
+		return
+	}
+	if err != nil {
+		events.Send("error", map[string]string{"error": "generation_failed", "message": "The AI Brain is thinking too hard, try again!"})
+		return
+	}
+
+	if optimize {
+		optimizeItinerary(itinerary)
+	}
+	if limits := sensoryLimitsFor(ctx, userId); limits != nil {
+		if over := enforceSensoryLimits(ctx, itinerary, *limits); over > 0 {
+			log.Printf("%d activities left over the sensory limits of %s", over, userId)
+		}
+	}
+	if err := saveGeneratedTrip(ctx, userId, itinerary); err != nil {
+		events.Send("error", map[string]string{"error": "save_failed", "message": "Failed to save itinerary: " + err.Error()})
+		return
+	}
+	events.Send("itinerary", itinerary)
+}
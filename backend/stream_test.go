@@ -0,0 +1,64 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDayStreamParser(t *testing.T) {
+	doc := `{"tripTitle": "itinerary", "notes": [{"day": 0}], "itinerary": [{"day": 1, "title": "a \"}\" b"}, {"day": 2, "activities": [{"x": [1]}]}], "extra": [{"day": 9}]}`
+	var p dayStreamParser
+	var days []string
+	for i := 0; i < len(doc); i += 7 {
+		days = append(days, p.Feed(doc[i:min(i+7, len(doc))])...)
+	}
+	want := []string{`{"day": 1, "title": "a \"}\" b"}`, `{"day": 2, "activities": [{"x": [1]}]}`}
+	if len(days) != len(want) {
+		t.Fatalf("got days %q, want %q", days, want)
+	}
+	for i := range want {
+		if days[i] != want[i] {
+			t.Errorf("day %d: got %q, want %q", i+1, days[i], want[i])
+		}
+	}
+}
+
+// A day that fails validation gets an error event and later days still stream.
+func TestGenerateStreamSkipsInvalidDay(t *testing.T) {
+	t.Setenv("ITINERARY_REPAIR_RETRIES", "0")
+	fake := NewFakeProvider()
+	fake.Responses[taskItinerary] = strings.Replace(fakeFixtures[taskItinerary], `"time": "9:00 AM"`, `"time": "morning"`, 1)
+	setGlobal[LLMProvider](t, &llm, fake)
+
+	rec := httptest.NewRecorder()
+	handleGenerateStream(rec, httptest.NewRequest("POST", "/api/generate/stream", strings.NewReader("A week in Kyoto")))
+
+	type event struct {
+		name string
+		data map[string]interface{}
+	}
+	var events []event
+	scanner := bufio.NewScanner(rec.Body)
+	for scanner.Scan() {
+		if name, ok := strings.CutPrefix(scanner.Text(), "event: "); ok {
+			scanner.Scan()
+			var data map[string]interface{}
+			if err := json.Unmarshal([]byte(strings.TrimPrefix(scanner.Text(), "data: ")), &data); err != nil {
+				t.Fatal(err)
+			}
+			events = append(events, event{name, data})
+		}
+	}
+	if len(events) < 2 {
+		t.Fatalf("got events %+v", events)
+	}
+	if events[0].name != "error" || events[0].data["error"] != "invalid_day" || events[0].data["day"] != 1.0 {
+		t.Errorf("first event %+v, want invalid_day for day 1", events[0])
+	}
+	if events[1].name != "day" || events[1].data["day"] != 2.0 {
+		t.Errorf("second event %+v, want day 2", events[1])
+	}
+}
@@ -0,0 +1,350 @@
+// backend/trips.go
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	errNotOwner        = errors.New("trip belongs to another user")
+	errVersionConflict = errors.New("trip was changed by someone else")
+)
+
+// TripValidationError lists why an edited trip was rejected.
+type TripValidationError struct {
+	Problems []string
+}
+
+func (e *TripValidationError) Error() string {
+	return "invalid trip: " + strings.Join(e.Problems, "; ")
+}
+
+// TripDocument is the part of a trip its owner may edit with PUT and PATCH.
+type TripDocument struct {
+	Itinerary     Itinerary         `json:"itinerary"`
+	StartDate     string            `json:"startDate,omitempty"`
+	EndDate       string            `json:"endDate,omitempty"`
+	Accessibility TripAccessibility `json:"accessibility"`
+	Budget        Money             `json:"budget,omitzero"`
+}
+
+func documentOf(trip *Trip) TripDocument {
+	return TripDocument{
+		Itinerary:     trip.Itinerary,
+		StartDate:     trip.StartDate,
+		EndDate:       trip.EndDate,
+		Accessibility: trip.Accessibility,
+		Budget:        trip.Budget,
+	}
+}
+
+// applyDocument validates doc and copies it onto trip.
+func applyDocument(trip *Trip, doc TripDocument) error {
+	problems := validateItinerary(&doc.Itinerary)
+	start, end, err := resolveTripDates(doc.StartDate, doc.EndDate, len(doc.Itinerary.Itinerary))
+	if err != nil {
+		problems = append(problems, err.Error())
+	}
+	if doc.Budget != (Money{}) {
+		if err := doc.Budget.validate(); err != nil {
+			problems = append(problems, "budget: "+err.Error())
+		}
+	}
+	if len(problems) > 0 {
+		return &TripValidationError{Problems: problems}
+	}
+	doc.StartDate, doc.EndDate = start, end
+	setDocument(trip, doc)
+	return nil
+}
+
+func setDocument(trip *Trip, doc TripDocument) {
+	trip.Itinerary = doc.Itinerary
+	trip.StartDate, trip.EndDate = doc.StartDate, doc.EndDate
+	trip.Accessibility = doc.Accessibility
+	trip.Budget = doc.Budget
+}
+
+// loadOwnedTrip returns the trip only if userId owns it. Other users get
+// ErrNotFound so trip IDs can't be probed.
+func loadOwnedTrip(ctx context.Context, id, userId string) (*Trip, error) {
+	trip, err := tripStore.GetTrip(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if trip.UserID != userId {
+		return nil, ErrNotFound
+	}
+	return trip, nil
+}
+
+// updateOwnedTrip wraps tripStore.UpdateTrip with the ownership and If-Match checks.
+func updateOwnedTrip(r *http.Request, id, reason string, fn func(*Trip) error) (*Trip, error) {
+	userId := userIDFrom(r.Context())
+	expected, err := ifMatchVersion(r)
+	if err != nil {
+		return nil, err
+	}
+	return tripStore.UpdateTrip(r.Context(), id, reason, func(trip *Trip) error {
+		if trip.UserID != userId {
+			return errNotOwner
+		}
+		if expected != 0 && trip.Version != expected {
+			return errVersionConflict
+		}
+		return fn(trip)
+	})
+}
+
+// ifMatchVersion reads an optional If-Match header holding the version the client last saw.
+func ifMatchVersion(r *http.Request) (int, error) {
+	v := strings.Trim(r.Header.Get("If-Match"), `W/" `)
+	if v == "" || v == "*" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 1 {
+		return 0, &TripValidationError{Problems: []string{"If-Match must be a trip version"}}
+	}
+	return n, nil
+}
+
+// writeTripError maps store and validation errors to responses.
+func writeTripError(w http.ResponseWriter, err error) {
+	var verr *TripValidationError
+	switch {
+	case errors.Is(err, ErrNotFound), errors.Is(err, errNotOwner):
+		http.Error(w, "Trip not found", http.StatusNotFound)
+	case errors.Is(err, errVersionConflict):
+		http.Error(w, err.Error(), http.StatusPreconditionFailed)
+	case errors.As(err, &verr):
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"error":    "invalid_trip",
+			"problems": verr.Problems,
+		})
+	default:
+		log.Printf("Trip request failed: %v", err)
+		http.Error(w, "Failed to access trip", http.StatusInternalServerError)
+	}
+}
+
+func writeTrip(w http.ResponseWriter, trip *Trip) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", fmt.Sprintf(`"%d"`, trip.Version))
+	json.NewEncoder(w).Encode(trip)
+}
+
+// handleTrip serves GET, PUT, PATCH and DELETE on /api/trips/{id}.
+// PUT replaces the editable document, PATCH takes a JSON Merge Patch of it.
+func handleTrip(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	switch r.Method {
+	case "GET":
+		trip, err := loadOwnedTrip(r.Context(), id, userIDFrom(r.Context()))
+		if err != nil {
+			writeTripError(w, err)
+			return
+		}
+		writeTrip(w, trip)
+
+	case "PUT":
+		var doc TripDocument
+		dec := json.NewDecoder(r.Body)
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&doc); err != nil {
+			http.Error(w, "Invalid JSON: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		trip, err := updateOwnedTrip(r, id, revisionUpdate, func(trip *Trip) error {
+			return applyDocument(trip, doc)
+		})
+		if err != nil {
+			writeTripError(w, err)
+			return
+		}
+		writeTrip(w, trip)
+
+	case "PATCH":
+		var patch map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&patch); err != nil {
+			http.Error(w, "Invalid JSON: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		trip, err := updateOwnedTrip(r, id, revisionPatch, func(trip *Trip) error {
+			current, err := toJSONValue(documentOf(trip))
+			if err != nil {
+				return err
+			}
+			merged, err := json.Marshal(mergePatch(current, patch))
+			if err != nil {
+				return err
+			}
+			var doc TripDocument
+			dec := json.NewDecoder(strings.NewReader(string(merged)))
+			dec.DisallowUnknownFields()
+			if err := dec.Decode(&doc); err != nil {
+				return &TripValidationError{Problems: []string{err.Error()}}
+			}
+			return applyDocument(trip, doc)
+		})
+		if err != nil {
+			writeTripError(w, err)
+			return
+		}
+		writeTrip(w, trip)
+
+	case "DELETE":
+		if _, err := loadOwnedTrip(r.Context(), id, userIDFrom(r.Context())); err != nil {
+			writeTripError(w, err)
+			return
+		}
+		if err := tripStore.DeleteTrip(r.Context(), id); err != nil {
+			writeTripError(w, err)
+			return
+		}
+		if err := publicTripStore.DeletePublicTrip(r.Context(), id); err != nil && !errors.Is(err, ErrNotFound) {
+			log.Printf("Failed to remove public copy of trip %s: %v", id, err)
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleTripRevisions lists every version of a trip, newest last, without the snapshots.
+func handleTripRevisions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	id := r.PathValue("id")
+	if _, err := loadOwnedTrip(r.Context(), id, userIDFrom(r.Context())); err != nil {
+		writeTripError(w, err)
+		return
+	}
+	revs, err := tripStore.ListRevisions(r.Context(), id)
+	if err != nil {
+		writeTripError(w, err)
+		return
+	}
+	type revisionSummary struct {
+		Version   int       `json:"version"`
+		Reason    string    `json:"reason"`
+		CreatedAt time.Time `json:"createdAt"`
+	}
+	summaries := make([]revisionSummary, 0, len(revs))
+	for _, rev := range revs {
+		summaries = append(summaries, revisionSummary{rev.Version, rev.Reason, rev.CreatedAt})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"revisions": summaries})
+}
+
+// loadOwnedRevision parses the {version} path value and loads that snapshot.
+func loadOwnedRevision(r *http.Request, key string) (*TripRevision, error) {
+	id := r.PathValue("id")
+	if _, err := loadOwnedTrip(r.Context(), id, userIDFrom(r.Context())); err != nil {
+		return nil, err
+	}
+	version, err := strconv.Atoi(key)
+	if err != nil {
+		return nil, &TripValidationError{Problems: []string{fmt.Sprintf("version %q is not a number", key)}}
+	}
+	return tripStore.GetRevision(r.Context(), id, version)
+}
+
+// handleTripRevision returns the full snapshot stored for one version.
+func handleTripRevision(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	rev, err := loadOwnedRevision(r, r.PathValue("version"))
+	if err != nil {
+		writeTripError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rev)
+}
+
+// handleRestoreTripRevision copies an old version's document into a new version.
+func handleRestoreTripRevision(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	rev, err := loadOwnedRevision(r, r.PathValue("version"))
+	if err != nil {
+		writeTripError(w, err)
+		return
+	}
+	trip, err := updateOwnedTrip(r, r.PathValue("id"), revisionRestore, func(trip *Trip) error {
+		setDocument(trip, documentOf(&rev.Trip))
+		return nil
+	})
+	if err != nil {
+		writeTripError(w, err)
+		return
+	}
+	writeTrip(w, trip)
+}
+
+// handleTripDiff compares the documents of two versions: ?from=N&to=M.
+// "to" defaults to the current version.
+func handleTripDiff(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	q := r.URL.Query()
+	if q.Get("from") == "" {
+		http.Error(w, "from is required", http.StatusBadRequest)
+		return
+	}
+	from, err := loadOwnedRevision(r, q.Get("from"))
+	if err != nil {
+		writeTripError(w, err)
+		return
+	}
+	var to *Trip
+	if q.Get("to") == "" {
+		to, err = tripStore.GetTrip(r.Context(), r.PathValue("id"))
+	} else {
+		var rev *TripRevision
+		rev, err = loadOwnedRevision(r, q.Get("to"))
+		if rev != nil {
+			to = &rev.Trip
+		}
+	}
+	if err != nil {
+		writeTripError(w, err)
+		return
+	}
+	changes, err := diffJSON(documentOf(&from.Trip), documentOf(to))
+	if err != nil {
+		writeTripError(w, err)
+		return
+	}
+	if changes == nil {
+		changes = []JSONChange{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"from":    from.Version,
+		"to":      to.Version,
+		"changes": changes,
+	})
+}
@@ -1,9 +1,19 @@
 import { motion } from 'framer-motion';
 
+type ActivitySensory = {
+  audio: number;
+  visual: number;
+  crowds: number;
+  exceeds?: string[];
+  replaces?: string;
+};
+
 type Activity = {
   time: string;
   description: string;
   category: string;
+  conflict?: string;
+  sensory?: ActivitySensory;
 };
 
 type ActivityCardProps = {
@@ -50,6 +60,15 @@ export default function ActivityCard({
         <p className="font-bold">{activity.time}</p>
         <p className="text-slate-300">{activity.description}</p>
         <p className="text-xs text-blue-400 mt-1">{activity.category}</p>
+        {activity.sensory?.exceeds?.length ? (
+          <p className="text-xs text-amber-400 mt-1" role="alert">
+            ⚠ {activity.conflict || `Above your sensory limits: ${activity.sensory.exceeds.join(', ')}`}
+          </p>
+        ) : activity.sensory?.replaces ? (
+          <p className="text-xs text-emerald-400 mt-1">
+            Calmer swap for “{activity.sensory.replaces}”
+          </p>
+        ) : null}
       </div>
     </motion.div>
   );
@@ -0,0 +1,70 @@
+"use client";
+
+import { useEffect, useState } from "react";
+import { useParams } from "next/navigation";
+
+type CommCardText = { en: string; translation: string; backTranslation: string };
+
+type CommCard = {
+  id: string;
+  language: string;
+  languageName: string;
+  nativeName: string;
+  direction: "ltr" | "rtl";
+  title: CommCardText;
+  phrases: (CommCardText & { need: string })[];
+};
+
+// The page a printed card's QR code opens: the card in large, high-contrast
+// type, readable by staff on the traveller's phone.
+export default function SharedCardPage() {
+  const { id } = useParams<{ id: string }>();
+  const [card, setCard] = useState<CommCard | null>(null);
+  const [error, setError] = useState<string | null>(null);
+
+  useEffect(() => {
+    fetch(`http://localhost:8080/api/comm-cards/${id}`)
+      .then(async (res) => {
+        if (!res.ok) throw new Error(res.status === 404 ? "This card does not exist." : "Could not load the card.");
+        setCard(await res.json());
+      })
+      .catch((e) => setError(e.message));
+  }, [id]);
+
+  if (error) return <div className="min-h-screen flex items-center justify-center text-xl">{error}</div>;
+  if (!card) return <div className="min-h-screen flex items-center justify-center text-xl">Loading card...</div>;
+
+  return (
+    <main className="min-h-screen bg-white text-black p-6 max-w-3xl mx-auto">
+      <div lang={card.language} dir={card.direction} className="border-4 border-black rounded-lg p-6 space-y-6">
+        <h1 className="text-4xl font-bold">{card.title.translation}</h1>
+        {card.phrases.map((p, idx) => (
+          <p key={idx} className="text-3xl font-semibold border-t-2 border-black pt-6">
+            {p.translation}
+          </p>
+        ))}
+      </div>
+      <div className="mt-6 flex items-center justify-between text-lg">
+        <span>
+          {card.nativeName} · {card.languageName}
+        </span>
+        <span className="flex gap-4">
+          <a href={`http://localhost:8080/api/comm-cards/${card.id}/pdf`} className="underline font-semibold">
+            PDF
+          </a>
+          <a href={`http://localhost:8080/api/comm-cards/${card.id}/png?download=true`} className="underline font-semibold">
+            PNG
+          </a>
+        </span>
+      </div>
+      <details className="mt-6 text-base">
+        <summary className="cursor-pointer font-semibold">In English</summary>
+        <ul className="mt-2 space-y-2">
+          {card.phrases.map((p, idx) => (
+            <li key={idx}>{p.en}</li>
+          ))}
+        </ul>
+      </details>
+    </main>
+  );
+}
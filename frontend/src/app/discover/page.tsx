@@ -13,75 +13,146 @@ import PioneerCard from "@/components/PioneerCard";
 import { Avatar, AvatarFallback, AvatarImage } from "@/components/ui/avatar";
 import { motion } from "framer-motion";
 import { FaFilter, FaChevronLeft, FaChevronRight } from "react-icons/fa";
+import { auth } from "@/lib/firebase";
+import { getAuth } from "firebase/auth";
+import toast from "react-hot-toast";
 
-const featuredCollections = [
-  {
-    title: "Quiet Coastal Retreats",
-    image: "/coast.jpg",
-  },
-  {
-    title: "A Culinary Tour for Celiacs",
-    image: "/culinary.jpg",
-  },
-  {
-    title: "Step-Free City Escapes",
-    image: "/city.jpg",
-  },
-  {
-    title: "Sensory-Friendly Nature Trails",
-    image: "/nature.jpg",
-  },
-];
+type Collection = {
+  id: string;
+  title: string;
+  description?: string;
+  coverImage: string;
+};
 
 const filterOptions = [
-  { key: "wheelchair", label: "Wheelchair Accessible" },
+  { key: "mobility", label: "Wheelchair Accessible" },
   { key: "sensory", label: "Sensory-Friendly" },
   { key: "lowEnergy", label: "Low Energy" },
 ];
 
 export default function DiscoverPage() {
   const [trips, setTrips] = useState<any[]>([]);
+  const [facets, setFacets] = useState<{ [key: string]: number }>({});
+  const [nextCursor, setNextCursor] = useState<string | null>(null);
   const [loading, setLoading] = useState(true);
   const [search, setSearch] = useState("");
   const [filters, setFilters] = useState<{ [key: string]: boolean }>({});
   const [carouselIdx, setCarouselIdx] = useState(0);
+  const [collections, setCollections] = useState<Collection[]>([]);
+  const [activeCollection, setActiveCollection] = useState<Collection | null>(
+    null
+  );
+  const [collectionTrips, setCollectionTrips] = useState<any[]>([]);
+  const debounce = useRef<ReturnType<typeof setTimeout> | null>(null);
+
+  // Search and filters run on the server; "Load more" follows nextCursor.
+  const fetchTrips = async (cursor?: string) => {
+    const params = new URLSearchParams();
+    if (search.trim()) params.set("q", search.trim());
+    for (const opt of filterOptions) {
+      if (filters[opt.key]) params.set(opt.key, "true");
+    }
+    if (cursor) params.set("cursor", cursor);
+    if (!cursor) setLoading(true);
+    try {
+      const res = await fetch(
+        `http://localhost:8080/api/public-trips?${params.toString()}`
+      );
+      if (!res.ok) throw new Error(await res.text());
+      const data = await res.json();
+      const page = Array.isArray(data.trips) ? data.trips : [];
+      setTrips((prev) => (cursor ? [...prev, ...page] : page));
+      setFacets(data.facets || {});
+      setNextCursor(data.nextCursor || null);
+    } catch {
+      if (!cursor) setTrips([]);
+      setNextCursor(null);
+    }
+    setLoading(false);
+  };
 
   useEffect(() => {
-    const fetchTrips = async () => {
-      setLoading(true);
+    const fetchCollections = async () => {
       try {
-        const res = await fetch("http://localhost:8080/api/public-trips");
+        const res = await fetch("http://localhost:8080/api/collections");
         const data = await res.json();
-  setTrips(Array.isArray(data) ? data : []);
+        setCollections(Array.isArray(data.collections) ? data.collections : []);
       } catch {
-        setTrips([]);
+        setCollections([]);
       }
-      setLoading(false);
     };
-    fetchTrips();
+    fetchCollections();
   }, []);
 
-  // Filter and search logic
-  const filteredTrips = trips.filter((trip) => {
-    if (
-      search &&
-      !trip.tripTitle.toLowerCase().includes(search.toLowerCase()) &&
-      !trip.destination.toLowerCase().includes(search.toLowerCase())
-    ) {
-      return false;
+  // Selecting a collection shows its trips in the grid; selecting it again goes back.
+  const openCollection = async (col: Collection) => {
+    if (activeCollection?.id === col.id) {
+      setActiveCollection(null);
+      return;
+    }
+    setActiveCollection(col);
+    setCollectionTrips([]);
+    try {
+      const res = await fetch(
+        `http://localhost:8080/api/collections/${col.id}`
+      );
+      const data = await res.json();
+      setCollectionTrips(Array.isArray(data.trips) ? data.trips : []);
+    } catch {
+      setCollectionTrips([]);
+    }
+  };
+
+  // Copies a trip into the signed-in user's library, flagging activities
+  // that clash with their profile.
+  const forkTrip = async (id: string) => {
+    const user = getAuth(auth).currentUser;
+    if (!user) {
+      toast.error("Sign in to copy trips to your library.");
+      return;
+    }
+    try {
+      const idToken = await user.getIdToken();
+      const res = await fetch(
+        `http://localhost:8080/api/public-trips/${id}/fork`,
+        {
+          method: "POST",
+          headers: {
+            Authorization: `Bearer ${idToken}`,
+            "Content-Type": "application/json",
+          },
+          body: JSON.stringify({ adapt: "mark" }),
+        }
+      );
+      if (!res.ok) throw new Error(await res.text());
+      const data = await res.json();
+      const flagged = data.changes?.length || 0;
+      toast.success(
+        flagged
+          ? `Copied to your trips. ${flagged} ${flagged === 1 ? "activity is" : "activities are"} marked as a possible clash with your needs.`
+          : "Copied to your trips!"
+      );
+    } catch (err) {
+      toast.error(
+        "Could not copy trip: " + (err instanceof Error ? err.message : String(err))
+      );
     }
-    if (filters.wheelchair && !trip.accessibility?.mobility) return false;
-    if (filters.sensory && !trip.accessibility?.sensory) return false;
-    if (filters.lowEnergy && !trip.accessibility?.lowEnergy) return false;
-    return true;
-  });
+  };
+
+  useEffect(() => {
+    if (debounce.current) clearTimeout(debounce.current);
+    debounce.current = setTimeout(() => fetchTrips(), 300);
+    return () => {
+      if (debounce.current) clearTimeout(debounce.current);
+    };
+  }, [search, filters]);
 
   // Carousel scroll logic
   const scrollCarousel = (dir: "left" | "right") => {
     setCarouselIdx((prev) =>
       dir === "left"
         ? Math.max(prev - 1, 0)
-        : Math.min(prev + 1, featuredCollections.length - 1)
+        : Math.min(prev + 1, Math.max(collections.length - 1, 0))
     );
   };
 
@@ -113,6 +184,7 @@ export default function DiscoverPage() {
                   }
                 >
                   {opt.label}
+                  {facets[opt.key] !== undefined && ` (${facets[opt.key]})`}
                 </DropdownMenuCheckboxItem>
               ))}
             </DropdownMenuContent>
@@ -138,11 +210,12 @@ export default function DiscoverPage() {
               className="flex transition-transform duration-500"
               style={{ transform: `translateX(-${carouselIdx * 320}px)` }}
             >
-              {featuredCollections.map((col, idx) => (
+              {collections.map((col) => (
                 <motion.div
-                  key={col.title}
-                  className="min-w-[320px] h-48 rounded-2xl shadow-lg mr-6 flex items-end p-6 bg-cover bg-center relative"
-                  style={{ backgroundImage: `url(${col.image})` }}
+                  key={col.id}
+                  className="min-w-[320px] h-48 rounded-2xl shadow-lg mr-6 flex items-end p-6 bg-cover bg-center relative cursor-pointer"
+                  style={{ backgroundImage: `url(${col.coverImage})` }}
+                  onClick={() => openCollection(col)}
                   initial={{ opacity: 0, y: 30 }}
                   animate={{ opacity: 1, y: 0 }}
                   whileHover={{
@@ -162,7 +235,7 @@ export default function DiscoverPage() {
           <button
             className="absolute right-0 top-1/2 -translate-y-1/2 bg-white rounded-full shadow p-2 z-10"
             onClick={() => scrollCarousel("right")}
-            disabled={carouselIdx === featuredCollections.length - 1}
+            disabled={carouselIdx >= collections.length - 1}
           >
             <FaChevronRight />
           </button>
@@ -172,7 +245,7 @@ export default function DiscoverPage() {
       {/* Pioneer Itinerary Grid */}
       <section className="max-w-6xl mx-auto px-4">
         <h2 className="text-2xl font-bold mb-8 text-[#1e293b]">
-          Pioneer Itineraries
+          {activeCollection ? activeCollection.title : "Pioneer Itineraries"}
         </h2>
         {loading ? (
           <div className="grid grid-cols-1 sm:grid-cols-2 md:grid-cols-3 gap-8">
@@ -196,7 +269,7 @@ export default function DiscoverPage() {
           </div>
         ) : (
           <div className="grid grid-cols-1 sm:grid-cols-2 md:grid-cols-3 gap-8">
-            {filteredTrips.map((trip, idx) => (
+            {(activeCollection ? collectionTrips : trips).map((trip) => (
               <motion.div
                 key={trip.id}
                 initial={{ opacity: 0, y: 30 }}
@@ -207,11 +280,21 @@ export default function DiscoverPage() {
                 }}
                 transition={{ type: "spring", stiffness: 80, damping: 18 }}
               >
-                <PioneerCard trip={trip} />
+                <PioneerCard trip={trip} onFork={() => forkTrip(trip.id)} />
               </motion.div>
             ))}
           </div>
         )}
+        {!loading && !activeCollection && nextCursor && (
+          <div className="flex justify-center mt-10">
+            <button
+              className="px-6 py-3 bg-white border border-slate-200 rounded-xl shadow hover:bg-slate-50 transition"
+              onClick={() => fetchTrips(nextCursor)}
+            >
+              Load more
+            </button>
+          </div>
+        )}
       </section>
     </main>
   );
@@ -6,6 +6,8 @@ import { Button } from "@/components/ui/button";
 import TripCard from "@/components/TripCard";
 import { motion } from "framer-motion";
 import { FaPlus } from "react-icons/fa";
+import { auth } from "@/lib/firebase";
+import { getAuth } from "firebase/auth";
 
 type Trip = {
   id: string;
@@ -32,7 +34,12 @@ export default function LibraryPage() {
     const fetchTrips = async () => {
       // Replace with real user fetching logic
       setUserName("Traveler");
-      const res = await fetch("http://localhost:8080/api/my-trips");
+      const user = getAuth(auth).currentUser;
+      if (!user) return;
+      const idToken = await user.getIdToken();
+      const res = await fetch("http://localhost:8080/api/my-trips", {
+        headers: { Authorization: `Bearer ${idToken}` },
+      });
       const data = await res.json();
       setUpcoming(data.upcoming || []);
       setPast(data.past || []);
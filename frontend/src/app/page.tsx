@@ -61,6 +61,18 @@ const featureCards = [
   },
 ];
 
+type CommCardText = { en: string; translation: string; backTranslation: string };
+
+type CommCard = {
+  id?: string;
+  url?: string;
+  language: string;
+  languageName: string;
+  direction: 'ltr' | 'rtl';
+  title: CommCardText;
+  phrases: (CommCardText & { need: string })[];
+};
+
 export default function Home() {
   // Mocked sanctuaries for AR/Guardian features
   const sanctuaries = [
@@ -113,7 +125,7 @@ export default function Home() {
   const [showOnboarding, setShowOnboarding] = useState(false);
   const [showGuardian, setShowGuardian] = useState(false);
   const [showSanctuary, setShowSanctuary] = useState(false);
-  const [commCard, setCommCard] = useState<{ en: string; jp: string } | null>(null);
+  const [commCard, setCommCard] = useState<CommCard | null>(null);
   const [commLoading, setCommLoading] = useState(false);
   const [showCommModal, setShowCommModal] = useState(false);
   const [showScriptModal, setShowScriptModal] = useState(false);
@@ -216,10 +228,10 @@ export default function Home() {
       const data = await response.json();
       setItinerary(data);
 
-      // Fetch mock prices if destination is present
+      // Fetch prices if destination is present
       if (data.destination) {
         try {
-          const pricesRes = await fetch('http://localhost:8080/api/mock-prices', {
+          const pricesRes = await fetch('http://localhost:8080/api/prices', {
             method: 'POST',
             headers: { 'Content-Type': 'application/json' },
             body: JSON.stringify({ destination: data.destination }),
@@ -282,17 +294,19 @@ export default function Home() {
     setCommLoading(true);
     setCommCard(null);
     setShowCommModal(true);
+    const headers: Record<string, string> = { 'Content-Type': 'application/json' };
+    if (user) headers['Authorization'] = `Bearer ${await user.getIdToken()}`;
     const res = await fetch('http://localhost:8080/api/generate-comm-card', {
       method: 'POST',
-      headers: { 'Content-Type': 'application/json' },
+      headers,
       body: JSON.stringify({
         place,
         dietary,
-        language: 'ja', // For demo, Japanese
+        language: 'ja', // BCP-47 tag; any language works
       }),
     });
     const data = await res.json();
-    setCommCard({ en: data.en, jp: data.jp });
+    setCommCard(res.ok ? data : null);
     setCommLoading(false);
   };
 
@@ -446,14 +460,41 @@ export default function Home() {
             <div className="text-center py-6 text-blue-500">Generating card...</div>
           ) : commCard ? (
             <div className="space-y-6">
-              <div>
-                <div className="font-semibold mb-2">English</div>
-                <div className="bg-gray-100 rounded-lg p-4 text-lg">{commCard.en}</div>
+              <div lang={commCard.language} dir={commCard.direction} className="bg-blue-50 rounded-lg p-4 space-y-3">
+                <div className="text-2xl font-bold text-blue-700">{commCard.title.translation}</div>
+                {commCard.phrases.map((p, idx) => (
+                  <div key={idx} className="text-xl font-bold text-blue-700">{p.translation}</div>
+                ))}
               </div>
               <div>
-                <div className="font-semibold mb-2">Japanese</div>
-                <div className="bg-blue-50 rounded-lg p-4 text-2xl font-bold text-blue-700">{commCard.jp}</div>
+                <div className="font-semibold mb-2">What staff will read ({commCard.languageName}, translated back)</div>
+                <div className="bg-gray-100 rounded-lg p-4 space-y-2">
+                  {commCard.phrases.map((p, idx) => (
+                    <div key={idx} className="text-base">
+                      <span className="text-xs uppercase text-gray-500 mr-2">{p.need}</span>
+                      {p.backTranslation}
+                    </div>
+                  ))}
+                </div>
               </div>
+              {commCard.id && (
+                <div className="flex gap-3">
+                  <a
+                    href={`http://localhost:8080/api/comm-cards/${commCard.id}/pdf`}
+                    target="_blank"
+                    rel="noopener noreferrer"
+                    className="flex-1 text-center bg-black text-white font-semibold rounded-lg py-2"
+                  >
+                    Print (PDF)
+                  </a>
+                  <a
+                    href={`http://localhost:8080/api/comm-cards/${commCard.id}/png?download=true`}
+                    className="flex-1 text-center border-2 border-black font-semibold rounded-lg py-2"
+                  >
+                    Save image (PNG)
+                  </a>
+                </div>
+              )}
             </div>
           ) : null}
         </DialogContent>
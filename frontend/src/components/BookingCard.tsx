@@ -1,29 +1,49 @@
+type FlightOffer = {
+  id: string;
+  airline: string;
+  flight: string;
+  price: number;
+  currency: string;
+};
+
+type HotelOffer = {
+  id: string;
+  name: string;
+  stars: number;
+  pricePerNight: number;
+  currency: string;
+};
+
 type BookingData = {
-  flights: {
-    airline: string;
-    price: number;
-  };
-  hotels: {
-    name: string;
-    price_per_night: number;
-  };
+  flights: FlightOffer[];
+  hotels: HotelOffer[];
 };
 
+const formatPrice = (amount: number, currency: string) =>
+  new Intl.NumberFormat(undefined, { style: 'currency', currency, maximumFractionDigits: 0 }).format(amount);
+
 export default function BookingCard({ data }: { data: BookingData }) {
+  // Offers come back cheapest first
+  const flight = data.flights?.[0];
+  const hotel = data.hotels?.[0];
   return (
     <div className="bg-slate-800 border border-slate-700 rounded-lg p-6 mt-6 shadow-lg flex flex-col items-center max-w-md mx-auto">
       <h3 className="text-2xl font-bold mb-4 text-blue-400">Prices from...</h3>
       <div className="w-full mb-4">
-        <div className="mb-2">
-          <span className="font-semibold text-white">Flight:</span>
-          <span className="ml-2 text-slate-300">{data.flights.airline}</span>
-          <span className="ml-2 text-green-400 font-bold">₹{data.flights.price}</span>
-        </div>
-        <div>
-          <span className="font-semibold text-white">Hotel:</span>
-          <span className="ml-2 text-slate-300">{data.hotels.name}</span>
-          <span className="ml-2 text-green-400 font-bold">₹{data.hotels.price_per_night}/night</span>
-        </div>
+        {flight && (
+          <div className="mb-2">
+            <span className="font-semibold text-white">Flight:</span>
+            <span className="ml-2 text-slate-300">{flight.airline} {flight.flight}</span>
+            <span className="ml-2 text-green-400 font-bold">{formatPrice(flight.price, flight.currency)}</span>
+          </div>
+        )}
+        {hotel && (
+          <div>
+            <span className="font-semibold text-white">Hotel:</span>
+            <span className="ml-2 text-slate-300">{hotel.name}</span>
+            <span className="ml-2 text-green-400 font-bold">{formatPrice(hotel.pricePerNight, hotel.currency)}/night</span>
+          </div>
+        )}
       </div>
       <button
         className="bg-blue-500 hover:bg-blue-600 text-white font-bold py-2 px-6 rounded-lg shadow transition mt-2"
@@ -33,4 +53,4 @@ export default function BookingCard({ data }: { data: BookingData }) {
       </button>
     </div>
   );
-}
\ No newline at end of file
+}
@@ -1,4 +1,4 @@
-import { useState } from 'react';
+import { useEffect, useState } from 'react';
 import { APIProvider, Map } from '@vis.gl/react-google-maps';
 import { motion } from 'framer-motion';
 import { Switch } from '@/components/ui/switch';
@@ -27,12 +27,23 @@ type Props = {
   onMarkerClick: (idx: number) => void;
 };
 
-const mockReliefPoints: ReliefPoint[] = [
-  { lat: 12.935, lng: 77.619, type: 'restroom', label: 'Accessible Restroom - Central Park' },
-  { lat: 12.938, lng: 77.622, type: 'restroom', label: 'Accessible Restroom - Museum' },
-  { lat: 12.932, lng: 77.615, type: 'quiet', label: 'Quiet Zone - Library' },
-  { lat: 12.936, lng: 77.617, type: 'quiet', label: 'Quiet Zone - Botanical Garden' },
-];
+// The relief points API refuses boxes wider than this many degrees.
+const MAX_BOX_DEGREES = 0.5;
+const BOX_PADDING = 0.01;
+
+// reliefBBox is the box around the activities, as minLng,minLat,maxLng,maxLat.
+function reliefBBox(activities: Activity[]): string | null {
+  const placed = activities.filter(a => a.lat !== 0 || a.lng !== 0);
+  if (placed.length === 0) return null;
+  const clamp = (lo: number, hi: number) => {
+    const mid = (lo + hi) / 2;
+    const half = Math.min((hi - lo) / 2 + BOX_PADDING, MAX_BOX_DEGREES / 2);
+    return [mid - half, mid + half];
+  };
+  const [minLat, maxLat] = clamp(Math.min(...placed.map(a => a.lat)), Math.max(...placed.map(a => a.lat)));
+  const [minLng, maxLng] = clamp(Math.min(...placed.map(a => a.lng)), Math.max(...placed.map(a => a.lng)));
+  return [minLng, minLat, maxLng, maxLat].map(n => n.toFixed(5)).join(',');
+}
 
 export default function InteractiveMap({
   activities,
@@ -43,6 +54,30 @@ export default function InteractiveMap({
 }: Props) {
   const [showRestrooms, setShowRestrooms] = useState(false);
   const [showQuietZones, setShowQuietZones] = useState(false);
+  const [reliefPoints, setReliefPoints] = useState<ReliefPoint[]>([]);
+
+  const bbox = reliefBBox(activities || []);
+  useEffect(() => {
+    if (!bbox || (!showRestrooms && !showQuietZones)) return;
+    let cancelled = false;
+    fetch(`http://localhost:8080/api/relief-points?bbox=${bbox}&kinds=accessibleRestroom,quietRoom&limit=200`)
+      .then(res => (res.ok ? res.json() : { points: [] }))
+      .then((data: { points: { lat: number; lng: number; kind: string; name: string }[] }) => {
+        if (cancelled) return;
+        setReliefPoints(
+          data.points.map(p => ({
+            lat: p.lat,
+            lng: p.lng,
+            type: p.kind === 'quietRoom' ? 'quiet' : 'restroom',
+            label: p.name,
+          }))
+        );
+      })
+      .catch(err => console.error('Failed to load relief points', err));
+    return () => {
+      cancelled = true;
+    };
+  }, [bbox, showRestrooms, showQuietZones]);
 
   if (!activities || activities.length === 0) return null;
   const center = { lat: activities[0].lat, lng: activities[0].lng };
@@ -104,7 +139,7 @@ export default function InteractiveMap({
           })}
           {/* Relief View markers */}
           {showRestrooms &&
-            mockReliefPoints
+            reliefPoints
               .filter(p => p.type === 'restroom')
               .map((p, idx) => (
                 <motion.div
@@ -125,7 +160,7 @@ export default function InteractiveMap({
                 </motion.div>
               ))}
           {showQuietZones &&
-            mockReliefPoints
+            reliefPoints
               .filter(p => p.type === 'quiet')
               .map((p, idx) => (
                 <motion.div
@@ -16,6 +16,7 @@ type MobilityPrefs = {
 type SensoryPrefs = {
   noise: number;
   visual: number;
+  limits: boolean;
 };
 
 export default function OnboardingModal({ onComplete }: { onComplete: () => void }) {
@@ -25,7 +26,7 @@ export default function OnboardingModal({ onComplete }: { onComplete: () => void
     avoidStairs: false,
     frequentRests: false,
   });
-  const [sensory, setSensory] = useState<SensoryPrefs>({ noise: 0, visual: 0 });
+  const [sensory, setSensory] = useState<SensoryPrefs>({ noise: 0, visual: 0, limits: false });
   const [dietary, setDietary] = useState<string[]>([]);
   const [tagInput, setTagInput] = useState('');
   const [saving, setSaving] = useState(false);
@@ -133,6 +134,14 @@ export default function OnboardingModal({ onComplete }: { onComplete: () => void
                       <span>Love Vibrant</span>
                     </div>
                   </div>
+                  <label className="flex items-center gap-2">
+                    <input
+                      type="checkbox"
+                      checked={sensory.limits}
+                      onChange={e => setSensory(s => ({ ...s, limits: e.target.checked }))}
+                    />
+                    Swap out places above my comfort levels
+                  </label>
                 </div>
               )}
               {step === 2 && (
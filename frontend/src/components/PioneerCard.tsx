@@ -1,6 +1,6 @@
 import { Card, CardHeader, CardTitle, CardContent } from "@/components/ui/card";
 import { Avatar, AvatarFallback, AvatarImage } from "@/components/ui/avatar";
-import { FaQuoteLeft } from "react-icons/fa";
+import { FaQuoteLeft, FaCopy } from "react-icons/fa";
 
 type PioneerTrip = {
   tripTitle: string;
@@ -8,9 +8,16 @@ type PioneerTrip = {
   userName?: string;
   userAvatar?: string;
   keyInsight?: string;
+  ratings?: { count: number; average: number; verified?: unknown[] };
 };
 
-export default function PioneerCard({ trip }: { trip: PioneerTrip }) {
+export default function PioneerCard({
+  trip,
+  onFork,
+}: {
+  trip: PioneerTrip;
+  onFork?: () => void;
+}) {
   return (
     <Card className="bg-white border-0 shadow-lg rounded-xl p-6 flex flex-col min-h-[220px]">
       <CardHeader className="flex flex-row items-center gap-4 mb-2">
@@ -29,6 +36,15 @@ export default function PioneerCard({ trip }: { trip: PioneerTrip }) {
           <div className="text-xs text-blue-500 mt-1">
             Shared by {trip.userName || "Auryvia Pioneer"}
           </div>
+          {trip.ratings && trip.ratings.count > 0 && (
+            <div className="text-xs text-amber-600 mt-1">
+              ★ {trip.ratings.average.toFixed(1)} ({trip.ratings.count}{" "}
+              {trip.ratings.count === 1 ? "review" : "reviews"})
+              {trip.ratings.verified?.length
+                ? " · peer-verified accessibility"
+                : ""}
+            </div>
+          )}
         </div>
       </CardHeader>
       <CardContent className="mt-2 flex items-center gap-2">
@@ -38,6 +54,15 @@ export default function PioneerCard({ trip }: { trip: PioneerTrip }) {
             "“This trip was a game changer for my comfort and independence.”"}
         </span>
       </CardContent>
+      {onFork && (
+        <button
+          className="mt-auto self-end flex items-center gap-2 text-sm text-blue-600 hover:text-blue-800"
+          onClick={onFork}
+        >
+          <FaCopy />
+          Copy to my trips
+        </button>
+      )}
             </Card>
         )
     }
\ No newline at end of file
@@ -3,14 +3,26 @@
 import { useEffect, useState } from 'react';
 import { motion } from 'framer-motion';
 
-type SensoryProfile = {
+type SensoryScores = {
   audio: number;
   visual: number;
   crowds: number;
+};
+
+type SensoryProfile = SensoryScores & {
   summary: string;
+  weekday: string;
+  hour?: number;
+  buckets: (SensoryScores & { hour: number })[];
+};
+
+type Props = {
+  location: string;
+  date?: string; // planned visit day, "2006-01-02"
+  time?: string; // planned visit time, like "2:00 PM"
 };
 
-export default function SensoryFingerprint({ location }: { location: string }) {
+export default function SensoryFingerprint({ location, date, time }: Props) {
   const [profile, setProfile] = useState<SensoryProfile | null>(null);
   const [loading, setLoading] = useState(true);
 
@@ -19,15 +31,18 @@ export default function SensoryFingerprint({ location }: { location: string }) {
     fetch('http://localhost:8080/api/sensory-profile', {
       method: 'POST',
       headers: { 'Content-Type': 'application/json' },
-      body: JSON.stringify({ location }),
+      body: JSON.stringify({ location, date, time }),
     })
-      .then(res => res.json())
+      .then(res => {
+        if (!res.ok) throw new Error(`sensory profile failed: ${res.status}`);
+        return res.json();
+      })
       .then(data => {
         setProfile(data);
         setLoading(false);
       })
       .catch(() => setLoading(false));
-  }, [location]);
+  }, [location, date, time]);
 
   const chart = (label: string, value: number, color: string) => (
     <div className="flex flex-col items-center mx-2">
@@ -91,6 +106,13 @@ export default function SensoryFingerprint({ location }: { location: string }) {
       <div className="text-gray-700 text-base text-center mt-2">
         {profile?.summary || 'Analyzing sensory profile...'}
       </div>
+      {profile && (
+        <div className="text-xs text-gray-500 mt-2">
+          {profile.hour !== undefined
+            ? `Expected around ${String(profile.hour).padStart(2, '0')}:00${profile.weekday !== 'any' ? ` on a ${profile.weekday}` : ''}`
+            : 'Busiest time of day'}
+        </div>
+      )}
     </div>
   );
 }
\ No newline at end of file